@@ -0,0 +1,26 @@
+//go:build unix
+
+// 进程 CPU 时间（getrusage），Unix 平台。
+// 未编译本文件时不报告 CPU 时间。
+//
+// Usage: go run tls_bench_go.go tls_bench_cpu_unix.go <host> <port> [count]
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+func init() {
+	processCPU = rusageCPU
+}
+
+// rusageCPU 返回本进程（所有线程）累计的用户态和内核态 CPU 时间
+func rusageCPU() (user, sys time.Duration) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0
+	}
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano())
+}
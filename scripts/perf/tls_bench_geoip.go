@@ -0,0 +1,53 @@
+//go:build geoip
+
+// 离线 IP 地理位置标注（-geodb），引入 github.com/oschwald/maxminddb-golang v1 读取 .mmdb 库，仅在 -tags geoip 时编译。
+// 支持 GeoLite2 / GeoIP2 的 City 和 Country 库，查询不联网；未编译本文件时 -geodb 不可用。
+//
+// Usage: go run -tags geoip tls_bench_go.go tls_bench_geoip.go -geodb GeoLite2-City.mmdb [-geo-origin lat,lon] <host> <port> [count]
+
+package main
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func init() {
+	geoOpen = openMaxMind
+}
+
+// mmdbRecord 是 City / Country 库中用到的字段；Country 库没有 city 和 location
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// openMaxMind 打开 path 处的 .mmdb 文件，查询在内存映射的数据上进行
+func openMaxMind(path string) (geoLocator, func() error, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	locate := func(ip net.IP) (geoInfo, error) {
+		var rec mmdbRecord
+		if err := db.Lookup(ip, &rec); err != nil {
+			return geoInfo{}, err
+		}
+		return geoInfo{
+			Country:   rec.Country.ISOCode,
+			City:      rec.City.Names["en"],
+			Latitude:  rec.Location.Latitude,
+			Longitude: rec.Location.Longitude,
+		}, nil
+	}
+	return locate, db.Close, nil
+}
@@ -2,226 +2,7523 @@
 //
 // 测量 Go crypto/tls 单次 TLS 握手延迟分布，与 Rust 版本对比。
 //
-// Usage: go run tls_bench_go.go <host> <port> [count]
+// 开启证书校验时，内置校验被替换为 VerifyConnection 回调中同样完整的
+// 证书链校验（见 verifyChain），以便单独统计校验耗时；校验失败照常使握手失败。
+//
+// 需要 Go 1.25+（读取 ConnectionState.CurveID）。
+//
+// Usage: go run tls_bench_go.go [options] <host> <port> [count]
+//        go run tls_bench_go.go [options] <host:port> [host:port ...]   # 多目标对比
+//        go run tls_bench_go.go -h   # 列出全部选项
 
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/fips140"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
 	"math"
+	"math/big"
+	"math/bits"
+	"math/rand/v2"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-func measureHandshake(host string, port int) (tcpDuration, tlsDuration time.Duration, err error) {
-	addr := fmt.Sprintf("%s:%d", host, port)
+// p999MinSamples 是报告 p99.9 所需的最小样本数
+const p999MinSamples = 1000
 
-	// 1. TCP 连接
-	tcpStart := time.Now()
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
-	if err != nil {
-		return 0, 0, err
+// ticketWait 是 -resume 模式下握手后等待 TLS 1.3 session ticket 的时间（不计入握手耗时）
+const ticketWait = 50 * time.Millisecond
+
+// millis 把耗时转换为毫秒（保留纳秒精度）。内部统计、JSON/CSV/Prometheus 输出一律以毫秒计，
+// 只有文本报告按 -unit 换算。
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// timeUnit 是文本报告中显示延迟的单位
+type timeUnit struct {
+	Name  string  // 单位后缀
+	PerMs float64 // 1ms 折合多少个该单位
+	Prec  int     // 小数位数
+	// Wide 是 -precision 比默认多出的小数位数，表格列宽随之增加以保持对齐
+	Wide int
+}
+
+// timeUnits 是 -unit 接受的取值
+var timeUnits = map[string]timeUnit{
+	"ms": {Name: "ms", PerMs: 1, Prec: 2},
+	"us": {Name: "us", PerMs: 1e3, Prec: 1},
+	"ns": {Name: "ns", PerMs: 1e6, Prec: 0},
+}
+
+// unit 是当前的显示单位，由 -unit 设置
+var unit = timeUnits["ms"]
+
+// f 把毫秒值 ms 按显示单位格式化为右对齐到 width 的数字加单位后缀，如 "    1.50ms"
+func (u timeUnit) f(width int, ms float64) string {
+	return fmt.Sprintf("%*.*f%s", u.col(width), u.Prec, ms*u.PerMs, u.Name)
+}
+
+// col 返回按默认精度设计的列宽 width 在当前精度下的实际宽度，0 表示不对齐
+func (u timeUnit) col(width int) int {
+	if width == 0 {
+		return 0
 	}
-	tcpDuration = time.Since(tcpStart)
+	return width + u.Wide
+}
 
-	// 2. TLS 握手
-	tlsConfig := &tls.Config{
-		ServerName:         host,
-		InsecureSkipVerify: false,
+// signed 与 f 相同但总带正负号，用于差值
+func (u timeUnit) signed(ms float64) string {
+	return fmt.Sprintf("%+.*f%s", u.Prec, ms*u.PerMs, u.Name)
+}
+
+// handshakeResult 是一次握手的测量结果
+type handshakeResult struct {
+	DNS        time.Duration // host 为 IP 字面量时为 0
+	TCP        time.Duration
+	TLS        time.Duration
+	Verify     time.Duration // TLS 中证书链校验的耗时；-insecure 或会话恢复时为 0
+	OCSP       *ocspStaple   // 服务器 stapling 的 OCSP 响应，没有时为 nil
+	OCSPVerify time.Duration // 解析并校验 OCSP staple 的耗时
+	TTFB       time.Duration // -http 模式下从发出请求到收到首字节的耗时
+	// FirstResponse 是 -early-data 下从开始 QUIC 拨号到收到 HTTP/3 响应首字节的耗时（含握手）
+	FirstResponse time.Duration
+	Proxy         time.Duration       // -socks5 / -http-proxy 模式下建立隧道（代理到目标的一跳）的耗时；-chain 时为各跳之和
+	Hops          []time.Duration     // -chain 时每一跳 CONNECT 的耗时，第 i 跳包含经过前 i-1 跳的往返
+	Family        string              // 实际连接的地址族，"IPv4" 或 "IPv6"
+	RemoteIP      string              // TCP 对端的 IP（经代理时为代理），Unix 套接字时为空
+	LocalIP       string              // TCP 连接实际使用的源 IP，Unix 套接字时为空
+	State         tls.ConnectionState // 协商结果，仅握手成功时有效
+
+	ClientCertRequested bool          // 服务器是否要求客户端证书
+	HTTPStatus          int           // -http 模式下的响应状态码
+	Retries             int           // -retries 模式下本次测量之前失败并重试的次数
+	PairedTCP           time.Duration // -paired 时紧接在本次握手之前单独测得的 TCP 连接耗时
+	ZeroRTT             bool          // -quic 模式下服务器是否接受了 0-RTT
+	TFO                 bool          // -tfo 模式下 SYN 携带的数据是否被服务器接受
+	ECH                 bool          // -ech 模式下服务器是否接受了 Encrypted Client Hello
+
+	ClientHello int        // opts.HelloSize 时实际发送的 ClientHello 握手消息字节数
+	Conn        *tls.Conn  // opts.KeepOpen 时握手后的连接，由调用方关闭
+	Phases      *tlsPhases // opts.Phases 时 TLS 握手的子阶段划分
+}
+
+// tlsPhases 把一次 TLS 握手按 crypto/tls 可观察到的时间点切成四段，四段之和等于 TLS。
+// crypto/tls 不暴露握手消息的边界，只能用连接上的读和 VerifyConnection 回调近似：
+//   - ServerHello：从发出 ClientHello 到读到服务器的第一批字节（1 RTT + 服务器处理）
+//   - ServerFlight：从第一批字节到进入 VerifyConnection（读取证书、密钥计算）
+//   - Verify：VerifyConnection 回调本身（证书链和 OCSP staple 校验，-insecure 时接近 0）
+//   - Finished：回调返回到握手完成（TLS 1.3 的 CertificateVerify 签名校验、双方 Finished）
+//
+// 第一次读可能一并收到之后的多个记录，TLS 1.2 中回调之后还有 ServerKeyExchange，
+// 因此各段只是近似的上界或下界，适合对比而不是精确归因。
+type tlsPhases struct {
+	ServerHello  time.Duration
+	ServerFlight time.Duration
+	Verify       time.Duration
+	Finished     time.Duration
+}
+
+// tlsVersions 是 -min-version / -max-version 接受的取值
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion 解析 "1.2" 这样的版本号，空串表示不限制
+func parseTLSVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
 	}
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", s)
+	}
+	return v, nil
+}
 
-	tlsStart := time.Now()
-	tlsConn := tls.Client(conn, tlsConfig)
-	err = tlsConn.Handshake()
-	tlsDuration = time.Since(tlsStart)
+// parseCipherSuites 把逗号分隔的套件名（如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256）映射为 ID,
+// 同时返回其中属于 tls.InsecureCipherSuites 的名称。TLS 1.3 套件在 Go 中不可配置，视为错误。
+func parseCipherSuites(s string) (ids []uint16, insecure []string, err error) {
+	byName := make(map[string]*tls.CipherSuite)
+	var valid []string
+	for _, cs := range tls.CipherSuites() {
+		byName[cs.Name] = cs
+		if !slices.Contains(cs.SupportedVersions, tls.VersionTLS13) {
+			valid = append(valid, cs.Name)
+		}
+	}
+	insecureIDs := make(map[uint16]bool)
+	for _, cs := range tls.InsecureCipherSuites() {
+		byName[cs.Name] = cs
+		insecureIDs[cs.ID] = true
+		valid = append(valid, cs.Name+" (insecure)")
+	}
 
-	tlsConn.Close()
+	names := splitList(s)
+	if len(names) == 0 {
+		return nil, nil, errors.New("no cipher suites given")
+	}
+	for _, name := range names {
+		cs, ok := byName[strings.ToUpper(name)]
+		switch {
+		case !ok:
+			return nil, nil, fmt.Errorf("unknown cipher suite %q; valid values:\n  %s", name, strings.Join(valid, "\n  "))
+		case slices.Equal(cs.SupportedVersions, []uint16{tls.VersionTLS13}):
+			return nil, nil, fmt.Errorf("%s is a TLS 1.3 suite; Go does not allow configuring TLS 1.3 cipher suites", cs.Name)
+		}
+		ids = append(ids, cs.ID)
+		if insecureIDs[cs.ID] {
+			insecure = append(insecure, cs.Name)
+		}
+	}
+	return ids, insecure, nil
+}
 
-	if err != nil {
-		return tcpDuration, 0, err
+// keyExchangeGroups 是 -groups 可选的密钥交换组，按 crypto/tls 的默认优先级排列
+var keyExchangeGroups = []tls.CurveID{
+	tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521,
+}
+
+// parseGroups 解析 -groups 的逗号分隔列表，名称不区分大小写；CurveP256 也可写作 P-256、P256 或 secp256r1
+func parseGroups(s string) ([]tls.CurveID, error) {
+	byName := make(map[string]tls.CurveID)
+	var valid []string
+	for _, id := range keyExchangeGroups {
+		byName[strings.ToLower(id.String())] = id
+		if bits, ok := strings.CutPrefix(id.String(), "CurveP"); ok {
+			byName["p-"+bits] = id
+			byName["p"+bits] = id
+			byName["secp"+bits+"r1"] = id
+		}
+		valid = append(valid, id.String())
 	}
 
-	return tcpDuration, tlsDuration, nil
+	names := splitList(s)
+	if len(names) == 0 {
+		return nil, errors.New("no groups given")
+	}
+	var ids []tls.CurveID
+	for _, name := range names {
+		id, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown group %q; valid values: %s", name, strings.Join(valid, ", "))
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
 }
 
-func calculateStats(durations []float64) (min, max, p50, p90, p99, stdev, mean float64) {
-	sort.Float64s(durations)
-	n := len(durations)
+// tlsVersionBounds 解析 -min-version / -max-version。Go 客户端默认最低 TLS 1.2，
+// 只固定了更低的上限时把下限放开到 TLS 1.0，否则区间为空
+func tlsVersionBounds(minFlag, maxFlag string) (minVersion, maxVersion uint16, err error) {
+	if minVersion, err = parseTLSVersion(minFlag); err != nil {
+		return 0, 0, fmt.Errorf("invalid -min-version: %w", err)
+	}
+	if maxVersion, err = parseTLSVersion(maxFlag); err != nil {
+		return 0, 0, fmt.Errorf("invalid -max-version: %w", err)
+	}
+	if minVersion == 0 && maxVersion != 0 && maxVersion < tls.VersionTLS12 {
+		minVersion = tls.VersionTLS10
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return 0, 0, fmt.Errorf("-min-version %s is greater than -max-version %s", minFlag, maxFlag)
+	}
+	return minVersion, maxVersion, nil
+}
 
-	sum := 0.0
-	for _, d := range durations {
-		sum += d
+// versionRange 描述 tls.Config 上固定的版本区间，用于错误信息
+func versionRange(cfg *tls.Config) string {
+	name := func(v uint16, def string) string {
+		if v == 0 {
+			return def
+		}
+		return tls.VersionName(v)
+	}
+	return name(cfg.MinVersion, "default") + " - " + name(cfg.MaxVersion, "default")
+}
+
+// isVersionMismatch 判断握手失败是否因为服务器以 protocol_version（70）alert 拒绝了版本区间。
+// TCP 上 crypto/tls 把收到的 alert 作为未导出的 uint8 类型包在 Op 为 "remote error" 的
+// *net.OpError 里，只能按值取出；QUIC 上为 tls.AlertError。
+func isVersionMismatch(err error) bool {
+	const protocolVersion = 70
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		return alert == protocolVersion
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		v := reflect.ValueOf(opErr.Err)
+		return v.CanUint() && v.Uint() == protocolVersion
+	}
+	return false
+}
+
+// isTimeout 判断错误是否由连接超时或截止时间引起
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// logLevel 是 -q / -v 选择的诊断输出级别
+type logLevel int
+
+const (
+	levelQuiet logLevel = iota // -q：只输出结果
+	levelInfo                  // 默认：进度、预热和附加测试的过程
+	levelDebug                 // -v：另外输出每次握手的协商参数和重试
+)
+
+// logger 把进度和诊断信息按级别写到 w（stderr），结果报告不经过这里。
+// 作为 io.Writer 时按 info 级别输出，供附加测试的进度使用。
+type logger struct {
+	w     io.Writer
+	level logLevel
+}
+
+// diag 是全局的诊断输出，由 -q / -v 设置级别
+var diag = &logger{w: os.Stderr, level: levelInfo}
+
+func (l *logger) Write(p []byte) (int, error) {
+	if l.level < levelInfo {
+		return len(p), nil
+	}
+	return l.w.Write(p)
+}
+
+// Infof 输出默认级别的诊断信息，-q 时丢弃
+func (l *logger) Infof(format string, args ...any) {
+	fmt.Fprintf(l, format, args...)
+}
+
+// Debugf 只在 -v 时输出
+func (l *logger) Debugf(format string, args ...any) {
+	if l.level >= levelDebug {
+		fmt.Fprintf(l.w, format, args...)
+	}
+}
+
+// debugSample 在 -v 时输出一次测量的详细结果；name 为附加测试的名称，正式测试为空
+func debugSample(name string, s sample) {
+	if diag.level < levelDebug {
+		return
+	}
+	prefix := fmt.Sprintf("  #%d", s.Index)
+	if name != "" {
+		prefix = fmt.Sprintf("  %s #%d", name, s.Index)
+	}
+	if s.Worker > 0 {
+		prefix += fmt.Sprintf(" (worker %d)", s.Worker)
+	}
+	if s.Err != nil {
+		diag.Debugf("%s: error after %s: %v\n", prefix, s.Elapsed.Round(time.Microsecond), s.Err)
+		return
+	}
+	res := s.Result
+	line := fmt.Sprintf("%s: DNS=%s TCP=%s TLS=%s %s", prefix, unit.f(0, millis(res.DNS)), unit.f(0, millis(res.TCP)),
+		unit.f(0, millis(res.TLS)), negotiatedFrom(res.State))
+	if res.State.CurveID != 0 {
+		line += " group=" + res.State.CurveID.String()
+	}
+	if res.LocalIP != "" {
+		line += " src=" + res.LocalIP
+	}
+	if res.State.DidResume {
+		line += " resumed"
+	}
+	if res.Retries > 0 {
+		line += fmt.Sprintf(" retries=%d", res.Retries)
+	}
+	diag.Debugf("%s\n", line)
+}
+
+// handshakeOptions 控制 measureHandshake 的建连方式
+type handshakeOptions struct {
+	TLS       *tls.Config // 模板，每次握手复制一份，ServerName 为 SNI（未设置时为 host）
+	SNI       string      // 覆盖 ServerName，拨号仍使用 host；证书校验也按 SNI 进行
+	Network   string      // "tcp"、"tcp4" 或 "tcp6"
+	DualStack bool        // 在 IPv6 与 IPv4 地址间做 Happy Eyeballs 竞速
+	HTTPPath  string      // 非空时握手后发送 GET 请求并测量 TTFB
+
+	ConnectTimeout   time.Duration  // TCP 连接超时
+	HandshakeTimeout time.Duration  // TLS 握手超时，0 表示不限
+	TFO              bool           // 使用 TCP Fast Open 拨号（需要 tfoControl）
+	Proxy            *proxyConfig   // 非 nil 时经该代理建立隧道，目标域名由代理解析
+	Chain            []*proxyConfig // -chain 时 Proxy 之后依次经过的代理，每一跳的地址由上一跳解析
+	KeepOpen         bool           // 握手后不关闭连接，通过 res.Conn 交给调用方（-reuse）
+	Unix             string         // 非空时连接该 Unix 套接字，跳过 DNS 和 TCP 阶段
+	Pool             *connPool      // 非 nil 时从池中取预先建立的 TCP 连接，跳过 DNS 和 TCP 阶段（-predial）
+	LocalAddr        net.IP         // 非 nil 时绑定该源地址拨号（-local-addr）
+	ProxyHeader      bool           // TLS 握手前先发送 PROXY protocol v2 头（-proxy-protocol）
+	ProxyHeaderSrc   *net.TCPAddr   // PROXY 头中的客户端地址，nil 时为本地套接字地址
+	HelloSize        bool           // 记录实际发送的 ClientHello 大小（-client-hello-padding）
+	Phases           bool           // 记录 TLS 握手的子阶段（-phases）
+	EarlyData        bool           // QUIC 握手中立即发送 HTTP/3 GET（有 ticket 时即为 0-RTT 数据，-early-data）
+	Netem            *netem         // 非 nil 时在应用层给每个往返注入延迟（-inject-rtt），TCP 阶段另加一个往返
+	ConnectOnly      bool           // TCP 连接（经代理时含隧道）建立后立即关闭，不做 TLS 握手（-connect-only）
+	MaxChainDepth    int            // 服务器发送的证书数超过该值时握手记为失败，0 表示不限（-max-chain-depth）
+}
+
+// dialer 返回 TCP 拨号用的 net.Dialer，设置了 LocalAddr 时从该地址拨出（端口由内核分配）
+func (o *handshakeOptions) dialer() net.Dialer {
+	d := net.Dialer{Timeout: o.ConnectTimeout}
+	if o.LocalAddr != nil {
+		d.LocalAddr = &net.TCPAddr{IP: o.LocalAddr}
 	}
-	mean = sum / float64(n)
+	return d
+}
+
+// serverName 返回连接 host 时使用的 SNI：-sni 优先，Unix 套接字的路径不是主机名，按 localhost 校验
+func (o *handshakeOptions) serverName(host string) string {
+	switch {
+	case o.SNI != "":
+		return o.SNI
+	case o.Unix != "":
+		return "localhost"
+	}
+	return host
+}
 
-	min = durations[0]
-	max = durations[n-1]
-	p50 = durations[n*50/100]
-	p90 = durations[n*90/100]
-	if n*99/100 < n {
-		p99 = durations[n*99/100]
+// TCP Fast Open 依赖平台相关的 socket 选项，由 tls_bench_tfo_linux.go 在 init 中注册；
+// 未编译进来时均为 nil，-tfo 回退为普通连接。
+var (
+	tfoControl func(network, address string, c syscall.RawConn) error
+	tfoSYNData func(conn net.Conn) bool // 握手完成后判断 SYN 数据是否被服务器接受
+)
+
+// fallbackDelay 是 dual-stack 竞速时启动备选地址族前的等待时间（与 net.Dialer 默认值一致）
+const fallbackDelay = 300 * time.Millisecond
+
+// resolve 解析 host 并按 network 过滤地址族，IP 字面量直接返回
+func resolve(host, network string) (addrs []string, dns time.Duration, err error) {
+	if net.ParseIP(host) != nil {
+		addrs = []string{host}
 	} else {
-		p99 = durations[n-1]
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		dnsStart := time.Now()
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+		dns = time.Since(dnsStart)
+		if err != nil {
+			return nil, dns, err
+		}
 	}
 
-	variance := 0.0
-	for _, d := range durations {
-		variance += (d - mean) * (d - mean)
+	if network == "tcp" {
+		return addrs, dns, nil
+	}
+	var filtered []string
+	for _, a := range addrs {
+		if isIPv4 := net.ParseIP(a).To4() != nil; isIPv4 == (network == "tcp4") {
+			filtered = append(filtered, a)
+		}
 	}
-	variance /= float64(n)
-	stdev = math.Sqrt(variance)
+	if len(filtered) == 0 {
+		return nil, dns, fmt.Errorf("no %s address for %s", familyName(network), host)
+	}
+	return filtered, dns, nil
+}
 
-	return
+// familyName 返回 "tcp4"/"tcp6" 对应的地址族名称
+func familyName(network string) string {
+	if network == "tcp4" {
+		return "IPv4"
+	}
+	return "IPv6"
 }
 
-func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <host> <port> [count]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Example: %s example.com 443 100\n", os.Args[0])
-		os.Exit(1)
+// localInterfaces 返回本机各接口上配置的 IP（字符串形式）到接口名的映射
+func localInterfaces() map[string]string {
+	names := make(map[string]string)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return names
+	}
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				names[ipnet.IP.String()] = iface.Name
+			}
+		}
+	}
+	return names
+}
+
+// sourceLabel 返回 "IP (接口名)"，接口未知时只有 IP
+func sourceLabel(ip string, ifaceNames map[string]string) string {
+	if name, ok := ifaceNames[ip]; ok {
+		return fmt.Sprintf("%s (%s)", ip, name)
 	}
+	return ip
+}
 
-	host := os.Args[1]
-	port, err := strconv.Atoi(os.Args[2])
+// parseLocalAddr 解析 -local-addr：IP 字面量须已配置在本机某个接口上；接口名取该接口的
+// 第一个可用地址，network 为 "tcp6" 时取 IPv6，否则优先 IPv4（IPv6 链路本地地址需要 zone，跳过）。
+func parseLocalAddr(s, network string) (ip net.IP, iface string, err error) {
+	names := localInterfaces()
+	if ip = net.ParseIP(s); ip != nil {
+		iface, ok := names[ip.String()]
+		if !ok {
+			return nil, "", fmt.Errorf("%s is not assigned to any local interface", s)
+		}
+		return ip, iface, nil
+	}
+	ifc, err := net.InterfaceByName(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("%q is neither an IP address nor a network interface", s)
+	}
+	addrs, err := ifc.Addrs()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid port: %v\n", err)
-		os.Exit(1)
+		return nil, "", err
+	}
+	var v6 net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			if network != "tcp6" {
+				return ipnet.IP, ifc.Name, nil
+			}
+		} else if v6 == nil {
+			v6 = ipnet.IP
+		}
+	}
+	switch {
+	case network == "tcp4":
+		return nil, "", fmt.Errorf("interface %s has no IPv4 address", ifc.Name)
+	case v6 == nil && network == "tcp6":
+		return nil, "", fmt.Errorf("interface %s has no usable IPv6 address", ifc.Name)
+	case v6 == nil:
+		return nil, "", fmt.Errorf("interface %s has no usable address", ifc.Name)
+	}
+	return v6, ifc.Name, nil
+}
+
+// addrFamily 返回连接对端地址的地址族
+func addrFamily(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP.To4() == nil {
+		return "IPv6"
 	}
+	return "IPv4"
+}
 
-	count := 100
-	if len(os.Args) >= 4 {
-		count, _ = strconv.Atoi(os.Args[3])
+// dialDualStack 以 RFC 8305 的方式竞速：先连第一个地址族，fallbackDelay 后
+// 若仍未成功再并行连另一个地址族，返回最先建立的连接。
+func dialDualStack(addrs []string, port int, timeout time.Duration) (net.Conn, error) {
+	var primary, fallback string
+	for _, a := range addrs {
+		isIPv4 := net.ParseIP(a).To4() != nil
+		switch {
+		case primary == "":
+			primary = a
+		case fallback == "" && isIPv4 != (net.ParseIP(primary).To4() != nil):
+			fallback = a
+		}
+	}
+	if fallback == "" {
+		return net.DialTimeout("tcp", net.JoinHostPort(primary, strconv.Itoa(port)), timeout)
 	}
 
-	fmt.Println("=== TLS Handshake Latency Benchmark ===")
-	fmt.Printf("Host: %s:%d\n", host, port)
-	fmt.Printf("Count: %d\n", count)
-	fmt.Println("TLS Library: Go crypto/tls")
-	fmt.Println()
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results := make(chan dialResult, 2)
+	dial := func(ip string) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		results <- dialResult{conn, err}
+	}
 
-	var tcpDurations []float64
-	var tlsDurations []float64
-	errors := 0
+	go dial(primary)
+	pending := 1
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
 
-	// 预热
-	fmt.Println("Warmup (3 connections)...")
-	for i := 0; i < 3; i++ {
-		tcp, tls, err := measureHandshake(host, port)
-		if err != nil {
-			fmt.Printf("  Warmup %d failed: %v\n", i+1, err)
-		} else {
-			fmt.Printf("  Warmup %d: TCP=%.2fms, TLS=%.2fms\n",
-				i+1,
-				float64(tcp.Microseconds())/1000.0,
-				float64(tls.Microseconds())/1000.0)
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if fallback != "" {
+				go dial(fallback)
+				fallback = ""
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// 关闭竞速失败方的连接
+				go func(n int) {
+					for ; n > 0; n-- {
+						if lr := <-results; lr.conn != nil {
+							lr.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if fallback != "" {
+				// 主地址族失败，立即启动备选地址族
+				go dial(fallback)
+				fallback = ""
+				pending++
+			} else if pending == 0 {
+				return nil, firstErr
+			}
 		}
 	}
-	fmt.Println()
+}
+
+// proxyConfig 是 -socks5 或 -http-proxy 指定的代理，User 为空表示不认证
+type proxyConfig struct {
+	Scheme string // "socks5" 或 "http"
+	Addr   string // host:port
+	User   string
+	Pass   string
+}
+
+// Name 返回报告中使用的代理类型名
+func (p *proxyConfig) Name() string {
+	if p.Scheme == "http" {
+		return "HTTP CONNECT"
+	}
+	return "SOCKS5"
+}
 
-	// 正式测试
-	fmt.Printf("Running %d handshakes...\n", count)
-	testStart := time.Now()
+func (p *proxyConfig) String() string {
+	if p.User != "" {
+		return p.User + "@" + p.Addr
+	}
+	return p.Addr
+}
 
-	for i := 0; i < count; i++ {
-		if (i+1)%10 == 0 || i == 0 {
-			fmt.Printf("\r[%d/%d] ", i+1, count)
+// parseProxy 解析 "host:port" 或 "user:pass@host:port"；密码中可以含有 "@"
+func parseProxy(scheme, s string) (*proxyConfig, error) {
+	p := &proxyConfig{Scheme: scheme, Addr: s}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		userinfo := s[:i]
+		p.Addr = s[i+1:]
+		user, pass, ok := strings.Cut(userinfo, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid proxy credentials %q (want user:pass@host:port)", userinfo)
+		}
+		// RFC 1929：用户名和密码各 1-255 字节；HTTP 的 Basic 认证没有这个限制
+		if scheme == "socks5" && (len(user) > 255 || len(pass) == 0 || len(pass) > 255) {
+			return nil, errors.New("SOCKS5 user and password must each be 1-255 bytes")
 		}
+		p.User, p.Pass = user, pass
+	}
+	if _, err := parseTarget(p.Addr); err != nil {
+		return nil, fmt.Errorf("invalid proxy address: %w", err)
+	}
+	return p, nil
+}
 
-		tcp, tls, err := measureHandshake(host, port)
+// parseChain 解析 -chain 的逗号分隔列表，每项为 socks5://[user:pass@]host:port 或 http://[user:pass@]host:port，
+// 按拨号顺序排列：第一项是本地直接连接的代理
+func parseChain(s string) ([]*proxyConfig, error) {
+	var chain []*proxyConfig
+	for _, item := range splitList(s) {
+		scheme, rest, ok := strings.Cut(item, "://")
+		if !ok || scheme != "socks5" && scheme != "http" {
+			return nil, fmt.Errorf("%q: want socks5://host:port or http://host:port", item)
+		}
+		p, err := parseProxy(scheme, rest)
 		if err != nil {
-			fmt.Printf("\n  Error at %d: %v\n", i+1, err)
-			errors++
-		} else {
-			tcpDurations = append(tcpDurations, float64(tcp.Microseconds())/1000.0)
-			tlsDurations = append(tlsDurations, float64(tls.Microseconds())/1000.0)
+			return nil, fmt.Errorf("%q: %w", item, err)
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no proxies given")
+	}
+	return chain, nil
+}
+
+// chainHop 是 -chain 中一跳 CONNECT 的统计
+type chainHop struct {
+	Scheme  string `json:"scheme"`
+	Addr    string `json:"addr"`
+	Connect *Stats `json:"connect,omitempty"`
+}
+
+// socksReplies 是 RFC 1928 CONNECT 应答码的含义
+var socksReplies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect 在已连到代理的 conn 上完成 RFC 1928 协商（需要时附带 RFC 1929 用户名/密码认证）
+// 并请求 CONNECT host:port。host 为域名时原样交给代理解析，不在本地做 DNS。
+// 只依赖标准库，避免为一个可选功能引入 golang.org/x/net。
+func socks5Connect(conn net.Conn, p *proxyConfig, host string, port int) error {
+	// 1. 方法协商
+	methods := []byte{0x00} // 不认证
+	if p.User != "" {
+		methods = []byte{0x02} // 用户名/密码
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return fmt.Errorf("socks5: write greeting: %w", err)
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("socks5: read method selection: %w", err)
+	}
+	if buf[0] != 0x05 {
+		return fmt.Errorf("socks5: proxy replied with version %d, not a SOCKS5 server", buf[0])
+	}
+	switch buf[1] {
+	case 0x00:
+	case 0x02:
+		// 2. 用户名/密码认证
+		req := []byte{0x01, byte(len(p.User))}
+		req = append(req, p.User...)
+		req = append(req, byte(len(p.Pass)))
+		req = append(req, p.Pass...)
+		if _, err := conn.Write(req); err != nil {
+			return fmt.Errorf("socks5: write credentials: %w", err)
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return fmt.Errorf("socks5: read auth reply: %w", err)
+		}
+		if buf[1] != 0x00 {
+			return errors.New("socks5: proxy rejected the username/password")
+		}
+	case 0xff:
+		if p.User == "" {
+			return errors.New("socks5: proxy requires authentication (use user:pass@host:port)")
 		}
+		return errors.New("socks5: proxy does not accept username/password authentication")
+	default:
+		return fmt.Errorf("socks5: proxy selected unsupported method 0x%02x", buf[1])
+	}
+
+	// 3. CONNECT 请求
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: host name too long: %d bytes", len(host))
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 0x01)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: write CONNECT: %w", err)
+	}
 
-		// 避免被服务器限流
-		time.Sleep(50 * time.Millisecond)
+	// 应答：VER REP RSV ATYP BND.ADDR BND.PORT，地址部分读出后丢弃
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5: read CONNECT reply: %w", err)
+	}
+	if reply[1] != 0x00 {
+		msg, ok := socksReplies[reply[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown reply code %d", reply[1])
+		}
+		return fmt.Errorf("socks5: CONNECT %s failed: %s", net.JoinHostPort(host, strconv.Itoa(port)), msg)
 	}
+	var addrLen int
+	switch reply[3] {
+	case 0x01:
+		addrLen = net.IPv4len
+	case 0x04:
+		addrLen = net.IPv6len
+	case 0x03:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return fmt.Errorf("socks5: read CONNECT reply: %w", err)
+		}
+		addrLen = int(buf[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d in CONNECT reply", reply[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("socks5: read CONNECT reply: %w", err)
+	}
+	return nil
+}
 
-	totalTime := time.Since(testStart)
-	fmt.Printf("\rCompleted in %.1fs\n", totalTime.Seconds())
-	fmt.Println()
+// maxConnectResponse 是 HTTP CONNECT 应答头的长度上限
+const maxConnectResponse = 16 << 10
 
-	if len(tlsDurations) == 0 {
-		fmt.Fprintln(os.Stderr, "No successful handshakes!")
-		return
+// httpConnect 在已连到代理的 conn 上发送 HTTP/1.1 CONNECT host:port 并等待 2xx 应答，
+// 设置了用户名时附带 Basic 认证。应答头逐字节读取：用 bufio 可能把应答之后属于隧道的数据读走。
+func httpConnect(conn net.Conn, p *proxyConfig, host string, port int) error {
+	authority := net.JoinHostPort(host, strconv.Itoa(port))
+	req := "CONNECT " + authority + " HTTP/1.1\r\n" +
+		"Host: " + authority + "\r\n" +
+		"User-Agent: tls_bench_go\r\n"
+	if p.User != "" {
+		req += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(p.User+":"+p.Pass)) + "\r\n"
+	}
+	req += "\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		return fmt.Errorf("http-proxy: write CONNECT: %w", err)
 	}
 
-	// 统计 TCP
-	tcpMin, tcpMax, tcpP50, tcpP90, tcpP99, tcpStdev, tcpMean := calculateStats(tcpDurations)
+	var head []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		if len(head) >= maxConnectResponse {
+			return fmt.Errorf("http-proxy: CONNECT response header exceeds %d bytes", maxConnectResponse)
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return fmt.Errorf("http-proxy: read CONNECT response: %w", err)
+		}
+		head = append(head, b[0])
+	}
 
-	// 统计 TLS
-	tlsMin, tlsMax, tlsP50, tlsP90, tlsP99, tlsStdev, tlsMean := calculateStats(tlsDurations)
+	// 状态行形如 "HTTP/1.1 200 Connection established"
+	line, _, _ := strings.Cut(string(head), "\r\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return fmt.Errorf("http-proxy: malformed status line %q", line)
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("http-proxy: malformed status line %q", line)
+	}
+	switch {
+	case status/100 == 2:
+		return nil
+	case status == 407 && p.User == "":
+		return errors.New("http-proxy: proxy requires authentication (use user:pass@host:port)")
+	case status == 407:
+		return errors.New("http-proxy: proxy rejected the credentials (407)")
+	}
+	return fmt.Errorf("http-proxy: CONNECT %s failed: %s", authority, strings.Join(fields[1:], " "))
+}
 
-	// 总延迟
-	var totalDurations []float64
-	for i := range tcpDurations {
-		totalDurations = append(totalDurations, tcpDurations[i]+tlsDurations[i])
+// verifyChain 执行与 crypto/tls 内置逻辑相同的服务器证书校验：
+// 用 roots（nil 表示系统根证书）校验证书链、用途和 ServerName，返回校验通过的链。
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("tls: server sent no certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
 	}
-	totalMin, totalMax, totalP50, totalP90, totalP99, totalStdev, totalMean := calculateStats(totalDurations)
+	chains, err := cs.PeerCertificates[0].Verify(opts)
+	if err != nil {
+		return nil, &tls.CertificateVerificationError{UnverifiedCertificates: cs.PeerCertificates, Err: err}
+	}
+	return chains, nil
+}
+
+// 以下是 RFC 6960 OCSP 响应中用到的 ASN.1 结构，按 encoding/asn1 的约定声明。
+// 只依赖标准库，不引入 golang.org/x/crypto/ocsp。
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+	Extensions     []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
 
-	fmt.Println("=== Results ===")
-	fmt.Printf("Successful: %d/%d\n", len(tlsDurations), count)
-	fmt.Printf("Errors: %d\n", errors)
-	fmt.Println()
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
 
-	fmt.Println("TCP Connection Latency:")
-	fmt.Printf("  min:   %8.2fms\n", tcpMin)
-	fmt.Printf("  p50:   %8.2fms\n", tcpP50)
-	fmt.Printf("  p90:   %8.2fms\n", tcpP90)
-	fmt.Printf("  p99:   %8.2fms\n", tcpP99)
-	fmt.Printf("  max:   %8.2fms\n", tcpMax)
-	fmt.Printf("  mean:  %8.2fms\n", tcpMean)
-	fmt.Printf("  stdev: %8.2fms\n", tcpStdev)
-	fmt.Println()
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
 
-	fmt.Println("TLS Handshake Latency (Go crypto/tls):")
-	fmt.Printf("  min:   %8.2fms\n", tlsMin)
-	fmt.Printf("  p50:   %8.2fms\n", tlsP50)
-	fmt.Printf("  p90:   %8.2fms\n", tlsP90)
-	fmt.Printf("  p99:   %8.2fms\n", tlsP99)
-	fmt.Printf("  max:   %8.2fms\n", tlsMax)
-	fmt.Printf("  mean:  %8.2fms\n", tlsMean)
-	fmt.Printf("  stdev: %8.2fms\n", tlsStdev)
-	fmt.Printf("  p90→p99 gap: %6.2fms\n", tlsP99-tlsP90)
-	fmt.Println()
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
 
-	fmt.Println("Total (TCP + TLS):")
-	fmt.Printf("  min:   %8.2fms\n", totalMin)
-	fmt.Printf("  p50:   %8.2fms\n", totalP50)
-	fmt.Printf("  p90:   %8.2fms\n", totalP90)
-	fmt.Printf("  p99:   %8.2fms\n", totalP99)
-	fmt.Printf("  max:   %8.2fms\n", totalMax)
-	fmt.Printf("  mean:  %8.2fms\n", totalMean)
-	fmt.Printf("  stdev: %8.2fms\n", totalStdev)
-	fmt.Println()
+// oidOCSPBasic 是 id-pkix-ocsp-basic，唯一常见的响应类型
+var oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
 
-	// 分析
-	fmt.Println("=== Analysis ===")
-	tlsRatio := tlsMean / totalMean * 100.0
-	fmt.Printf("TLS handshake accounts for %.1f%% of total latency\n", tlsRatio)
+// ocspSignatureAlgorithms 把签名算法 OID 映射到 x509 的算法常量（RSA-PSS 不支持）
+var ocspSignatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	"1.3.101.112":           x509.PureEd25519,
+}
 
-	if tlsStdev > 10.0 {
-		fmt.Printf("⚠️  High TLS variance (stdev=%.2fms > 10ms) - handshake time unstable\n", tlsStdev)
-	} else {
-		fmt.Printf("✅ TLS variance is acceptable (stdev=%.2fms)\n", tlsStdev)
+// ocspStaple 是服务器随握手下发（OCSP stapling）的响应中与叶子证书对应的那一条
+type ocspStaple struct {
+	Status     string // "good"、"revoked" 或 "unknown"
+	ThisUpdate time.Time
+	NextUpdate time.Time // 响应未给出时为零值
+	RevokedAt  time.Time
+	// SignatureErr 为 nil 表示响应签名已用签发者（或其授权的 OCSP 签名证书）校验通过
+	SignatureErr error
+}
+
+// parseStaple 解析 DER 编码的 OCSP 响应，找出 leaf 对应的状态并用 issuer 校验签名。
+// issuer 为 nil 时不校验签名。响应格式错误或不含 leaf 的状态时返回错误。
+func parseStaple(der []byte, leaf, issuer *x509.Certificate) (ocspStaple, error) {
+	var resp ocspResponseASN1
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return ocspStaple{}, fmt.Errorf("ocsp: malformed response: %w", err)
+	} else if len(rest) > 0 {
+		return ocspStaple{}, errors.New("ocsp: trailing data after response")
+	}
+	if resp.Status != 0 {
+		return ocspStaple{}, fmt.Errorf("ocsp: responder returned status %d instead of successful", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return ocspStaple{}, fmt.Errorf("ocsp: unsupported response type %s", resp.Response.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return ocspStaple{}, fmt.Errorf("ocsp: malformed basic response: %w", err)
+	}
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return ocspStaple{}, fmt.Errorf("ocsp: malformed response data: %w", err)
+	}
+
+	var single *ocspSingleResponse
+	for i := range data.Responses {
+		if data.Responses[i].CertID.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			single = &data.Responses[i]
+			break
+		}
+	}
+	if single == nil {
+		return ocspStaple{}, errors.New("ocsp: staple has no status for the server certificate")
 	}
 
-	if tlsP99-tlsP90 > 10.0 {
-		fmt.Printf("⚠️  Large p90→p99 gap (%.2fms > 10ms) - occasional slow handshakes\n", tlsP99-tlsP90)
+	staple := ocspStaple{Status: "unknown", ThisUpdate: single.ThisUpdate, NextUpdate: single.NextUpdate}
+	switch {
+	case bool(single.Good):
+		staple.Status = "good"
+	case !single.Revoked.RevocationTime.IsZero():
+		staple.Status = "revoked"
+		staple.RevokedAt = single.Revoked.RevocationTime
+	}
+	if issuer == nil {
+		staple.SignatureErr = errors.New("issuer certificate not available")
 	} else {
-		fmt.Printf("✅ p90→p99 gap is acceptable (%.2fms)\n", tlsP99-tlsP90)
+		staple.SignatureErr = checkOCSPSignature(basic, issuer)
+	}
+	return staple, nil
+}
+
+// checkOCSPSignature 校验响应签名：签名者是签发者本身，或是响应中附带、由签发者签发
+// 且带 OCSPSigning 用途的委托证书。
+func checkOCSPSignature(basic ocspBasicResponse, issuer *x509.Certificate) error {
+	algo, ok := ocspSignatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		cert, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return fmt.Errorf("malformed responder certificate: %w", err)
+		}
+		if !cert.Equal(issuer) {
+			if err := cert.CheckSignatureFrom(issuer); err != nil {
+				return fmt.Errorf("responder certificate not issued by the certificate's issuer: %w", err)
+			}
+			if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+				return errors.New("responder certificate lacks the OCSPSigning usage")
+			}
+			signer = cert
+		}
+	}
+	return signer.CheckSignature(algo, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign())
+}
+
+// checkStaple 在握手中解析并计时 cs 携带的 OCSP staple。staple 签名有效且状态为 revoked 时
+// 返回证书校验错误使握手失败；格式错误的 staple 只记录，不影响握手。
+func checkStaple(cs tls.ConnectionState, issuer *x509.Certificate, res *handshakeResult) error {
+	start := time.Now()
+	staple, err := parseStaple(cs.OCSPResponse, cs.PeerCertificates[0], issuer)
+	res.OCSPVerify = time.Since(start)
+	if err != nil {
+		staple = ocspStaple{Status: "malformed", SignatureErr: err}
+	}
+	res.OCSP = &staple
+	if staple.Status == "revoked" && staple.SignatureErr == nil {
+		return &tls.CertificateVerificationError{
+			UnverifiedCertificates: cs.PeerCertificates,
+			Err: fmt.Errorf("server certificate was revoked at %s according to the stapled OCSP response",
+				staple.RevokedAt.UTC().Format(time.RFC3339)),
+		}
+	}
+	return nil
+}
+
+// httpGet 构造最小的 HTTP/1.1 GET 请求，connection 为 Connection 头的取值
+func httpGet(host string, port int, path, connection string) string {
+	hostHeader := host
+	if port != 443 {
+		hostHeader = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		hostHeader = "[" + host + "]"
+	}
+	return "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + hostHeader + "\r\n" +
+		"User-Agent: tls_bench_go\r\n" +
+		"Accept: */*\r\n" +
+		"Connection: " + connection + "\r\n\r\n"
+}
+
+// measureTTFB 在已握手的连接上发送最小的 HTTP/1.1 GET 请求，返回收到首字节的耗时和状态码。
+// 只读取状态行，响应体（包括 chunked 编码）不解析，连接随后关闭。
+func measureTTFB(conn *tls.Conn, host string, port int, path string) (time.Duration, int, error) {
+	req := httpGet(host, port, path, "close")
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	start := time.Now()
+	if _, err := io.WriteString(conn, req); err != nil {
+		return 0, 0, fmt.Errorf("http: write request: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	if _, err := r.Peek(1); err != nil {
+		return 0, 0, fmt.Errorf("http: no response: %w", err)
 	}
+	ttfb := time.Since(start)
 
-	if tlsP50 > 30.0 {
-		fmt.Printf("⚠️  High p50 (%.2fms > 30ms) - base handshake latency is high\n", tlsP50)
+	// 状态行形如 "HTTP/1.1 200 OK"
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return ttfb, 0, fmt.Errorf("http: read status line: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return ttfb, 0, fmt.Errorf("http: malformed status line %q", strings.TrimSpace(line))
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ttfb, 0, fmt.Errorf("http: malformed status line %q", strings.TrimSpace(line))
+	}
+	return ttfb, status, nil
+}
+
+// measureHandshake 完成一次 DNS 解析 + TCP 连接 + TLS 握手
+func measureHandshake(host string, port int, opts *handshakeOptions) (res handshakeResult, err error) {
+	// Unix 套接字没有 DNS 和 TCP 阶段，连接耗时不计入，直接进入 TLS 握手
+	var conn net.Conn
+	if opts.Unix != "" {
+		conn, err = net.DialTimeout("unix", opts.Unix, opts.ConnectTimeout)
+		if err != nil {
+			return res, err
+		}
+		res.Family = "unix"
+		if opts.Netem != nil {
+			conn = newDelayConn(conn, opts.Netem)
+		}
+	} else if opts.Pool != nil {
+		// 连接在计时开始前就已建立，TLS 阶段只包含握手本身
+		if conn, err = opts.Pool.Get(); err != nil {
+			return res, err
+		}
+		res.Family = addrFamily(conn.RemoteAddr())
+		if opts.Netem != nil {
+			conn = newDelayConn(conn, opts.Netem)
+		}
 	} else {
-		fmt.Printf("✅ p50 is acceptable (%.2fms)\n", tlsP50)
+		// 1. DNS 解析（IP 字面量跳过）；经代理时只解析代理地址，目标由代理解析
+		dialHost, dialPort := host, port
+		if opts.Proxy != nil {
+			t, err := parseTarget(opts.Proxy.Addr)
+			if err != nil {
+				return res, err
+			}
+			dialHost, dialPort = t.Host, t.Port
+		}
+		addrs, dnsDuration, err := resolve(dialHost, opts.Network)
+		res.DNS = dnsDuration
+		if err != nil {
+			return res, err
+		}
+
+		// 2. TCP 连接（经代理时为到代理的连接）
+		tcpStart := time.Now()
+		if opts.DualStack {
+			conn, err = dialDualStack(addrs, dialPort, opts.ConnectTimeout)
+		} else {
+			d := opts.dialer()
+			if opts.TFO {
+				// TFO 下 connect 立即返回，SYN 的往返计入随后的 TLS 阶段
+				d.Control = tfoControl
+			}
+			conn, err = d.Dial(opts.Network, net.JoinHostPort(addrs[0], strconv.Itoa(dialPort)))
+		}
+		if err != nil {
+			if isTimeout(err) {
+				err = fmt.Errorf("TCP connect timed out after %s: %w", opts.ConnectTimeout, err)
+			}
+			return res, err
+		}
+		if opts.Netem != nil {
+			// SYN / SYN-ACK 的往返不经过应用层，直接计入 TCP 阶段；此后的写入（含代理隧道）逐个推迟
+			time.Sleep(opts.Netem.delay())
+			conn = newDelayConn(conn, opts.Netem)
+		}
+		res.TCP = time.Since(tcpStart)
+		res.Family = addrFamily(conn.RemoteAddr())
+		if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			res.RemoteIP = tcp.IP.String()
+		}
+		if tcp, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+			res.LocalIP = tcp.IP.String()
+		}
+
+		if p := opts.Proxy; p != nil {
+			// 隧道建立与 TCP 连接共用连接超时；-chain 时在已建立的隧道里逐跳 CONNECT 到下一跳
+			hops := append([]*proxyConfig{p}, opts.Chain...)
+			proxyStart := time.Now()
+			conn.SetDeadline(proxyStart.Add(opts.ConnectTimeout))
+			for i, hop := range hops {
+				nextHost, nextPort := host, port
+				if i+1 < len(hops) {
+					t, _ := parseTarget(hops[i+1].Addr)
+					nextHost, nextPort = t.Host, t.Port
+				}
+				connect := socks5Connect
+				if hop.Scheme == "http" {
+					connect = httpConnect
+				}
+				hopStart := time.Now()
+				if err = connect(conn, hop, nextHost, nextPort); err != nil {
+					conn.Close()
+					res.Hops = nil
+					if isTimeout(err) {
+						err = fmt.Errorf("%s tunnel timed out after %s: %w", hop.Name(), opts.ConnectTimeout, err)
+					}
+					if len(hops) > 1 {
+						err = fmt.Errorf("chain hop %d (%s %s): %w", i+1, hop.Name(), hop.Addr, err)
+					}
+					return res, &proxyError{err}
+				}
+				if len(hops) > 1 {
+					res.Hops = append(res.Hops, time.Since(hopStart))
+				}
+			}
+			res.Proxy = time.Since(proxyStart)
+			conn.SetDeadline(time.Time{})
+		}
+	}
+	if opts.ConnectOnly {
+		conn.Close()
+		return res, nil
+	}
+
+	// PROXY 头只是一次写入，不单独计时；TFO 下它随 SYN 一起发出
+	if opts.ProxyHeader {
+		src := opts.ProxyHeaderSrc
+		if src == nil {
+			src, _ = conn.LocalAddr().(*net.TCPAddr)
+		}
+		dst, _ := conn.RemoteAddr().(*net.TCPAddr)
+		if _, err := conn.Write(proxyHeaderV2(src, dst)); err != nil {
+			conn.Close()
+			return res, fmt.Errorf("sending PROXY protocol header: %w", err)
+		}
+	}
+
+	// 3. TLS 握手
+	tlsConfig := opts.TLS.Clone()
+	tlsConfig.ServerName = opts.serverName(host)
+	// 只有服务器发送 CertificateRequest 时才会回调，借此判断是否走了 mTLS
+	tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		res.ClientCertRequested = true
+		if len(tlsConfig.Certificates) == 0 {
+			return &tls.Certificate{}, nil
+		}
+		return &tlsConfig.Certificates[0], nil
+	}
+	if !tlsConfig.InsecureSkipVerify {
+		// 关闭内置校验，改为在 VerifyConnection 中计时执行同样完整的证书链校验
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.DidResume {
+				return nil // 会话恢复不重新校验证书链，与内置行为一致
+			}
+			verifyStart := time.Now()
+			chains, err := verifyChain(cs, tlsConfig.RootCAs)
+			res.Verify = time.Since(verifyStart)
+			if err != nil || len(cs.OCSPResponse) == 0 {
+				return err
+			}
+			// 校验通过的链上叶子证书的上一级就是签发者；自签名证书的签发者是它自己
+			issuer := chains[0][0]
+			if len(chains[0]) > 1 {
+				issuer = chains[0][1]
+			}
+			return checkStaple(cs, issuer, &res)
+		}
+	}
+	// 在 VerifyConnection 外层打点；会话恢复时同样会回调
+	var firstRead, verifyStart, verifyEnd time.Time
+	if opts.Phases {
+		inner := tlsConfig.VerifyConnection
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			verifyStart = time.Now()
+			defer func() { verifyEnd = time.Now() }()
+			if inner == nil {
+				return nil
+			}
+			return inner(cs)
+		}
+	}
+
+	tlsStart := time.Now()
+	if opts.HandshakeTimeout > 0 {
+		conn.SetDeadline(tlsStart.Add(opts.HandshakeTimeout))
+	}
+	var tlsTransport net.Conn = conn
+	if opts.HelloSize {
+		tlsTransport = &helloRecorder{Conn: conn, size: &res.ClientHello}
+	}
+	if opts.Phases {
+		tlsTransport = &firstReadConn{Conn: tlsTransport, at: &firstRead}
+	}
+	tlsConn := tls.Client(tlsTransport, tlsConfig)
+	err = tlsConn.Handshake()
+	tlsEnd := time.Now()
+	res.TLS = tlsEnd.Sub(tlsStart)
+	conn.SetDeadline(time.Time{})
+
+	if err != nil {
+		tlsConn.Close()
+		res.TLS = 0
+		if isTimeout(err) {
+			return res, fmt.Errorf("TLS handshake timed out after %s: %w", opts.HandshakeTimeout, err)
+		}
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) && res.Verify == 0 && len(tlsConfig.EncryptedClientHelloConfigList) > 0 {
+			// ECH 被拒绝时 crypto/tls 自己按 ECH 配置中的 public name 校验外层握手，不会调用 VerifyConnection
+			return res, fmt.Errorf("server did not accept ECH (outer handshake failed verification for the ECH public name): %w", err)
+		}
+		// 客户端一侧的版本拒绝没有具体错误类型，固定了版本区间时一律附上区间，便于判断
+		if tlsConfig.MinVersion != 0 || tlsConfig.MaxVersion != 0 {
+			if isVersionMismatch(err) {
+				err = fmt.Errorf("server cannot satisfy pinned TLS version range (%s): %w", versionRange(tlsConfig), err)
+			} else {
+				err = fmt.Errorf("%w (TLS versions pinned to %s)", err, versionRange(tlsConfig))
+			}
+		}
+		return res, &tlsHandshakeError{err}
+	}
+
+	res.State = tlsConn.ConnectionState()
+	res.ECH = res.State.ECHAccepted
+	if opts.Phases && !firstRead.IsZero() && !verifyEnd.IsZero() {
+		res.Phases = &tlsPhases{
+			ServerHello:  firstRead.Sub(tlsStart),
+			ServerFlight: verifyStart.Sub(firstRead),
+			Verify:       verifyEnd.Sub(verifyStart),
+			Finished:     tlsEnd.Sub(verifyEnd),
+		}
+	}
+	if res.OCSP == nil && len(res.State.OCSPResponse) > 0 && !res.State.DidResume {
+		// -insecure：不使握手失败，只报告 staple；签名用服务器发来的第二张证书校验
+		var issuer *x509.Certificate
+		if len(res.State.PeerCertificates) > 1 {
+			issuer = res.State.PeerCertificates[1]
+		}
+		checkStaple(res.State, issuer, &res)
+	}
+	if opts.TFO && tfoSYNData != nil {
+		res.TFO = tfoSYNData(conn)
+	}
+	if n := len(res.State.PeerCertificates); opts.MaxChainDepth > 0 && n > opts.MaxChainDepth {
+		tlsConn.Close()
+		return res, &chainDepthError{n, opts.MaxChainDepth}
+	}
+
+	if opts.KeepOpen {
+		res.Conn = tlsConn
+		return res, nil
+	}
+
+	// 4. HTTP 首字节
+	if opts.HTTPPath != "" {
+		res.TTFB, res.HTTPStatus, err = measureTTFB(tlsConn, tlsConfig.ServerName, port, opts.HTTPPath)
+		tlsConn.Close()
+		if err != nil {
+			return res, &httpError{err}
+		}
+		return res, nil
+	}
+
+	// TLS 1.3 的 session ticket 在握手后才下发，需要读一次才能进入缓存
+	if tlsConfig.ClientSessionCache != nil && res.State.Version == tls.VersionTLS13 {
+		tlsConn.SetReadDeadline(time.Now().Add(ticketWait))
+		tlsConn.Read(make([]byte, 1))
+	}
+	tlsConn.Close()
+
+	return res, nil
+}
+
+// proxyV2Signature 是 PROXY protocol v2 头的固定前 12 字节
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeaderV2 编码 PROXY protocol v2 的 PROXY 命令头（TCP over IPv4/IPv6）。
+// 两端地址族不同时都按 IPv4 映射的 IPv6 地址编码；任一端为 nil 时发送 LOCAL 命令，不携带地址。
+func proxyHeaderV2(src, dst *net.TCPAddr) []byte {
+	b := append([]byte(nil), proxyV2Signature...)
+	if src == nil || dst == nil {
+		return append(b, 0x20, 0x00, 0x00, 0x00) // LOCAL，AF_UNSPEC
+	}
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	family := byte(0x11) // TCP over IPv4
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		family = 0x21 // TCP over IPv6
+	}
+	b = append(b, 0x21, family) // 版本 2，PROXY 命令
+	b = append(b, 0, byte(2*len(srcIP)+4))
+	b = append(b, srcIP...)
+	b = append(b, dstIP...)
+	return append(b, byte(src.Port>>8), byte(src.Port), byte(dst.Port>>8), byte(dst.Port))
+}
+
+// parseIPPort 解析 IP 字面量形式的 ip:port（IPv6 须加方括号），不做 DNS 解析
+func parseIPPort(s string) (*net.TCPAddr, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an IP address", host)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// retryBackoff 是 -retries 第一次重试前的等待时间，之后每次翻倍
+const retryBackoff = 100 * time.Millisecond
+
+// measureWithRetries 在 measure 失败时按指数退避最多重试 retries 次，只返回最后一次的结果，
+// 因此重试过的测量在统计中只算一个样本。证书校验失败和 TLS 协议错误（含服务器的 alert）
+// 每次都会重现，不是瞬时错误，不消耗重试次数。
+func measureWithRetries(retries int, backoff time.Duration, measure func() (handshakeResult, error)) (handshakeResult, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := measure()
+		res.Retries = attempt
+		kind := ""
+		if err != nil {
+			kind = classifyError(err)
+		}
+		if err == nil || attempt == retries || kind == errCert || kind == errChainDepth || kind == errTLSProtocol {
+			if err != nil && attempt > 0 {
+				err = fmt.Errorf("%w (after %d retries)", err, attempt)
+			}
+			return res, err
+		}
+		diag.Debugf("  attempt %d failed (%s), retrying in %s: %v\n", attempt+1, errorKindLabel(kind), backoff<<attempt, err)
+		time.Sleep(backoff << attempt)
+	}
+}
+
+// 握手失败的分类，JSON 中 error_kinds 的键；顺序即报告中的排列顺序
+const (
+	errDNS         = "dns"
+	errTCPTimeout  = "tcp_timeout"
+	errTCPRefused  = "tcp_refused"
+	errTCPConnect  = "tcp_connect"
+	errProxy       = "proxy"
+	errTLSTimeout  = "tls_timeout"
+	errHTTP        = "http"
+	errCert        = "cert"
+	errChainDepth  = "chain_depth"
+	errTLSProtocol = "tls_protocol"
+	errReset       = "reset"
+	errOther       = "other"
+)
+
+var errorKinds = []struct{ kind, label string }{
+	{errDNS, "DNS error"},
+	{errTCPTimeout, "TCP connect timeout"},
+	{errTCPRefused, "TCP connection refused"},
+	{errTCPConnect, "TCP connect error"},
+	{errProxy, "proxy tunnel error"},
+	{errTLSTimeout, "TLS handshake timeout"},
+	{errHTTP, "HTTP request error"},
+	{errCert, "cert verification failure"},
+	{errChainDepth, "chain longer than -max-chain-depth"},
+	{errTLSProtocol, "TLS protocol error"},
+	{errReset, "connection reset/closed"},
+	{errOther, "other error"},
+}
+
+func errorKindLabel(kind string) string {
+	for _, k := range errorKinds {
+		if k.kind == kind {
+			return k.label
+		}
+	}
+	return kind
+}
+
+// proxyError 标记建立代理隧道时的失败，Error() 与原错误相同
+type proxyError struct{ err error }
+
+func (e *proxyError) Error() string { return e.err.Error() }
+func (e *proxyError) Unwrap() error { return e.err }
+
+// tlsHandshakeError 标记 TLS 握手本身的失败（超时除外），Error() 与原错误相同。
+// crypto/tls 的很多握手错误没有具体类型，靠它与连接建立后的其他失败区分开。
+type tlsHandshakeError struct{ err error }
+
+func (e *tlsHandshakeError) Error() string { return e.err.Error() }
+func (e *tlsHandshakeError) Unwrap() error { return e.err }
+
+// httpError 标记 -http 握手后 GET 请求的失败（含读取首字节超时），Error() 与原错误相同
+type httpError struct{ err error }
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+// chainDepthError 表示服务器发送的证书链超过 -max-chain-depth，握手本身是成功的
+type chainDepthError struct{ depth, limit int }
+
+func (e *chainDepthError) Error() string {
+	return fmt.Sprintf("server sent a chain of %d certificates, more than -max-chain-depth %d", e.depth, e.limit)
+}
+
+// classifyError 按 measureHandshake 返回的错误类型判断失败发生在哪个阶段、属于哪一类。
+// 拨号阶段的错误是 Op 为 "dial" 的 *net.OpError；-http 请求的失败由 httpError 标记，
+// 其余超时、RST 都发生在 TLS 握手中。只按类型判断，不匹配错误文本。
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var alert tls.AlertError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr):
+		return errDNS
+	case errors.As(err, new(*proxyError)):
+		return errProxy
+	case errors.As(err, new(*httpError)):
+		return errHTTP
+	case errors.As(err, new(*chainDepthError)):
+		return errChainDepth
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		if opErr.Timeout() {
+			return errTCPTimeout
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return errTCPRefused
+		}
+		return errTCPConnect
+	case isTimeout(err):
+		return errTLSTimeout
+	case errors.As(err, &certErr), errors.As(err, &unknownAuth), errors.As(err, &hostErr), errors.As(err, &invalidCert):
+		return errCert
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errReset
+	case errors.As(err, &alert), errors.As(err, &recordErr), errors.As(err, new(*tlsHandshakeError)):
+		return errTLSProtocol
+	}
+	return errOther
+}
+
+// rejectedCert 从证书校验错误中取出被拒绝的叶子证书，没有时返回 nil
+func rejectedCert(err error) *x509.Certificate {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &certErr) && len(certErr.UnverifiedCertificates) > 0:
+		return certErr.UnverifiedCertificates[0]
+	case errors.As(err, &unknownAuth):
+		return unknownAuth.Cert
+	case errors.As(err, &hostErr):
+		return hostErr.Certificate
+	case errors.As(err, &invalidCert):
+		return invalidCert.Cert
+	}
+	return nil
+}
+
+// printCertDiagnostic 打印 -abort-on-cert-error 的诊断：错误本身、被拒绝证书的主体/签发者/有效期/SAN，
+// 以及按失败原因给出的排查方向
+func printCertDiagnostic(w io.Writer, err error) {
+	fmt.Fprintf(w, "Aborted: certificate verification failed (-abort-on-cert-error): %v\n", err)
+	cert := rejectedCert(err)
+	if cert == nil {
+		return
+	}
+	fmt.Fprintf(w, "  subject: %s\n", cert.Subject)
+	fmt.Fprintf(w, "  issuer:  %s\n", cert.Issuer)
+	fmt.Fprintf(w, "  valid:   %s to %s\n", cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+	if names := append(slices.Clone(cert.DNSNames), ipStrings(cert.IPAddresses)...); len(names) > 0 {
+		fmt.Fprintf(w, "  SANs:    %s\n", strings.Join(names, ", "))
+	}
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuth):
+		fmt.Fprintln(w, "  hint: the issuer is not trusted; pass its CA with -cacert if this is a private CA")
+	case errors.As(err, &hostErr):
+		fmt.Fprintf(w, "  hint: %q is not among the certificate's names; check the target or -sni\n", hostErr.Host)
+	case errors.As(err, &invalidCert) && invalidCert.Reason == x509.Expired:
+		fmt.Fprintln(w, "  hint: the certificate is expired or not yet valid; check the server's certificate and this host's clock")
+	}
+}
+
+// ipStrings 把 IP 列表转成字符串
+func ipStrings(ips []net.IP) []string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
+
+// formatErrorKinds 按 errorKinds 的顺序列出各类失败的次数，如 "5 TCP connect timeout, 2 cert verification failure"
+func formatErrorKinds(counts map[string]int) string {
+	var parts []string
+	for _, k := range errorKinds {
+		if n := counts[k.kind]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, k.label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reuseReport 是 -reuse 模式下在一条 keep-alive 连接上连续发请求的结果
+type reuseReport struct {
+	Path      string  `json:"path"`
+	Handshake float64 `json:"handshake"`           // 建连一次的成本（TCP + 代理 + TLS）
+	Requests  *Stats  `json:"requests,omitempty"`  // 每个请求从发出到读完响应的耗时
+	Amortized float64 `json:"amortized,omitempty"` // (建连 + 全部请求) / 请求数
+	Error     string  `json:"error,omitempty"`     // 建连失败或连接中途不可用时的原因
+}
+
+// reuseRequestTimeout 是 -reuse 单个请求的超时
+const reuseRequestTimeout = 10 * time.Second
+
+// measureReuse 建立一条 TLS 连接，在上面按顺序发出 n 个 keep-alive GET 请求，
+// 把一次性的建连成本和每个请求的往返分开统计。请求之间按 delay 休眠，stop 关闭时提前结束。
+// 服务器关闭连接或返回错误时停止，已完成的请求照常统计。
+func measureReuse(n int, delay time.Duration, stop <-chan struct{}, path string, host string, port int,
+	opts handshakeOptions, rec recorder, out io.Writer) *reuseReport {
+	report := &reuseReport{Path: path}
+	fmt.Fprintf(out, "Running %d keep-alive requests on one connection...\n", n)
+	opts.KeepOpen = true
+	opts.HTTPPath = ""
+	res, err := measureHandshake(host, port, &opts)
+	if err != nil {
+		report.Error = fmt.Sprintf("connect: %v", err)
+		return report
+	}
+	conn := res.Conn
+	defer conn.Close()
+	report.Handshake = millis(res.TCP + res.Proxy + res.TLS)
+	if p := res.State.NegotiatedProtocol; p != "" && p != "http/1.1" {
+		report.Error = fmt.Sprintf("server selected ALPN %q; -reuse speaks HTTP/1.1 (offer -alpn http/1.1)", p)
+		return report
+	}
+
+	req := httpGet(opts.serverName(host), port, path, "keep-alive")
+	r := bufio.NewReader(conn)
+	sum := 0.0
+	for i := 0; i < n && !stopped(stop); i++ {
+		conn.SetDeadline(time.Now().Add(reuseRequestTimeout))
+		start := time.Now()
+		if _, err := io.WriteString(conn, req); err != nil {
+			report.Error = fmt.Sprintf("request %d: write: %v", i+1, err)
+			break
+		}
+		resp, err := http.ReadResponse(r, nil)
+		if err == nil {
+			_, err = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err != nil {
+			report.Error = fmt.Sprintf("request %d: %v", i+1, err)
+			break
+		}
+		d := millis(time.Since(start))
+		rec.Add(d)
+		sum += d
+		if resp.Close {
+			if i+1 < n {
+				report.Error = fmt.Sprintf("server closed the connection after %d requests (HTTP %d)", i+1, resp.StatusCode)
+			}
+			break
+		}
+		if delay > 0 && i+1 < n {
+			select {
+			case <-time.After(delay):
+			case <-stop:
+			}
+		}
+	}
+	if done := rec.Len(); done > 0 {
+		s := rec.Stats()
+		report.Requests = &s
+		report.Amortized = (report.Handshake + sum) / float64(done)
+	}
+	return report
+}
+
+// runPass 运行一轮附加测试（-tfo、-quic、-pq 的对照组），次数/时长与正式测试相同，错误即时打印
+func runPass(plan runPlan, duration time.Duration, name string, out io.Writer, measure func() (handshakeResult, error)) []sample {
+	if duration > 0 {
+		plan.Deadline = time.Now().Add(duration)
+	}
+	fmt.Fprintf(out, "Running %s handshakes...\n", name)
+	samples, _ := runHandshakes(plan, measure, func(done int, s sample) {
+		debugSample(name, s)
+		if s.Err != nil {
+			fmt.Fprintf(out, "  %s error at %d: %v\n", name, s.Index, s.Err)
+		}
+	})
+	return samples
+}
+
+// geoOpen 由 -tags geoip 编译进来的 tls_bench_geoip.go 在 init 中注册，打开 MaxMind 格式的数据库。
+// 默认构建不依赖 MaxMind 读取库，此时为 nil，-geodb 不可用。
+var geoOpen func(path string) (locate geoLocator, closeDB func() error, err error)
+
+// geoLocator 查询一个 IP 的位置；数据库中没有该 IP 时返回零值和 nil
+type geoLocator func(ip net.IP) (geoInfo, error)
+
+// geoInfo 是 -geodb 对一个对端 IP 的标注
+type geoInfo struct {
+	IP         string   `json:"ip"`
+	Handshakes int      `json:"handshakes"`        // 连到该 IP 的成功握手数
+	Country    string   `json:"country,omitempty"` // ISO 3166-1 二字母代码
+	City       string   `json:"city,omitempty"`    // 英文名，Country 库中没有
+	Latitude   float64  `json:"latitude,omitempty"`
+	Longitude  float64  `json:"longitude,omitempty"`
+	DistanceKm *float64 `json:"distance_km,omitempty"` // 与 -geo-origin 的大圆距离
+	MinRTTMs   *float64 `json:"min_rtt_ms,omitempty"`  // 该距离下光纤往返时间的理论下限
+}
+
+// fiberKmPerMs 是光在光纤中的传播速度（约 2/3 光速）
+const fiberKmPerMs = 200.0
+
+// greatCircleKm 用 haversine 公式计算两点（角度制经纬度）间的大圆距离
+func greatCircleKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(lat2-lat1), rad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// parseLatLon 解析 -geo-origin 的 "lat,lon"（角度制）
+func parseLatLon(s string) (lat, lon float64, err error) {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not lat,lon", s)
+	}
+	if lat, err = strconv.ParseFloat(strings.TrimSpace(latStr), 64); err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude %q (want -90..90)", latStr)
+	}
+	if lon, err = strconv.ParseFloat(strings.TrimSpace(lonStr), 64); err != nil || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude %q (want -180..180)", lonStr)
+	}
+	return lat, lon, nil
+}
+
+// annotateGeo 查询 counts（对端 IP → 握手数）中每个 IP 的位置，按握手数从多到少排列。
+// origin 非 nil 时附上距离和光纤往返下限；数据库中没有经纬度的 IP 不计算距离。
+func annotateGeo(locate geoLocator, counts map[string]int, origin *[2]float64) []geoInfo {
+	var infos []geoInfo
+	for ip, n := range counts {
+		info, err := locate(net.ParseIP(ip))
+		if err != nil {
+			info = geoInfo{}
+		}
+		info.IP, info.Handshakes = ip, n
+		if origin != nil && (info.Latitude != 0 || info.Longitude != 0) {
+			km := greatCircleKm(origin[0], origin[1], info.Latitude, info.Longitude)
+			rtt := 2 * km / fiberKmPerMs
+			info.DistanceKm, info.MinRTTMs = &km, &rtt
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Handshakes != infos[j].Handshakes {
+			return infos[i].Handshakes > infos[j].Handshakes
+		}
+		return infos[i].IP < infos[j].IP
+	})
+	return infos
+}
+
+// printGeo 输出一个对端 IP 的位置；有距离时与 TCP p50（约一个往返）对比光纤往返下限
+func printGeo(w io.Writer, g geoInfo, tcpP50 float64) {
+	if g.Country == "" {
+		fmt.Fprintf(w, "Location: %s not found in -geodb\n", g.IP)
+		return
+	}
+	place := g.Country
+	if g.City != "" {
+		place = g.City + ", " + g.Country
+	}
+	fmt.Fprintf(w, "Location: %s in %s", g.IP, place)
+	if g.DistanceKm != nil {
+		fmt.Fprintf(w, ", %.0f km away (light-in-fiber RTT >= %s, TCP p50 %s)", *g.DistanceKm, unit.f(0, *g.MinRTTMs), unit.f(0, tcpP50))
+	}
+	fmt.Fprintln(w)
+}
+
+// quicHandshake 由 -tags quic 编译进来的 tls_bench_quic.go 在 init 中注册。
+// 默认构建不依赖 quic-go，此时为 nil，-quic 不可用。
+var quicHandshake func(host string, port int, opts *handshakeOptions) (handshakeResult, error)
+
+// quicReport 是 -quic 模式下的 QUIC 握手统计
+type quicReport struct {
+	OneRTT          *Stats `json:"one_rtt,omitempty"`  // 无会话缓存，完整 1-RTT 握手
+	ZeroRTT         *Stats `json:"zero_rtt,omitempty"` // 复用 session ticket 尝试 0-RTT，记录连接可用的耗时
+	ZeroRTTAttempts int    `json:"zero_rtt_attempts"`
+	ZeroRTTAccepted int    `json:"zero_rtt_accepted"`
+	Errors          int    `json:"errors"`
+	// EarlyData 是 -early-data 时随握手发送请求的首字节时间
+	EarlyData *earlyDataReport `json:"early_data,omitempty"`
+}
+
+// earlyDataReport 对比请求作为 0-RTT 早期数据发送与在 1-RTT 握手后发送时，从拨号到响应首字节的耗时。
+// 服务器拒绝 0-RTT 时请求在握手完成后重发，这部分样本同样计入 ZeroRTT。
+type earlyDataReport struct {
+	Path     string `json:"path"`
+	OneRTT   *Stats `json:"one_rtt_first_response,omitempty"`
+	ZeroRTT  *Stats `json:"zero_rtt_first_response,omitempty"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+}
+
+// h3ControlPreface 是 HTTP/3 客户端控制流的开头：流类型 0x00 加一个空的 SETTINGS 帧。
+// 不声明 QPACK 动态表，服务器的响应头只能使用静态表和字面量。
+var h3ControlPreface = []byte{0x00, 0x04, 0x00}
+
+// quicVarint 按 RFC 9000 16 节把 v 编码为变长整数追加到 b
+func quicVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// qpackInt 按 RFC 7541 5.1 节把 v 编码为 n 位前缀整数，first 为首字节中前缀之外的高位
+func qpackInt(b []byte, n uint, first byte, v uint64) []byte {
+	limit := uint64(1)<<n - 1
+	if v < limit {
+		return append(b, first|byte(v))
+	}
+	b = append(b, first|byte(limit))
+	for v -= limit; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// h3GetRequest 返回 GET https://authority/path 的 HTTP/3 HEADERS 帧，字段只引用 QPACK 静态表
+// （RFC 9204 附录 A：0 :authority、1 :path /、17 :method GET、23 :scheme https）
+func h3GetRequest(authority, path string) []byte {
+	block := []byte{0x00, 0x00}                   // Required Insert Count = 0，Base = 0
+	block = append(block, 0xc0|17, 0xc0|23)       // 索引字段行：:method GET、:scheme https
+	literal := func(index uint64, value string) { // 引用静态表名称的字面量字段行，值不做 Huffman 编码
+		block = qpackInt(block, 4, 0x50, index)
+		block = qpackInt(block, 7, 0x00, uint64(len(value)))
+		block = append(block, value...)
+	}
+	literal(0, authority)
+	if path == "/" {
+		block = append(block, 0xc0|1)
+	} else {
+		literal(1, path)
+	}
+	frame := quicVarint(nil, 0x01) // HEADERS
+	frame = quicVarint(frame, uint64(len(block)))
+	return append(frame, block...)
+}
+
+// measureQUIC 依次运行 1-RTT 和 0-RTT 两轮 QUIC 握手，每轮的次数/时长与 TCP/TLS 测试相同。
+// 0-RTT 一轮先做一次不计入统计的握手以取得 session ticket。
+func measureQUIC(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *quicReport {
+	report := &quicReport{}
+	var early *earlyDataReport
+	if opts.EarlyData {
+		early = &earlyDataReport{Path: opts.HTTPPath}
+		if early.Path == "" {
+			early.Path = "/"
+		}
+		report.EarlyData = early
+	}
+	var firstResponse []float64
+	pass := func(name string) []float64 {
+		var durations []float64
+		firstResponse = firstResponse[:0]
+		samples := runPass(plan, duration, name, out, func() (handshakeResult, error) {
+			return quicHandshake(host, port, &opts)
+		})
+		for _, s := range samples {
+			if s.Err != nil {
+				report.Errors++
+				continue
+			}
+			durations = append(durations, millis(s.Result.TLS))
+			if early != nil {
+				firstResponse = append(firstResponse, millis(s.Result.FirstResponse))
+			}
+			if opts.TLS.ClientSessionCache != nil {
+				report.ZeroRTTAttempts++
+				if s.Result.ZeroRTT {
+					report.ZeroRTTAccepted++
+				}
+			}
+		}
+		return durations
+	}
+	// earlyStats 返回刚结束的一轮的首字节时间统计
+	earlyStats := func() *Stats {
+		if len(firstResponse) == 0 {
+			return nil
+		}
+		s := calculateStats(firstResponse)
+		return &s
+	}
+
+	opts.TLS = opts.TLS.Clone()
+	opts.TLS.ClientSessionCache = nil
+	if d := pass("QUIC 1-RTT"); len(d) > 0 {
+		s := calculateStats(d)
+		report.OneRTT = &s
+	}
+	if early != nil {
+		early.OneRTT = earlyStats()
+	}
+
+	opts.TLS.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	if _, err := quicHandshake(host, port, &opts); err != nil {
+		fmt.Fprintf(out, "  QUIC ticket priming failed: %v\n", err)
+	}
+	if d := pass("QUIC 0-RTT"); len(d) > 0 {
+		s := calculateStats(d)
+		report.ZeroRTT = &s
+	}
+	if early != nil {
+		early.ZeroRTT = earlyStats()
+		early.Accepted = report.ZeroRTTAccepted
+		early.Rejected = report.ZeroRTTAttempts - report.ZeroRTTAccepted
+	}
+	fmt.Fprintln(out)
+	return report
+}
+
+// pqReport 是 -pq 模式下经典 X25519 对照组的 TLS 握手统计；正式测试本身只提供 X25519MLKEM768
+type pqReport struct {
+	Classical *Stats `json:"classical_tls,omitempty"`
+	Errors    int    `json:"classical_errors"`
+}
+
+// measureClassical 以只含 X25519 的 CurvePreferences 重新运行一轮握手作为 -pq 的对照组
+func measureClassical(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *pqReport {
+	opts.TLS = opts.TLS.Clone()
+	opts.TLS.CurvePreferences = []tls.CurveID{tls.X25519}
+	samples := runPass(plan, duration, "classical X25519", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	fmt.Fprintln(out)
+
+	report := &pqReport{}
+	var durations []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		durations = append(durations, millis(s.Result.TLS))
+	}
+	if len(durations) > 0 {
+		s := calculateStats(durations)
+		report.Classical = &s
+	}
+	return report
+}
+
+// cryptoOnlyReport 是 -handshake-only 的结果：同样的客户端配置对进程内服务器经回环地址握手，
+// 没有网络往返，剩下的是两端 TLS 库的 CPU 开销（含服务器一侧的签名）
+type cryptoOnlyReport struct {
+	TLS         *Stats `json:"tls,omitempty"`
+	Errors      int    `json:"errors"`
+	Certificate string `json:"server_key"` // 进程内服务器证书的密钥类型，如 "RSA-2048"
+}
+
+// measureCryptoOnly 启动进程内 TLS 服务器并对它运行一轮握手，TCP 连接不计入 TLS 阶段。
+// 代理、注入延迟等网络相关的选项全部去掉，TLS 版本、套件、密钥交换组和 ALPN 保持不变。
+func measureCryptoOnly(plan runPlan, duration time.Duration, opts handshakeOptions, out io.Writer) *cryptoOnlyReport {
+	srv := newSelftestServer(opts.TLS.NextProtos)
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	local := handshakeOptions{
+		TLS:              opts.TLS.Clone(),
+		Network:          "tcp",
+		ConnectTimeout:   opts.ConnectTimeout,
+		HandshakeTimeout: opts.HandshakeTimeout,
+	}
+	local.TLS.RootCAs = roots
+	samples := runPass(plan, duration, "crypto-only (loopback)", out, func() (handshakeResult, error) {
+		return measureHandshake("127.0.0.1", port, &local)
+	})
+	fmt.Fprintln(out)
+
+	report := &cryptoOnlyReport{Certificate: keyName(srv.Certificate())}
+	var durations []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		durations = append(durations, millis(s.Result.TLS))
+	}
+	if len(durations) > 0 {
+		s := calculateStats(durations)
+		report.TLS = &s
+	}
+	return report
+}
+
+// keyName 返回证书公钥的类型和长度，如 "RSA-2048"、"ECDSA P-256"
+func keyName(c *x509.Certificate) string {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	}
+	return c.PublicKeyAlgorithm.String()
+}
+
+// netemReport 是 -inject-rtt 的对照结果：正式测试带注入，对照组为不注入时的直连
+type netemReport struct {
+	RTTMs     float64 `json:"rtt_ms"`
+	JitterMs  float64 `json:"jitter_ms"`
+	Rounds    float64 `json:"tls_round_trips"` // 平均每次 TLS 握手的往返数，期望的 TLS 增加量为 Rounds × RTT
+	DirectTCP *Stats  `json:"direct_tcp,omitempty"`
+	DirectTLS *Stats  `json:"direct_tls,omitempty"`
+	Errors    int     `json:"direct_errors"`
+}
+
+// measureDirect 去掉注入重新运行一轮握手，作为 -inject-rtt 的对照组
+func measureDirect(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *netemReport {
+	report := &netemReport{RTTMs: millis(opts.Netem.RTT), JitterMs: millis(opts.Netem.Jitter)}
+	opts.Netem = nil
+	samples := runPass(plan, duration, "direct (no injected latency)", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	fmt.Fprintln(out)
+
+	var tcpTimes, tlsTimes []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		tcpTimes = append(tcpTimes, millis(s.Result.TCP))
+		tlsTimes = append(tlsTimes, millis(s.Result.TLS))
+	}
+	if len(tlsTimes) > 0 {
+		tcp, tls := calculateStats(tcpTimes), calculateStats(tlsTimes)
+		report.DirectTCP, report.DirectTLS = &tcp, &tls
+	}
+	return report
+}
+
+// tlsRoundTrips 返回一次握手的往返数：TLS 1.3 和 TLS 1.2 会话恢复为 1，TLS 1.2 完整握手为 2
+func tlsRoundTrips(state tls.ConnectionState) int {
+	if state.Version >= tls.VersionTLS13 || state.DidResume {
+		return 1
+	}
+	return 2
+}
+
+// decodeECHConfigList 解析 -ech 的取值：base64 编码的 ECHConfigList（HTTPS DNS 记录中 ech= 的值），
+// 或 "@path" 指定的文件，文件内容可以是 base64 文本或原始二进制。
+func decodeECHConfigList(s string) ([]byte, error) {
+	data := []byte(s)
+	if path, ok := strings.CutPrefix(s, "@"); ok {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = b
+	}
+	// ECHConfigList 以 2 字节长度开头，后面是一个或多个 ECHConfig
+	if len(data) < 2 || int(data[0])<<8|int(data[1]) != len(data)-2 || len(data) == 2 {
+		return nil, errors.New("not a valid ECHConfigList (want base64 from the HTTPS record's ech= parameter)")
+	}
+	return data, nil
+}
+
+// echReport 是 -ech 模式下 ECH 的接受情况，以及不带 ECH 的对照组 TLS 握手统计
+type echReport struct {
+	Accepted   int    `json:"accepted"`
+	Successful int    `json:"successful"`
+	Baseline   *Stats `json:"no_ech_tls,omitempty"`
+	Errors     int    `json:"no_ech_errors"`
+}
+
+// measureWithoutECH 去掉 ECHConfigList 重新运行一轮握手作为 -ech 的对照组
+func measureWithoutECH(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) (baseline *Stats, errors int) {
+	opts.TLS = opts.TLS.Clone()
+	opts.TLS.EncryptedClientHelloConfigList = nil
+	samples := runPass(plan, duration, "no-ECH", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	fmt.Fprintln(out)
+
+	var durations []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			errors++
+			continue
+		}
+		durations = append(durations, millis(s.Result.TLS))
+	}
+	if len(durations) > 0 {
+		s := calculateStats(durations)
+		baseline = &s
+	}
+	return baseline, errors
+}
+
+// maxClientHello 是 -client-hello-padding 允许的最大大小，保证 ClientHello 放得进一个 TLS 记录
+const maxClientHello = 16384
+
+// clientHelloLen 从以 TLS 记录开头的数据中读出 ClientHello 握手消息的字节数（含 4 字节消息头，不含记录头）
+func clientHelloLen(b []byte) (int, bool) {
+	if len(b) < 9 || b[0] != 22 || b[5] != 1 { // handshake 记录，client_hello 消息
+		return 0, false
+	}
+	return 4 + (int(b[6])<<16 | int(b[7])<<8 | int(b[8])), true
+}
+
+// helloRecorder 在第一次写入时记录 ClientHello 的大小，其余读写原样转发
+type helloRecorder struct {
+	net.Conn
+	size *int
+}
+
+func (h *helloRecorder) Write(p []byte) (int, error) {
+	if *h.size == 0 {
+		if n, ok := clientHelloLen(p); ok {
+			*h.size = n
+		}
+	}
+	return h.Conn.Write(p)
+}
+
+// firstReadConn 记录第一次读到数据的时刻（-phases），其余读写原样转发
+type firstReadConn struct {
+	net.Conn
+	at *time.Time
+}
+
+func (f *firstReadConn) Read(p []byte) (int, error) {
+	n, err := f.Conn.Read(p)
+	if n > 0 && f.at.IsZero() {
+		*f.at = time.Now()
+	}
+	return n, err
+}
+
+// rng 是程序内所有随机选择（抖动、蓄水池抽样等）共用的随机源，由 -seed 设定种子，
+// 相同输入和种子的单 worker 运行可以复现；多个 worker 并发抽取时顺序取决于调度。
+var (
+	rngSource = &lockedSource{src: rand.NewPCG(0, 0)}
+	rng       = rand.New(rngSource)
+)
+
+// lockedSource 给 rand.Source 加锁，使 rng 可以被多个 worker 同时使用
+type lockedSource struct {
+	mu  sync.Mutex
+	src *rand.PCG
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+// seedRandom 用 seed 重置 rng
+func seedRandom(seed uint64) {
+	rngSource.mu.Lock()
+	defer rngSource.mu.Unlock()
+	rngSource.src.Seed(seed, seed)
+}
+
+// netem 是 -inject-rtt / -inject-jitter 在应用层模拟的链路条件，不需要 root 或 tc
+type netem struct {
+	RTT    time.Duration // 每个往返增加的延迟
+	Jitter time.Duration // 增加量的标准差（正态分布，截断为非负）
+}
+
+// delay 抽取一次往返的增加量
+func (n *netem) delay() time.Duration {
+	d := n.RTT + time.Duration(rng.NormFloat64()*float64(n.Jitter))
+	return max(d, 0)
+}
+
+// delayConn 把每次写入推迟 delay() 后再交给底层连接，写入本身立即返回。
+// 握手中服务器的每轮应答都由客户端的一次写入触发，推迟写入即等于给这一轮增加一个往返；
+// 读取原样转发，所以不会在同一轮的多次读取上重复计入。写入按顺序送出，抖动不会造成乱序。
+type delayConn struct {
+	net.Conn
+	netem *netem
+	queue chan delayedWrite
+
+	mu     sync.Mutex
+	last   time.Time // 上一次写入的送出时刻
+	err    error     // 底层写入的第一个错误，在下一次 Write 时返回
+	closed bool
+}
+
+type delayedWrite struct {
+	due time.Time
+	b   []byte
+}
+
+func newDelayConn(conn net.Conn, n *netem) *delayConn {
+	c := &delayConn{Conn: conn, netem: n, queue: make(chan delayedWrite, 64)}
+	go c.flush()
+	return c
+}
+
+// flush 按时刻依次送出写入；队列关闭后送完剩余的数据再关闭底层连接
+func (c *delayConn) flush() {
+	defer c.Conn.Close()
+	for w := range c.queue {
+		time.Sleep(time.Until(w.due))
+		if _, err := c.Conn.Write(w.b); err != nil {
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *delayConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	due := time.Now().Add(c.netem.delay())
+	if due.Before(c.last) {
+		due = c.last
+	}
+	c.last = due
+	c.queue <- delayedWrite{due, bytes.Clone(p)}
+	return len(p), nil
+}
+
+// Close 不等待尚未送出的写入（如 close_notify），底层连接在送完后由 flush 关闭
+func (c *delayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	return nil
+}
+
+// clientHelloSize 在内存管道上让 crypto/tls 按 cfg 生成一次 ClientHello（不联网），返回其大小
+func clientHelloSize(cfg *tls.Config) (int, error) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	go tls.Client(c, cfg).Handshake() // 管道关闭后返回
+	header := make([]byte, 9)
+	s.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(s, header); err != nil {
+		return 0, err
+	}
+	n, ok := clientHelloLen(header)
+	if !ok {
+		return 0, errors.New("first record is not a ClientHello")
+	}
+	return n, nil
+}
+
+// alpnPadding 返回恰好占用 n 字节 ALPN 协议列表的填充名称（每个名称占 1 字节长度加名称本身）。
+// n 为 1 时无法编码，返回 nil。
+func alpnPadding(n int) []string {
+	var names []string
+	for n >= 2 {
+		l := min(n-1, 255)
+		if n-(l+1) == 1 {
+			l-- // 避免剩下无法编码的 1 字节
+		}
+		names = append(names, string(rune('a'+len(names)%26))+strings.Repeat("x", l-1))
+		n -= l + 1
+	}
+	return names
+}
+
+// padClientHello 在 cfg.NextProtos 末尾追加虚拟协议名，把 ClientHello 撑到 size 字节。
+// crypto/tls 不支持 RFC 7685 padding 扩展，ALPN 是唯一可以任意加长且不影响协商的字段。
+// 返回填充前后的大小和真实的协议列表（对照组使用）；本来就不小于 size 时不做填充。
+func padClientHello(cfg *tls.Config, size int) (unpadded, padded int, protos []string, err error) {
+	protos = cfg.NextProtos
+	if unpadded, err = clientHelloSize(cfg); err != nil || unpadded >= size {
+		return unpadded, unpadded, protos, err
+	}
+	if len(protos) == 0 {
+		// 只提供不认识的协议名时服务器可以用 no_application_protocol 拒绝握手（crypto/tls 会这样做），带上 http/1.1 兜底
+		protos = []string{"http/1.1"}
+		cfg.NextProtos = protos
+	}
+	base, err := clientHelloSize(cfg)
+	if err != nil {
+		return unpadded, 0, protos, err
+	}
+	cfg.NextProtos = append(slices.Clip(protos), alpnPadding(size-base)...)
+	padded, err = clientHelloSize(cfg)
+	return unpadded, padded, protos, err
+}
+
+// paddingReport 是 -client-hello-padding 的结果：主测试使用填充后的 ClientHello，对照组不填充
+type paddingReport struct {
+	TargetSize   int `json:"target_size"`   // 请求的 ClientHello 大小（字节）
+	UnpaddedSize int `json:"unpadded_size"` // 不填充时的大小
+	// 主测试中实际发送的大小范围；会话恢复等会使大小变化
+	MinSize    int `json:"min_size"`
+	MaxSize    int `json:"max_size"`
+	Handshakes int `json:"handshakes"` // 主测试的测量次数，与 Successful 一起给出成功率
+	Successful int `json:"successful"`
+
+	Unpadded           *Stats `json:"unpadded_tls,omitempty"`
+	UnpaddedHandshakes int    `json:"unpadded_handshakes"`
+	UnpaddedSuccessful int    `json:"unpadded_successful"`
+}
+
+// measureUnpadded 用真实的协议列表重新运行一轮握手作为 -client-hello-padding 的对照组
+func measureUnpadded(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, protos []string, report *paddingReport, out io.Writer) {
+	opts.TLS = opts.TLS.Clone()
+	opts.TLS.NextProtos = protos
+	opts.HelloSize = false
+	samples := runPass(plan, duration, "unpadded", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	fmt.Fprintln(out)
+
+	var durations []float64
+	for _, s := range samples {
+		report.UnpaddedHandshakes++
+		if s.Err == nil {
+			report.UnpaddedSuccessful++
+			durations = append(durations, millis(s.Result.TLS))
+		}
+	}
+	if len(durations) > 0 {
+		s := calculateStats(durations)
+		report.Unpadded = &s
+	}
+}
+
+// tfoReport 是 -tfo 模式下 TCP Fast Open 连接的统计
+type tfoReport struct {
+	// Total 是 TCP 连接 + TLS 握手的总耗时：TFO 下 connect 立即返回，单看 TCP 阶段没有意义
+	Total           *Stats `json:"total,omitempty"`
+	SYNDataAccepted int    `json:"syn_data_accepted"`
+	Successful      int    `json:"successful"`
+	Errors          int    `json:"errors"`
+}
+
+// measureTFO 以 TCP Fast Open 重新运行一轮握手，次数/时长与普通测试相同。
+// 第一次连接通常只能拿到 TFO cookie，因此先做一次不计入统计的握手。
+func measureTFO(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *tfoReport {
+	opts.TFO = true
+	if _, err := measureHandshake(host, port, &opts); err != nil {
+		fmt.Fprintf(out, "  TFO cookie priming failed: %v\n", err)
+	}
+
+	samples := runPass(plan, duration, "TFO", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	fmt.Fprintln(out)
+
+	report := &tfoReport{}
+	var totals []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		report.Successful++
+		totals = append(totals, millis(s.Result.TCP+s.Result.TLS))
+		if s.Result.TFO {
+			report.SYNDataAccepted++
+		}
+	}
+	if len(totals) > 0 {
+		s := calculateStats(totals)
+		report.Total = &s
+	}
+	return report
+}
+
+// predialMaxPool 是 -predial 连接池的上限；-duration 时池按此大小建立并在后台补充
+const predialMaxPool = 64
+
+// predialReport 是 -predial 的结果：在预先建立的 TCP 连接上只计时 TLS 握手
+type predialReport struct {
+	TLS        *Stats `json:"tls,omitempty"`
+	PoolSize   int    `json:"pool_size"` // 计时开始前建立的连接数
+	Successful int    `json:"successful"`
+	Errors     int    `json:"errors"`
+}
+
+// pooledConn 是连接池中的一项，拨号失败时 err 非 nil，由取到它的那次握手报告
+type pooledConn struct {
+	conn net.Conn
+	err  error
+}
+
+// connPool 预先拨好一批 TCP 连接，取走一个就在后台补拨一个，
+// 使握手计时不包含 TCP 建连，也不需要等待建连。
+type connPool struct {
+	conns chan pooledConn
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// newConnPool 同步拨好 size 个连接后返回，之后由后台 goroutine 补充
+func newConnPool(size int, dial func() (net.Conn, error)) *connPool {
+	p := &connPool{conns: make(chan pooledConn, size), done: make(chan struct{})}
+	for range size {
+		conn, err := dial()
+		p.conns <- pooledConn{conn, err}
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			conn, err := dial()
+			select {
+			case p.conns <- pooledConn{conn, err}:
+			case <-p.done:
+				if conn != nil {
+					conn.Close()
+				}
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Get 取出最早拨好的连接；池空时等待后台补拨
+func (p *connPool) Get() (net.Conn, error) {
+	pc := <-p.conns
+	return pc.conn, pc.err
+}
+
+// Close 停止补拨并关闭池中剩余的连接
+func (p *connPool) Close() {
+	close(p.done)
+	p.wg.Wait()
+	for {
+		select {
+		case pc := <-p.conns:
+			if pc.conn != nil {
+				pc.conn.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// measurePredial 把 TCP 连接预先建立到池中，再运行一轮只计时 TLS 握手的测试，次数/时长与普通测试相同。
+// 排除了每次建连的网络抖动，便于单独比较 TLS 实现（如 Go 与 Rust）的密码学开销。
+func measurePredial(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *predialReport {
+	report := &predialReport{PoolSize: predialMaxPool}
+	if duration == 0 {
+		report.PoolSize = min(plan.Count, predialMaxPool)
+	}
+	report.PoolSize = max(report.PoolSize, plan.Concurrency)
+
+	addrs, _, err := resolve(host, opts.Network)
+	if err != nil {
+		fmt.Fprintf(out, "  pre-dial failed: %v\n", err)
+		return report
+	}
+	addr := net.JoinHostPort(addrs[0], strconv.Itoa(port))
+	dial := func() (net.Conn, error) {
+		d := opts.dialer()
+		return d.Dial(opts.Network, addr)
+	}
+	fmt.Fprintf(out, "Pre-dialing %d TCP connections to %s...\n", report.PoolSize, addr)
+	opts.Pool = newConnPool(report.PoolSize, dial)
+	samples := runPass(plan, duration, "TLS-only (pre-dialed)", out, func() (handshakeResult, error) {
+		return measureHandshake(host, port, &opts)
+	})
+	opts.Pool.Close()
+	fmt.Fprintln(out)
+
+	var durations []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		report.Successful++
+		durations = append(durations, millis(s.Result.TLS))
+	}
+	if len(durations) > 0 {
+		s := calculateStats(durations)
+		report.TLS = &s
+	}
+	return report
+}
+
+// pairedReport 是 -paired 的结果：每次迭代先单独建立并关闭一条 TCP 连接，紧接着完成一次 TCP + TLS，
+// 两者之差即该次的 TLS 开销。相邻两次连接经历相近的网络状态，配对差值抵消了逐次的网络波动。
+type pairedReport struct {
+	TCPOnly  *Stats `json:"tcp_only,omitempty"`
+	Overhead *Stats `json:"overhead,omitempty"` // (TCP + TLS) − TCP-only，可能为负
+	Pairs    int    `json:"pairs"`
+	Errors   int    `json:"errors"`
+}
+
+// tcpConnect 只建立一条 TCP 连接并立即关闭，返回连接耗时（不含 DNS）
+func tcpConnect(host string, port int, opts *handshakeOptions) (time.Duration, error) {
+	addrs, _, err := resolve(host, opts.Network)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	var conn net.Conn
+	if opts.DualStack {
+		conn, err = dialDualStack(addrs, port, opts.ConnectTimeout)
+	} else {
+		d := opts.dialer()
+		conn, err = d.Dial(opts.Network, net.JoinHostPort(addrs[0], strconv.Itoa(port)))
+	}
+	if err != nil {
+		return 0, err
+	}
+	if opts.Netem != nil {
+		time.Sleep(opts.Netem.delay()) // 与 measureHandshake 的 TCP 阶段一致
+	}
+	d := time.Since(start)
+	conn.Close()
+	return d, nil
+}
+
+// measurePaired 逐次交替运行 TCP-only 连接和完整握手，报告配对差值的分布
+func measurePaired(plan runPlan, duration time.Duration, host string, port int, opts handshakeOptions, out io.Writer) *pairedReport {
+	samples := runPass(plan, duration, "paired TCP-only + TCP/TLS", out, func() (handshakeResult, error) {
+		tcp, err := tcpConnect(host, port, &opts)
+		if err != nil {
+			return handshakeResult{}, fmt.Errorf("TCP-only connect: %w", err)
+		}
+		res, err := measureHandshake(host, port, &opts)
+		res.PairedTCP = tcp
+		return res, err
+	})
+	fmt.Fprintln(out)
+
+	report := &pairedReport{}
+	var tcpOnly, overhead []float64
+	for _, s := range samples {
+		if s.Err != nil {
+			report.Errors++
+			continue
+		}
+		tcpOnly = append(tcpOnly, millis(s.Result.PairedTCP))
+		overhead = append(overhead, millis(s.Result.TCP+s.Result.TLS)-millis(s.Result.PairedTCP))
+	}
+	if report.Pairs = len(overhead); report.Pairs > 0 {
+		t, o := calculateStats(tcpOnly), calculateStats(overhead)
+		report.TCPOnly, report.Overhead = &t, &o
+	}
+	return report
+}
+
+// sample 是一次正式握手的记录
+type sample struct {
+	Index  int // 发起顺序，从 1 开始
+	Worker int
+	Start  time.Time
+	// Elapsed 是 measure 本身的耗时（含重试，不含 worker 之间的休眠）
+	Elapsed time.Duration
+	Result  handshakeResult
+	Err     error
+}
+
+// runPlan 描述正式测试的规模
+type runPlan struct {
+	Count       int              // 测量次数；Deadline 非零时忽略
+	Deadline    time.Time        // 非零时持续测量直到该时刻
+	Concurrency int              // 并行 worker 数
+	Delay       time.Duration    // 每个 worker 两次测量之间的休眠
+	Stop        <-chan struct{}  // 关闭后不再发起新的测量，进行中的测量照常完成
+	Discard     bool             // 不保留样本，只交给 onDone（-hdr 长时间运行时内存不随次数增长）
+	FailFast    int              // 按完成顺序连续失败达到该次数后不再发起新的测量；0 表示不限制
+	StopOn      func(error) bool // 非 nil 且对某次失败返回 true 时不再发起新的测量（-abort-on-cert-error）
+}
+
+// runAbort 说明 runHandshakes 为何提前结束；Err 为 nil 表示没有因失败而中止（正常结束或 Stop 关闭）
+type runAbort struct {
+	Err    error // 触发中止的那次失败
+	StopOn bool  // true 为 StopOn 命中，否则为连续失败达到 FailFast
+}
+
+// runHandshakes 按 plan 用多个 worker 并行测量。每个 worker 在发起新测量前检查
+// 共享的次数或截止时间，测量后休眠 plan.Delay。
+// Stop 关闭、连续失败达到 FailFast 或 StopOn 命中后 worker 不再发起新测量，休眠也立即结束；返回前等待所有进行中的测量完成。
+// onDone 在每次测量完成后被串行调用，done 为已完成的次数。
+// 返回的样本按发起顺序排列，Discard 时为 nil；abort 说明是否以及为何因失败中止。
+func runHandshakes(plan runPlan, measure func() (handshakeResult, error), onDone func(done int, s sample)) (samples []sample, abort runAbort) {
+	var (
+		mu     sync.Mutex
+		next   int
+		done   int
+		streak int // 连续失败次数
+		wg     sync.WaitGroup
+	)
+	// FailFast 或 StopOn 触发时关闭 aborted，与 Stop 一样中断休眠
+	aborted := make(chan struct{})
+	for w := 0; w < plan.Concurrency; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if plan.Deadline.IsZero() && next >= plan.Count ||
+					!plan.Deadline.IsZero() && !time.Now().Before(plan.Deadline) ||
+					stopped(plan.Stop) || stopped(aborted) {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				mu.Unlock()
+
+				start := time.Now()
+				res, err := measure()
+				s := sample{Index: i + 1, Worker: worker, Start: start, Elapsed: time.Since(start), Result: res, Err: err}
+
+				mu.Lock()
+				done++
+				if !plan.Discard {
+					samples = append(samples, s)
+				}
+				if err != nil {
+					streak++
+				} else {
+					streak = 0
+				}
+				if err != nil && !stopped(aborted) {
+					if plan.StopOn != nil && plan.StopOn(err) {
+						abort = runAbort{Err: err, StopOn: true}
+						close(aborted)
+					} else if plan.FailFast > 0 && streak >= plan.FailFast {
+						abort = runAbort{Err: err}
+						close(aborted)
+					}
+				}
+				if onDone != nil {
+					onDone(done, s)
+				}
+				mu.Unlock()
+
+				if plan.Delay > 0 {
+					select {
+					case <-time.After(plan.Delay):
+					case <-plan.Stop:
+					case <-aborted:
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Index < samples[j].Index })
+	return samples, abort
+}
+
+// stopped 判断 stop 是否已关闭；nil 表示永不停止
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// throughputReport 是成功握手的速率（次/秒）
+type throughputReport struct {
+	// WithDelay 按墙钟时间计算，包含 -delay 休眠
+	WithDelay float64 `json:"with_delay"`
+	// WithoutDelay 按每个 worker 实际测量的平均时间计算，扣除 -delay 休眠，反映真实容量
+	WithoutDelay float64 `json:"without_delay"`
+}
+
+// throughput 计算成功握手的速率。wall 为整轮测试的墙钟时间，
+// 扣除休眠时以所有样本的 Elapsed 之和除以 worker 数作为有效时间。
+func throughput(samples []sample, wall time.Duration, concurrency int) throughputReport {
+	successful := 0
+	var busy time.Duration
+	for _, s := range samples {
+		busy += s.Elapsed
+		if s.Err == nil {
+			successful++
+		}
+	}
+	return throughputFrom(successful, busy, wall, concurrency)
+}
+
+// processCPU 返回进程累计的用户态和内核态 CPU 时间，由 tls_bench_cpu_unix.go 在 init 中注册；
+// 未编译进来时为 nil，不报告 CPU 时间。
+var processCPU func() (user, sys time.Duration)
+
+// cpuReport 是正式测试期间整个进程消耗的 CPU 时间，与网络等待无关，
+// 包含进程内的所有工作（统计汇总、GC，以及 -selftest 时服务器一侧的握手）
+type cpuReport struct {
+	UserMs float64 `json:"user_ms"`
+	SysMs  float64 `json:"sys_ms"`
+	// PerHandshakeMs 是 (user + sys) / 成功握手数
+	PerHandshakeMs float64 `json:"per_handshake_ms"`
+	// Utilization 是 (user + sys) / 墙钟时间的百分比，100% 相当于占满一个核
+	Utilization float64 `json:"utilization_percent"`
+}
+
+// cpuFrom 由测试前后两次 processCPU 的读数计算 cpuReport；没有成功握手时 PerHandshakeMs 为 0
+func cpuFrom(user0, sys0, user1, sys1 time.Duration, successful int, wall time.Duration) *cpuReport {
+	r := &cpuReport{UserMs: millis(user1 - user0), SysMs: millis(sys1 - sys0)}
+	total := r.UserMs + r.SysMs
+	if successful > 0 {
+		r.PerHandshakeMs = total / float64(successful)
+	}
+	if wall > 0 {
+		r.Utilization = total / millis(wall) * 100
+	}
+	return r
+}
+
+// openKeyLog 以追加方式打开 -keylog 文件，不存在时以 0600 创建（内容是会话密钥）
+func openKeyLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+}
+
+// memReport 是正式测试期间 Go 运行时的堆分配（runtime.MemStats 的差值），
+// 与 CPU 时间一样包含进程内的统计汇总等工作，不只是 crypto/tls
+type memReport struct {
+	Allocs             uint64  `json:"allocs"`
+	Bytes              uint64  `json:"bytes"`
+	AllocsPerHandshake float64 `json:"allocs_per_handshake"`
+	BytesPerHandshake  float64 `json:"bytes_per_handshake"`
+	GCCycles           uint32  `json:"gc_cycles"`
+}
+
+// memFrom 由测试前后的 MemStats 计算 memReport；没有成功握手时每次握手的值为 0
+func memFrom(before, after *runtime.MemStats, successful int) *memReport {
+	r := &memReport{
+		Allocs:   after.Mallocs - before.Mallocs,
+		Bytes:    after.TotalAlloc - before.TotalAlloc,
+		GCCycles: after.NumGC - before.NumGC,
+	}
+	if successful > 0 {
+		r.AllocsPerHandshake = float64(r.Allocs) / float64(successful)
+		r.BytesPerHandshake = float64(r.Bytes) / float64(successful)
+	}
+	return r
+}
+
+// formatBytes 以 B / KiB / MiB 输出字节数
+func formatBytes(b float64) string {
+	switch {
+	case b >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", b/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", b/(1<<10))
+	}
+	return fmt.Sprintf("%.0f B", b)
+}
+
+// writeMemProfile 先做一次 GC 使统计完整，再把整个进程的分配剖析（pprof allocs）写到 path
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// throughputFrom 与 throughput 相同，但直接使用已累计的成功次数和 Elapsed 之和
+func throughputFrom(successful int, busy, wall time.Duration, concurrency int) throughputReport {
+	var t throughputReport
+	if wall > 0 {
+		t.WithDelay = float64(successful) / wall.Seconds()
+	}
+	if active := busy.Seconds() / float64(concurrency); active > 0 {
+		t.WithoutDelay = float64(successful) / active
+	}
+	return t
+}
+
+// negotiated 是握手协商出的参数
+type negotiated struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ALPN        string `json:"alpn,omitempty"`
+}
+
+func negotiatedFrom(state tls.ConnectionState) negotiated {
+	return negotiated{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+}
+
+func (n negotiated) String() string {
+	s := n.Version + ", " + n.CipherSuite
+	if n.ALPN != "" {
+		s += ", ALPN=" + n.ALPN
+	}
+	return s
+}
+
+// certExpiryWarn 是证书剩余有效期的告警线
+const certExpiryWarn = 30 * 24 * time.Hour
+
+// certInfo 是第一次成功握手时服务器叶子证书的摘要
+type certInfo struct {
+	Subject    string    `json:"subject"`
+	Issuer     string    `json:"issuer"`
+	NotAfter   time.Time `json:"not_after"`
+	DaysLeft   int       `json:"days_left"`
+	ChainDepth int       `json:"chain_depth"` // 服务器发送的证书数量
+	// Fingerprint 是叶子证书 DER 的 SHA-256（十六进制），用于判断不同 SNI 是否拿到同一张证书
+	Fingerprint string `json:"fingerprint_sha256"`
+}
+
+// certInfoFrom 从握手结果中提取叶子证书信息，服务器未发送证书（如会话恢复）时返回 nil
+func certInfoFrom(state tls.ConnectionState, now time.Time) *certInfo {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	return &certInfo{
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		NotAfter:    leaf.NotAfter,
+		DaysLeft:    int(leaf.NotAfter.Sub(now).Hours() / 24),
+		ChainDepth:  len(state.PeerCertificates),
+		Fingerprint: fmt.Sprintf("%x", sha256.Sum256(leaf.Raw)),
+	}
+}
+
+// ocspReport 汇总完整握手（非会话恢复）中服务器 stapling 的 OCSP 响应
+type ocspReport struct {
+	FullHandshakes int            `json:"full_handshakes"`
+	Stapled        int            `json:"stapled"`
+	Status         map[string]int `json:"status,omitempty"` // good / revoked / unknown / malformed
+	// Unverified 是签名无法校验的 staple 数，SignatureError 是其中第一个的原因
+	Unverified     int        `json:"unverified,omitempty"`
+	SignatureError string     `json:"signature_error,omitempty"`
+	ThisUpdate     *time.Time `json:"this_update,omitempty"` // 第一个 staple 的时间
+	NextUpdate     *time.Time `json:"next_update,omitempty"`
+	Verify         *Stats     `json:"verify,omitempty"` // 解析并校验 staple 的耗时
+}
+
+// Stats 是一组延迟样本的汇总统计（单位 ms）
+type Stats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"` // Count < p999MinSamples 时等于 Max
+	Mean  float64 `json:"mean"`
+	Stdev float64 `json:"stdev"`
+	// 稳健统计量，对少数离群值不敏感
+	TrimmedMean float64 `json:"trimmed_mean"` // 两端各去掉 10% 后的均值
+	MAD         float64 `json:"mad"`          // 中位数绝对偏差 median(|x - p50|)
+	// 跨量级比较用：几何均值对乘性离散不敏感，变异系数 stdev/mean 无单位
+	GeoMean float64 `json:"geo_mean"` // 存在非正值时为 0
+	CV      float64 `json:"cv"`
+	// 分布形状（总体矩）：偏度 > 0 表示右尾更长，超额峰度 > 0 表示尾部比正态分布更重；stdev 为 0 时均为 0
+	Skewness float64 `json:"skewness"`
+	Kurtosis float64 `json:"excess_kurtosis"`
+}
+
+// statsProblems 检查统计量的内在一致性：min ≤ p50 ≤ p90 ≤ p95 ≤ p99 ≤ p99.9 ≤ max，
+// 均值和截尾均值落在 [min, max] 内，离散度非负。返回每条违反的说明，空 Stats 不检查。
+func statsProblems(name string, s Stats) []string {
+	if s.Count == 0 {
+		return nil
+	}
+	const eps = 1e-9
+	var problems []string
+	order := []struct {
+		name string
+		v    float64
+	}{{"min", s.Min}, {"p50", s.P50}, {"p90", s.P90}, {"p95", s.P95}, {"p99", s.P99}, {"p99.9", s.P999}, {"max", s.Max}}
+	for i := 1; i < len(order); i++ {
+		if a, b := order[i-1], order[i]; a.v > b.v+eps {
+			problems = append(problems, fmt.Sprintf("%s: %s %g > %s %g", name, a.name, a.v, b.name, b.v))
+		}
+	}
+	for _, m := range []struct {
+		name string
+		v    float64
+	}{{"mean", s.Mean}, {"trimmed mean", s.TrimmedMean}} {
+		if m.v < s.Min-eps || m.v > s.Max+eps {
+			problems = append(problems, fmt.Sprintf("%s: %s %g outside [%g, %g]", name, m.name, m.v, s.Min, s.Max))
+		}
+	}
+	if s.Stdev < 0 || s.MAD < 0 || math.IsNaN(s.Stdev) {
+		problems = append(problems, fmt.Sprintf("%s: negative or NaN spread (stdev %g, MAD %g)", name, s.Stdev, s.MAD))
+	}
+	return problems
+}
+
+// trimFraction 是截尾均值在两端各去掉的样本比例
+const trimFraction = 0.10
+
+// percentile 返回已升序排列的 sorted 的 q 分位数（q ∈ [0, 1]）：相邻秩线性插值（R-7 / NumPy 默认方法），
+// q = 0 为最小值，q = 1 为最大值，超出范围的 q 按端点处理；空输入返回 NaN。不检查输入是否有序。
+func percentile(sorted []float64, q float64) float64 {
+	n := len(sorted)
+	switch {
+	case n == 0:
+		return math.NaN()
+	case n == 1 || q <= 0:
+		return sorted[0]
+	}
+	h := q * float64(n-1)
+	lo := int(math.Floor(h))
+	if lo >= n-1 {
+		return sorted[n-1]
+	}
+	return sorted[lo] + (h-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// calculateStats 计算 durations 的统计量；空输入返回 Count 为 0 的零值。
+// 在副本上排序，调用方的切片保持采集顺序。
+func calculateStats(samples []float64) Stats {
+	n := len(samples)
+	if n == 0 {
+		return Stats{}
+	}
+	durations := append([]float64(nil), samples...)
+	sort.Float64s(durations)
+
+	var acc welford
+	for _, d := range durations {
+		acc.Add(d)
+	}
+	mean := acc.Mean
+
+	s := Stats{
+		Count: n,
+		Min:   durations[0],
+		Max:   durations[n-1],
+		P50:   percentile(durations, 0.50),
+		P90:   percentile(durations, 0.90),
+		P95:   percentile(durations, 0.95),
+		P99:   percentile(durations, 0.99),
+		Mean:  mean,
+	}
+	// 样本不足 1000 时 p99.9 无统计意义，直接取 max
+	if n >= p999MinSamples {
+		s.P999 = percentile(durations, 0.999)
+	} else {
+		s.P999 = s.Max
+	}
+
+	s.Stdev = math.Sqrt(acc.Variance())
+
+	s.TrimmedMean = trimmedMean(durations, trimFraction)
+	s.MAD = medianAbsDeviation(durations, s.P50)
+	s.GeoMean = geometricMean(durations)
+	if mean > 0 {
+		s.CV = s.Stdev / mean
+	}
+	s.Skewness, s.Kurtosis = shapeMoments(durations, mean, s.Stdev)
+
+	return s
+}
+
+// welford 用 Welford 在线算法单次遍历累计均值和方差，数值上比先求和再求平方差稳定，
+// 也不需要保留全部样本。
+type welford struct {
+	N    int
+	Mean float64
+	M2   float64 // 与当前均值之差的平方和
+}
+
+// Add 加入一个样本
+func (w *welford) Add(x float64) {
+	w.N++
+	delta := x - w.Mean
+	w.Mean += delta / float64(w.N)
+	w.M2 += delta * (x - w.Mean)
+}
+
+// Variance 返回总体方差（除以 N），没有样本时为 0
+func (w *welford) Variance() float64 {
+	if w.N == 0 {
+		return 0
+	}
+	return w.M2 / float64(w.N)
+}
+
+// geometricMean 返回 exp(mean(ln x))；对数在 0 处无定义，存在非正值时返回 0
+func geometricMean(samples []float64) float64 {
+	sum := 0.0
+	for _, d := range samples {
+		if d <= 0 {
+			return 0
+		}
+		sum += math.Log(d)
+	}
+	return math.Exp(sum / float64(len(samples)))
+}
+
+// shapeMoments 用已算出的均值和标准差再遍历一次，返回偏度 E[(x-μ)³]/σ³ 和超额峰度 E[(x-μ)⁴]/σ⁴ - 3
+func shapeMoments(samples []float64, mean, stdev float64) (skew, kurt float64) {
+	if stdev == 0 {
+		return 0, 0
+	}
+	var m3, m4 float64
+	for _, d := range samples {
+		z := (d - mean) / stdev
+		m3 += z * z * z
+		m4 += z * z * z * z
+	}
+	n := float64(len(samples))
+	return m3 / n, m4/n - 3
+}
+
+// describeShape 用一句话概括偏度和超额峰度，如 "right-skewed, heavy tails"
+func describeShape(skew, kurt float64) string {
+	var parts []string
+	switch {
+	case skew >= 1 && kurt > 1:
+		return "heavy right tail - occasional handshakes are much slower than typical"
+	case skew >= 1:
+		parts = append(parts, "strongly right-skewed")
+	case skew >= 0.5:
+		parts = append(parts, "right-skewed")
+	case skew <= -0.5:
+		parts = append(parts, "left-skewed")
+	default:
+		parts = append(parts, "roughly symmetric")
+	}
+	switch {
+	case kurt > 1:
+		parts = append(parts, "heavy tails")
+	case kurt < -1:
+		parts = append(parts, "light tails")
+	default:
+		parts = append(parts, "normal-like tails")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// trimmedMean 返回已排序样本两端各去掉 frac 比例后的均值
+func trimmedMean(sorted []float64, frac float64) float64 {
+	k := int(float64(len(sorted)) * frac)
+	kept := sorted[k : len(sorted)-k]
+	sum := 0.0
+	for _, d := range kept {
+		sum += d
+	}
+	return sum / float64(len(kept))
+}
+
+// medianAbsDeviation 返回已排序样本相对 median 的中位数绝对偏差。
+// |x - median| 在 median 左右两侧各自单调，像归并一样从 median 向两端走即可按序取到偏差，无需额外分配。
+func medianAbsDeviation(sorted []float64, median float64) float64 {
+	n := len(sorted)
+	right := sort.SearchFloat64s(sorted, median) // 第一个 >= median 的位置
+	left := right - 1
+	next := func() float64 {
+		if left < 0 || right < n && sorted[right]-median <= median-sorted[left] {
+			right++
+			return sorted[right-1] - median
+		}
+		left--
+		return median - sorted[left+1]
+	}
+
+	// 取第 (n-1)/2 小的偏差；n 为偶数时与第 n/2 小的取平均
+	var d float64
+	for i := 0; i <= (n-1)/2; i++ {
+		d = next()
+	}
+	if n%2 == 0 {
+		d = (d + next()) / 2
+	}
+	return d
+}
+
+// hdrHighest 是 -hdr 可区分的最大耗时（纳秒），更慢的样本按该值计入
+const hdrHighest = int64(time.Hour)
+
+// hdrHistogram 是 HdrHistogram 式的对数分桶计数器：值以纳秒整数记录，
+// 每个 2 的幂区间再线性细分，保证同一桶内的值与桶下界的相对误差小于 10^-digits。
+// 内存只取决于 digits 和可记录范围（3 位有效数字、1 小时上限约 270KB），与样本数无关。
+type hdrHistogram struct {
+	halfMag uint  // log2(每个区间的子桶数 / 2)
+	half    int64 // 每个区间的子桶数 / 2，不小于 10^digits
+	mask    int64
+	highest int64
+	counts  []int64
+	total   int64
+}
+
+// newHDRHistogram 创建精度为 digits 位有效数字、最大可记录 highest 纳秒的直方图
+func newHDRHistogram(digits int, highest int64) *hdrHistogram {
+	// 第一个区间内逐个纳秒计数，子桶数至少要能区分 2×10^digits 个值
+	mag := uint(math.Ceil(math.Log2(2 * math.Pow10(digits))))
+	count := int64(1) << mag
+	buckets := 1
+	for v := count; v <= highest; v <<= 1 {
+		buckets++
+	}
+	return &hdrHistogram{
+		halfMag: mag - 1,
+		half:    count / 2,
+		mask:    count - 1,
+		highest: highest,
+		counts:  make([]int64, (buckets+1)*int(count/2)),
+	}
+}
+
+// index 返回值 v 所在的计数下标
+func (h *hdrHistogram) index(v int64) int {
+	bucket := 63 - bits.LeadingZeros64(uint64(v|h.mask)) - int(h.halfMag)
+	sub := v >> bucket
+	return (bucket+1)<<h.halfMag + int(sub-h.half)
+}
+
+// bounds 返回下标 i 对应桶的下界和宽度（纳秒）
+func (h *hdrHistogram) bounds(i int) (lo, width int64) {
+	bucket := i>>h.halfMag - 1
+	sub := int64(i)&(h.half-1) + h.half
+	if bucket < 0 {
+		sub -= h.half
+		bucket = 0
+	}
+	return sub << bucket, 1 << bucket
+}
+
+// mid 返回下标 i 对应桶的中点，作为桶内样本的代表值
+func (h *hdrHistogram) mid(i int) int64 {
+	lo, width := h.bounds(i)
+	return lo + width/2
+}
+
+// Record 记录一个纳秒值；负值按 0、超过上限的按上限计
+func (h *hdrHistogram) Record(v int64) {
+	v = max(0, min(v, h.highest))
+	h.counts[h.index(v)]++
+	h.total++
+}
+
+// ValueAt 返回最近秩（nearest-rank）q 分位数所在桶的中点
+func (h *hdrHistogram) ValueAt(q float64) int64 {
+	rank := max(1, min(int64(math.Ceil(q*float64(h.total))), h.total))
+	cum := int64(0)
+	for i, c := range h.counts {
+		cum += c
+		if c > 0 && cum >= rank {
+			return h.mid(i)
+		}
+	}
+	return 0
+}
+
+// recorder 累计一组耗时样本（毫秒）。默认的 exactRecorder 保留全部样本；
+// -hdr 时使用 hdrRecorder，内存固定，分位数等统计量带有直方图精度内的误差；
+// -max-samples 时使用 reservoirRecorder，统计量来自全部样本的均匀随机子集。
+type recorder interface {
+	Add(ms float64)
+	Len() int
+	Stats() Stats
+}
+
+// newRecorder 在 digits 为 0 时返回 exactRecorder，否则返回对应精度的 hdrRecorder
+func newRecorder(digits int) recorder {
+	if digits == 0 {
+		return &exactRecorder{}
+	}
+	return &hdrRecorder{h: newHDRHistogram(digits, hdrHighest)}
+}
+
+// exactRecorder 按采集顺序保留全部样本，统计量精确
+type exactRecorder struct {
+	values []float64
+}
+
+func (r *exactRecorder) Add(ms float64) { r.values = append(r.values, ms) }
+func (r *exactRecorder) Len() int       { return len(r.values) }
+func (r *exactRecorder) Stats() Stats   { return calculateStats(r.values) }
+
+// reservoirRecorder 用蓄水池抽样（Algorithm R）最多保留 max 个样本：第 n 个样本以 max/n 的概率
+// 替换已保留的随机一个，任何时刻保留的都是已见样本的均匀随机子集。Len 为已见样本数，
+// Stats 的 Count 为保留数。
+type reservoirRecorder struct {
+	values []float64
+	max    int
+	seen   int
+}
+
+func newReservoirRecorder(limit int) *reservoirRecorder {
+	return &reservoirRecorder{values: make([]float64, 0, limit), max: limit}
+}
+
+func (r *reservoirRecorder) Add(ms float64) {
+	r.seen++
+	if len(r.values) < r.max {
+		r.values = append(r.values, ms)
+		return
+	}
+	if i := rng.IntN(r.seen); i < r.max {
+		r.values[i] = ms
+	}
+}
+
+func (r *reservoirRecorder) Len() int     { return r.seen }
+func (r *reservoirRecorder) Stats() Stats { return calculateStats(r.values) }
+
+// samplingReport 是 -max-samples 的抽样情况
+type samplingReport struct {
+	MaxSamples int `json:"max_samples"`
+	Successful int `json:"successful"` // 成功握手总数
+	Retained   int `json:"retained"`   // 参与 TLS 统计的样本数
+}
+
+// hdrRecorder 用 HDR 直方图估计分位数、截尾均值和 MAD；
+// 个数、最值、均值、标准差和几何均值在线累计，与精确方法一致。
+type hdrRecorder struct {
+	h           *hdrHistogram
+	acc         welford
+	min, max    float64
+	logSum      float64
+	nonPositive bool
+}
+
+func (r *hdrRecorder) Add(ms float64) {
+	r.h.Record(int64(math.Round(ms * 1e6)))
+	if r.acc.N == 0 || ms < r.min {
+		r.min = ms
+	}
+	if r.acc.N == 0 || ms > r.max {
+		r.max = ms
+	}
+	r.acc.Add(ms)
+	if ms <= 0 {
+		r.nonPositive = true
+	} else {
+		r.logSum += math.Log(ms)
+	}
+}
+
+func (r *hdrRecorder) Len() int { return r.acc.N }
+
+func (r *hdrRecorder) Stats() Stats {
+	n := r.acc.N
+	if n == 0 {
+		return Stats{}
+	}
+	// 桶中点可能略超出实际范围，夹到真实的最值之间
+	valueAt := func(q float64) float64 {
+		return min(max(float64(r.h.ValueAt(q))/1e6, r.min), r.max)
+	}
+	s := Stats{
+		Count: n,
+		Min:   r.min,
+		Max:   r.max,
+		P50:   valueAt(0.50),
+		P90:   valueAt(0.90),
+		P95:   valueAt(0.95),
+		P99:   valueAt(0.99),
+		Mean:  r.acc.Mean,
+		Stdev: math.Sqrt(r.acc.Variance()),
+	}
+	if n >= p999MinSamples {
+		s.P999 = valueAt(0.999)
+	} else {
+		s.P999 = s.Max
+	}
+	if !r.nonPositive {
+		s.GeoMean = math.Exp(r.logSum / float64(n))
+	}
+	if s.Mean > 0 {
+		s.CV = s.Stdev / s.Mean
+	}
+
+	// 非空桶按值从小到大排列，截尾均值和 MAD 以桶中点代表桶内样本；
+	// 桶中点可能落在实际最值之外（如所有样本都在桶的下端），夹到 [min, max] 之间
+	type bin struct {
+		v float64
+		c int64
+	}
+	var bins []bin
+	for i, c := range r.h.counts {
+		if c > 0 {
+			bins = append(bins, bin{min(max(float64(r.h.mid(i))/1e6, r.min), r.max), c})
+		}
+	}
+
+	k := int64(float64(n) * trimFraction)
+	lo, hi := k, int64(n)-k // 保留秩 [lo, hi)
+	sum, cum := 0.0, int64(0)
+	for _, b := range bins {
+		if kept := min(cum+b.c, hi) - max(cum, lo); kept > 0 {
+			sum += b.v * float64(kept)
+		}
+		cum += b.c
+	}
+	s.TrimmedMean = sum / float64(hi-lo)
+
+	devs := make([]bin, len(bins))
+	for i, b := range bins {
+		devs[i] = bin{math.Abs(b.v - s.P50), b.c}
+	}
+	sort.Slice(devs, func(i, j int) bool { return devs[i].v < devs[j].v })
+	nth := func(rank int64) float64 { // 第 rank 小（从 0 起）的偏差
+		cum := int64(0)
+		for _, d := range devs {
+			cum += d.c
+			if cum > rank {
+				return d.v
+			}
+		}
+		return devs[len(devs)-1].v
+	}
+	s.MAD = nth(int64(n-1) / 2)
+	if n%2 == 0 {
+		s.MAD = (s.MAD + nth(int64(n)/2)) / 2
+	}
+
+	if s.Stdev > 0 {
+		var m3, m4 float64
+		for _, b := range bins {
+			z := (b.v - s.Mean) / s.Stdev
+			m3 += z * z * z * float64(b.c)
+			m4 += z * z * z * z * float64(b.c)
+		}
+		s.Skewness, s.Kurtosis = m3/float64(n), m4/float64(n)-3
+	}
+	return s
+}
+
+// reportedPercentiles 是 printStats 输出的分位数
+var reportedPercentiles = []struct {
+	Name string
+	Q    float64
+}{{"p50", 0.50}, {"p90", 0.90}, {"p95", 0.95}, {"p99", 0.99}, {"p99.9", 0.999}}
+
+// percentileMinSamples 是可靠估计 q 分位数所需的样本数：经验上尾部之外至少要有 10 个样本，即 10/(1-q)
+func percentileMinSamples(q float64) int {
+	return int(math.Ceil(10/(1-q) - 1e-9))
+}
+
+// thinPercentiles 返回 n 个样本不足以可靠估计的分位数名称及各自所需的样本数
+func thinPercentiles(n int) (names []string, need []int) {
+	for _, p := range reportedPercentiles {
+		if m := percentileMinSamples(p.Q); n < m {
+			names = append(names, p.Name)
+			need = append(need, m)
+		}
+	}
+	return names, need
+}
+
+// 冷启动检测：长度为 coldStartWindow 的滑动窗口中位数与稳态中位数相差不超过 coldStartTolerance 时视为已稳定
+const (
+	coldStartWindow    = 10
+	coldStartTolerance = 0.10
+)
+
+// coldStartCutoff 返回按发起顺序排列的 durations 开头应丢弃的样本数。
+// 稳态中位数取后一半样本，从头滑动窗口直到窗口中位数落入容差内；最多丢弃一半样本，
+// 样本不足两个窗口时不丢弃。
+func coldStartCutoff(durations []float64) int {
+	n := len(durations)
+	if n < 2*coldStartWindow {
+		return 0
+	}
+	median := func(s []float64) float64 { return percentile(slices.Sorted(slices.Values(s)), 0.5) }
+	steady := median(durations[n/2:])
+	for k := 0; k <= n/2; k++ {
+		if math.Abs(median(durations[k:k+coldStartWindow])-steady) <= steady*coldStartTolerance {
+			return k
+		}
+	}
+	return n / 2
+}
+
+// 服务器冷启动对比：前 serverWarmupN 次与后 serverWarmupN 次正式握手的 TLS 中位数之比至少为
+// serverWarmupRatio，且单侧 Mann-Whitney 检验 p < serverWarmupAlpha 时视为检出
+const (
+	serverWarmupN     = 5
+	serverWarmupRatio = 1.2
+	serverWarmupAlpha = 0.05
+)
+
+// serverWarmupReport 比较按发起顺序的前 N 次与后 N 次握手。客户端的冷启动已由 -warmup 排除，
+// 剩下的差异来自服务器（session ticket 密钥、OCSP 缓存等）或网络路径，TCPRatio 用来区分后者。
+type serverWarmupReport struct {
+	N           int     `json:"n"`
+	FirstMedian float64 `json:"first_median"` // 前 N 次的 TLS 中位数
+	LastMedian  float64 `json:"last_median"`
+	Ratio       float64 `json:"ratio"`     // FirstMedian / LastMedian
+	TCPRatio    float64 `json:"tcp_ratio"` // 同样两组 TCP 中位数之比，Unix 套接字时为 0
+	PValue      float64 `json:"p_value"`   // 前 N 次整体更慢的单侧 Mann-Whitney 精确检验
+	Detected    bool    `json:"detected"`
+}
+
+// serverWarmup 对按发起顺序排列的成功握手做前 N / 后 N 对比，样本少于 4N 时返回 nil
+func serverWarmup(tlsTimes, tcpTimes []float64, n int) *serverWarmupReport {
+	if len(tlsTimes) < 4*n {
+		return nil
+	}
+	median := func(s []float64) float64 { return percentile(slices.Sorted(slices.Values(s)), 0.5) }
+	first, last := tlsTimes[:n], tlsTimes[len(tlsTimes)-n:]
+	r := &serverWarmupReport{N: n, FirstMedian: median(first), LastMedian: median(last), PValue: mannWhitneyGreater(first, last)}
+	if r.LastMedian > 0 {
+		r.Ratio = r.FirstMedian / r.LastMedian
+	}
+	if m := median(tcpTimes[len(tcpTimes)-n:]); m > 0 {
+		r.TCPRatio = median(tcpTimes[:n]) / m
+	}
+	r.Detected = r.Ratio >= serverWarmupRatio && r.PValue < serverWarmupAlpha
+	return r
+}
+
+// mannWhitneyGreater 返回 a 不比 b 大（H0）时观察到至少这么大的 U 统计量的概率，即单侧 p 值。
+// U 为 a 中元素大于 b 中元素的对数（相等计 0.5）；零假设下的分布用递推精确计算，
+// f(m, n, u) = f(m-1, n, u-n) + f(m, n-1, u)，适用于两组各几十个样本以内。
+func mannWhitneyGreater(a, b []float64) float64 {
+	m, n := len(a), len(b)
+	var u float64
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case x > y:
+				u++
+			case x == y:
+				u += 0.5
+			}
+		}
+	}
+	// counts[j][v]：j 个 b 元素、当前 i 个 a 元素时 U = v 的排列数
+	counts := make([][]float64, n+1)
+	for j := range counts {
+		counts[j] = make([]float64, m*n+1)
+		counts[j][0] = 1
+	}
+	for i := 1; i <= m; i++ {
+		next := make([][]float64, n+1)
+		next[0] = make([]float64, m*n+1)
+		next[0][0] = 1
+		for j := 1; j <= n; j++ {
+			next[j] = make([]float64, m*n+1)
+			for v := 0; v <= i*j; v++ {
+				next[j][v] = next[j-1][v]
+				if v >= j {
+					next[j][v] += counts[j][v-j]
+				}
+			}
+		}
+		counts = next
+	}
+	var tail, total float64
+	for v, c := range counts[n] {
+		total += c
+		if float64(v) >= u {
+			tail += c
+		}
+	}
+	return tail / total
+}
+
+// outlierReport 是按 1.5×IQR 规则检出的离群样本
+type outlierReport struct {
+	LowerFence float64   `json:"lower_fence"` // Q1 - 1.5×IQR
+	UpperFence float64   `json:"upper_fence"` // Q3 + 1.5×IQR
+	Values     []float64 `json:"values"`      // 从小到大
+}
+
+// findOutliers 用 Tukey 规则检出离群样本，并返回去掉离群值后的样本（保持原顺序）
+func findOutliers(durations []float64) (outlierReport, []float64) {
+	if len(durations) == 0 {
+		return outlierReport{}, nil
+	}
+	sorted := append([]float64(nil), durations...)
+	sort.Float64s(sorted)
+	q1, q3 := percentile(sorted, 0.25), percentile(sorted, 0.75)
+	iqr := q3 - q1
+	r := outlierReport{LowerFence: q1 - 1.5*iqr, UpperFence: q3 + 1.5*iqr}
+
+	var kept []float64
+	for _, d := range durations {
+		if d < r.LowerFence || d > r.UpperFence {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	for _, d := range sorted {
+		if d < r.LowerFence || d > r.UpperFence {
+			r.Values = append(r.Values, d)
+		}
+	}
+	return r, kept
+}
+
+// maxOutliersShown 是文本报告中列出的离群值上限
+const maxOutliersShown = 10
+
+// tlsJitter 返回相邻两次成功握手 TLS 耗时之差绝对值的平均数（毫秒），反映路由是否稳定。
+// 并发时不同 worker 的样本交错，"相邻"只在同一 worker 内按发起顺序计算；
+// 少于两个可配对的样本时返回 false。
+func tlsJitter(samples []sample) (float64, bool) {
+	var j jitterAcc
+	for _, s := range samples {
+		j.Add(s)
+	}
+	return j.Value()
+}
+
+// jitterAcc 逐个累计 tlsJitter，不需要保留样本。
+// 同一 worker 的测量串行进行，按完成顺序加入与按发起顺序加入结果相同。
+type jitterAcc struct {
+	last  map[int]float64 // 每个 worker 上一次成功握手的 TLS 耗时
+	sum   float64
+	pairs int
+}
+
+// Add 加入一个样本，失败的样本被忽略
+func (j *jitterAcc) Add(s sample) {
+	if s.Err != nil {
+		return
+	}
+	if j.last == nil {
+		j.last = make(map[int]float64)
+	}
+	d := millis(s.Result.TLS)
+	if prev, ok := j.last[s.Worker]; ok {
+		j.sum += math.Abs(d - prev)
+		j.pairs++
+	}
+	j.last[s.Worker] = d
+}
+
+// Value 返回平均抖动；少于两个可配对的样本时返回 false
+func (j *jitterAcc) Value() (float64, bool) {
+	if j.pairs == 0 {
+		return 0, false
+	}
+	return j.sum / float64(j.pairs), true
+}
+
+// printStats 打印一个统计块（不含结尾空行）
+func printStats(w io.Writer, title string, s Stats) {
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "  min:   %s\n", unit.f(8, s.Min))
+	fmt.Fprintf(w, "  p50:   %s\n", unit.f(8, s.P50))
+	fmt.Fprintf(w, "  p90:   %s\n", unit.f(8, s.P90))
+	fmt.Fprintf(w, "  p95:   %s\n", unit.f(8, s.P95))
+	fmt.Fprintf(w, "  p99:   %s\n", unit.f(8, s.P99))
+	if s.Count < p999MinSamples {
+		fmt.Fprintf(w, "  p99.9: %*s   (need >= %d samples)\n", unit.col(8), "n/a", p999MinSamples)
+	} else {
+		fmt.Fprintf(w, "  p99.9: %s\n", unit.f(8, s.P999))
+	}
+	fmt.Fprintf(w, "  max:   %s\n", unit.f(8, s.Max))
+	if s.GeoMean > 0 {
+		fmt.Fprintf(w, "  mean:  %s   (10%% trimmed: %s, geometric: %s)\n", unit.f(8, s.Mean), unit.f(0, s.TrimmedMean), unit.f(0, s.GeoMean))
+	} else {
+		fmt.Fprintf(w, "  mean:  %s   (10%% trimmed: %s)\n", unit.f(8, s.Mean), unit.f(0, s.TrimmedMean))
+	}
+	fmt.Fprintf(w, "  stdev: %s   (MAD: %s, CV: %.3f)\n", unit.f(8, s.Stdev), unit.f(0, s.MAD), s.CV)
+}
+
+// formatCounts 按名称排序输出计数，如 "TLS 1.2=3, TLS 1.3=97"
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// histogramWidth 是直方图最长条的字符数
+const histogramWidth = 50
+
+// printHistogram 把样本等宽分成 buckets 个区间，打印横向 ASCII 条形图
+func printHistogram(w io.Writer, title string, durations []float64, buckets int) {
+	if len(durations) == 0 || buckets < 1 {
+		return
+	}
+	lo, hi := durations[0], durations[0]
+	for _, d := range durations {
+		lo = math.Min(lo, d)
+		hi = math.Max(hi, d)
+	}
+	width := (hi - lo) / float64(buckets)
+	if width == 0 {
+		buckets, width = 1, 1 // 所有样本相同
+	}
+
+	counts := make([]int, buckets)
+	for _, d := range durations {
+		i := int((d - lo) / width)
+		if i >= buckets {
+			i = buckets - 1 // max 落在最后一个区间
+		}
+		counts[i]++
+	}
+	maxCount := 0
+	for _, c := range counts {
+		maxCount = max(maxCount, c)
+	}
+
+	fmt.Fprintln(w, title)
+	for i, c := range counts {
+		from := lo + float64(i)*width
+		to := from + width
+		bar := strings.Repeat("#", (c*histogramWidth+maxCount-1)/maxCount)
+		closing := ")"
+		if i == buckets-1 {
+			closing = "]"
+		}
+		fmt.Fprintf(w, "  [%*.*f, %*.*f%s %s %6d %s\n", 8, unit.Prec, from*unit.PerMs, 8, unit.Prec, to*unit.PerMs, closing, unit.Name, c, bar)
+	}
+}
+
+// parseBuckets 解析 -buckets 的逗号分隔上界（ms），必须为正且严格递增
+func parseBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, f := range splitList(s) {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid bound %q (want a positive number of ms)", f)
+		}
+		if len(bounds) > 0 && v <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("bounds must be strictly increasing, got %g after %g", v, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, v)
+	}
+	if len(bounds) == 0 {
+		return nil, errors.New("no bounds given")
+	}
+	return bounds, nil
+}
+
+// latencyBuckets 按 -buckets 的上界逐个计数，与 Prometheus 一样区间为 (上一个上界, 上界]，
+// 最后一个区间收容超过最大上界的样本。计数在汇总时逐个进行，不受 -hdr / -max-samples 影响。
+type latencyBuckets struct {
+	Bounds    []float64
+	Counts    []int             // len(Bounds)+1
+	Exemplars []*bucketExemplar // 每个区间内最慢的一次握手，区间为空时为 nil
+}
+
+// bucketExemplar 指向区间内的一次具体握手，-prom-exemplars 把它作为 OpenMetrics exemplar 写出
+type bucketExemplar struct {
+	Ms    float64   `json:"ms"`
+	Index int       `json:"index"` // 样本的发起顺序，与 -csv / -ndjson 的 index 一致
+	At    time.Time `json:"timestamp"`
+}
+
+func newLatencyBuckets(bounds []float64) *latencyBuckets {
+	return &latencyBuckets{Bounds: bounds, Counts: make([]int, len(bounds)+1), Exemplars: make([]*bucketExemplar, len(bounds)+1)}
+}
+
+// Observe 计数的同时记下区间内最慢的样本
+func (b *latencyBuckets) Observe(ms float64, index int, at time.Time) {
+	i := sort.SearchFloat64s(b.Bounds, ms)
+	b.Counts[i]++
+	if ex := b.Exemplars[i]; ex == nil || ms > ex.Ms {
+		b.Exemplars[i] = &bucketExemplar{Ms: ms, Index: index, At: at}
+	}
+}
+
+// bucketReport 是 JSON 中的一个区间；LeMs 为 nil 表示 +Inf
+type bucketReport struct {
+	LeMs       *float64        `json:"le_ms"`
+	Count      int             `json:"count"`
+	Cumulative float64         `json:"cumulative_percent"` // 不超过 LeMs 的样本占比
+	Slowest    *bucketExemplar `json:"slowest,omitempty"`  // 区间内最慢的握手
+}
+
+// defaultPromBuckets 是 -prom-exemplars 未指定 -buckets 时直方图的上界（ms）
+var defaultPromBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000}
+
+// Report 返回各区间的计数和累计占比
+func (b *latencyBuckets) Report() []bucketReport {
+	total := 0
+	for _, c := range b.Counts {
+		total += c
+	}
+	reports := make([]bucketReport, len(b.Counts))
+	cum := 0
+	for i, c := range b.Counts {
+		cum += c
+		reports[i] = bucketReport{Count: c, Slowest: b.Exemplars[i]}
+		if i < len(b.Bounds) {
+			reports[i].LeMs = &b.Bounds[i]
+		}
+		if total > 0 {
+			reports[i].Cumulative = float64(cum) / float64(total) * 100.0
+		}
+	}
+	return reports
+}
+
+// printBuckets 按 -buckets 的区间打印计数、占比、累计占比和条形图，
+// 累计占比即「不超过该上界的握手比例」
+func printBuckets(w io.Writer, title string, b *latencyBuckets) {
+	reports := b.Report()
+	maxCount, total := 0, 0
+	for _, r := range reports {
+		maxCount = max(maxCount, r.Count)
+		total += r.Count
+	}
+	if total == 0 {
+		return
+	}
+	labels := make([]string, len(reports))
+	width := 0
+	for i := range reports {
+		switch {
+		case i == 0:
+			labels[i] = "<= " + unit.f(0, b.Bounds[0])
+		case i < len(b.Bounds):
+			labels[i] = fmt.Sprintf("(%s, %s]", strings.TrimSuffix(unit.f(0, b.Bounds[i-1]), unit.Name), unit.f(0, b.Bounds[i]))
+		default:
+			labels[i] = "> " + unit.f(0, b.Bounds[len(b.Bounds)-1])
+		}
+		width = max(width, len(labels[i]))
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "  %-*s %7s %7s %7s\n", width, "Bucket", "Count", "Share", "Cum.")
+	for i, r := range reports {
+		line := fmt.Sprintf("  %-*s %7d %6.1f%% %6.1f%% %s", width, labels[i], r.Count, float64(r.Count)/float64(total)*100.0, r.Cumulative,
+			strings.Repeat("#", (r.Count*histogramWidth+maxCount-1)/maxCount))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// warnThresholds 是分析部分的告警阈值（毫秒），由 -warn-stdev / -warn-gap / -warn-p50 设置
+type warnThresholds struct {
+	Stdev float64 // TLS 标准差
+	Gap   float64 // TLS p90→p99 差值
+	P50   float64 // TLS p50
+}
+
+// thresholdFailures 返回 TLS 握手统计中超出阈值的项。
+// failOnWarn 时分析部分的 ⚠️ 告警同样计入；maxP50/maxP99 为 0 表示不检查。
+func thresholdFailures(s Stats, warn warnThresholds, failOnWarn bool, maxP50, maxP99 float64) []string {
+	var failures []string
+	if failOnWarn {
+		if s.Stdev > warn.Stdev {
+			failures = append(failures, fmt.Sprintf("TLS stdev %s > -warn-stdev %s", unit.f(0, s.Stdev), unit.f(0, warn.Stdev)))
+		}
+		if gap := s.P99 - s.P90; gap > warn.Gap {
+			failures = append(failures, fmt.Sprintf("TLS p90→p99 gap %s > -warn-gap %s", unit.f(0, gap), unit.f(0, warn.Gap)))
+		}
+		if s.P50 > warn.P50 {
+			failures = append(failures, fmt.Sprintf("TLS p50 %s > -warn-p50 %s", unit.f(0, s.P50), unit.f(0, warn.P50)))
+		}
+	}
+	if maxP50 > 0 && s.P50 > maxP50 {
+		failures = append(failures, fmt.Sprintf("TLS p50 %s > -max-p50 %s", unit.f(0, s.P50), unit.f(0, maxP50)))
+	}
+	if maxP99 > 0 && s.P99 > maxP99 {
+		failures = append(failures, fmt.Sprintf("TLS p99 %s > -max-p99 %s", unit.f(0, s.P99), unit.f(0, maxP99)))
+	}
+	return failures
+}
+
+// warmupSample 是一次预热握手的结果
+type warmupSample struct {
+	DNS   float64 `json:"dns_ms"`
+	TCP   float64 `json:"tcp_ms"`
+	TLS   float64 `json:"tls_ms"`
+	Error string  `json:"error,omitempty"`
+}
+
+// reportSchema 标识 -json 报告的格式版本，稳定字段的键名或单位变化时递增
+const reportSchema = "tls-bench/v1"
+
+// tlsLibrary 是报告中 library 字段的取值
+const tlsLibrary = "Go crypto/tls"
+
+// jsonReport 是 -json 模式下输出到 stdout 的完整结果。
+//
+// 标为「稳定」的字段在同一 reportSchema 内键名、类型和单位不变，-compare-go-rust 的对比
+// 和外部 diff 脚本只依赖这些字段。耗时统计量的单位由 unit 给出，固定为 "ms"；
+// Stats 的键为 count、min、max、p50、p90、p99、mean、stdev。
+type jsonReport struct {
+	Schema  string `json:"schema"`         // 稳定：reportSchema
+	Tool    string `json:"tool"`           // 稳定："go"；-compare-go-rust 解析出的 Rust 结果为 "rust"
+	Library string `json:"library"`        // 稳定：TLS 实现，如 "Go crypto/tls"、"rustls 0.23 + aws-lc-rs"
+	Host    string `json:"host"`           // 稳定
+	Port    int    `json:"port"`           // 稳定
+	SNI     string `json:"sni,omitempty"`  // -sni-list 时本报告使用的 SNI
+	Unix    string `json:"unix,omitempty"` // unix://<path> 目标的套接字路径，此时没有 DNS/TCP 阶段
+	Count   int    `json:"count"`          // 稳定：计划测量的握手数
+	// Interrupted 表示测试被 Ctrl-C 提前结束，统计只覆盖已完成的握手
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Aborted 表示因 -fail-fast（连续失败）或 -abort-on-cert-error（证书校验失败）提前结束
+	Aborted    bool `json:"aborted,omitempty"`
+	Run        int  `json:"run,omitempty"` // -repeat 时为第几轮，从 1 开始
+	Successful int  `json:"successful"`    // 稳定
+	Errors     int  `json:"errors"`        // 稳定
+	// ErrorKinds 是各类失败的次数，键见 classifyError（重试后仍失败的才计入）
+	ErrorKinds map[string]int `json:"error_kinds,omitempty"`
+	Unit       string         `json:"unit"` // 稳定：统计量的单位，固定为 "ms"
+	GoVersion  string         `json:"go_version,omitempty"`
+	CryptoMode string         `json:"crypto_mode,omitempty"`
+	// ConnectOnly 表示 -connect-only：只建立 TCP 连接，TLS 统计全部为零
+	ConnectOnly bool   `json:"connect_only,omitempty"`
+	Seed        uint64 `json:"seed"`          // 本次运行的 -seed，用于复现
+	DNS         *Stats `json:"dns,omitempty"` // host 为 IP 字面量时省略
+	TCP         Stats  `json:"tcp"`           // 稳定
+	TLS         Stats  `json:"tls"`           // 稳定
+	// TLSJitter 是相邻握手 TLS 耗时差的平均绝对值，并发时按 worker 分别计算
+	TLSJitter *float64 `json:"tls_jitter,omitempty"`
+	// ColdStartDiscarded 是 -warmup-discard-outliers 判定为冷启动而丢弃的开头样本数
+	ColdStartDiscarded int `json:"cold_start_discarded,omitempty"`
+	// HDRDigits 非零表示统计量来自 -hdr 直方图，分位数的相对误差小于 10^-HDRDigits
+	HDRDigits int `json:"hdr_digits,omitempty"`
+	// Sampling 非 nil 表示统计量来自 -max-samples 的蓄水池抽样
+	Sampling *samplingReport `json:"sampling,omitempty"`
+	Verify   *Stats          `json:"verify,omitempty"` // TLS 中的证书链校验部分
+	// Phases 是 -phases 时 TLS 握手各子阶段的近似耗时
+	Phases *phasesReport `json:"tls_phases,omitempty"`
+	TTFB   *Stats        `json:"ttfb,omitempty"` // -http 模式下的首字节时间
+	// SOCKS5 / HTTPConnect 是经代理时建立隧道的耗时，已计入 Total
+	SOCKS5      *Stats `json:"socks5_connect,omitempty"`
+	HTTPConnect *Stats `json:"http_connect,omitempty"`
+	// Chain 是 -chain 时每一跳 CONNECT 的统计，此时隧道建立的总耗时不写入 socks5_connect / http_connect
+	Chain []chainHop `json:"chain,omitempty"`
+	// Tunnel 是 -chain 时逐跳建立整条隧道的总耗时
+	Tunnel     *Stats         `json:"chain_tunnel,omitempty"`
+	HTTPStatus map[string]int `json:"http_status,omitempty"`
+	Total      Stats          `json:"total"` // 稳定
+	Negotiated negotiated     `json:"negotiated"`
+	Cert       *certInfo      `json:"certificate,omitempty"`
+	OCSP       *ocspReport    `json:"ocsp,omitempty"`
+	Versions   map[string]int `json:"versions"`
+	// Groups 是各密钥交换组的握手数（会话恢复且未重新协商密钥时不计入）
+	Groups map[string]int `json:"groups,omitempty"`
+	// ChainDepths 是按服务器发送的证书数（PeerCertificates）统计的成功握手数，键为证书数
+	ChainDepths map[string]int `json:"chain_depths,omitempty"`
+	Families    map[string]int `json:"families"`
+	// SourceAddrs 是 -local-addr 时各源地址的握手数，键为 "IP (接口名)"
+	SourceAddrs map[string]int `json:"source_addrs,omitempty"`
+	// ClientCertRequests 是服务器发送 CertificateRequest 的成功握手数
+	ClientCertRequests int `json:"client_cert_requests"`
+	// Retried 是至少重试过一次的样本数（含最终失败的），RetryAttempts 是重试总次数
+	Retried       int            `json:"retried,omitempty"`
+	RetryAttempts int            `json:"retry_attempts,omitempty"`
+	SLO           *sloReport     `json:"slo,omitempty"`         // -slo-ms 时的达标比例
+	Buckets       []bucketReport `json:"tls_buckets,omitempty"` // -buckets 时各区间的 TLS 握手数
+	// promBuckets 是 -prom-exemplars 的 TLS 直方图区间，只写入 Prometheus 文件
+	promBuckets []bucketReport
+	Geo         []geoInfo        `json:"geo,omitempty"` // -geodb 时各对端 IP 的位置
+	Throughput  throughputReport `json:"throughput"`
+	CPU         *cpuReport       `json:"cpu,omitempty"` // 未编译 tls_bench_cpu_unix.go 时省略
+	Memory      *memReport       `json:"memory,omitempty"`
+	Outliers    *outlierReport   `json:"tls_outliers,omitempty"` // -hdr 时不保留样本，无法列出
+	TLSTrimmed  *Stats           `json:"tls_trimmed,omitempty"`  // -trim：去掉离群值后的 TLS 统计
+	// ServerWarmup 是前 N 次与后 N 次握手的对比，-hdr 或样本不足时为 nil
+	ServerWarmup *serverWarmupReport `json:"server_warmup,omitempty"`
+	Resumption   *resumption         `json:"resumption,omitempty"`
+	// ByVersion 是按协商到的 TLS 版本分组的 TLS 握手统计，只在混有多个版本时输出
+	ByVersion map[string]Stats `json:"tls_by_version,omitempty"`
+	QUIC      *quicReport      `json:"quic,omitempty"`
+	TFO       *tfoReport       `json:"tfo,omitempty"`
+	Netem     *netemReport     `json:"injected_latency,omitempty"`
+	Predial   *predialReport   `json:"predial,omitempty"`
+	Paired    *pairedReport    `json:"paired,omitempty"`
+	// CryptoOnly 是 -handshake-only 对进程内服务器的回环握手，不含网络往返
+	CryptoOnly *cryptoOnlyReport `json:"crypto_only,omitempty"`
+	Reuse      *reuseReport      `json:"reuse,omitempty"`
+	PQ         *pqReport         `json:"pq,omitempty"`
+	ECH        *echReport        `json:"ech,omitempty"`
+	Padding    *paddingReport    `json:"client_hello_padding,omitempty"`
+	Warmup     []warmupSample    `json:"warmup"`
+}
+
+// sloReport 是 -slo-ms 的结果：总耗时（TCP + TLS）不超过阈值的握手占全部测量的比例，失败的握手计为未达标
+type sloReport struct {
+	ThresholdMs float64 `json:"threshold_ms"`
+	Target      float64 `json:"target_percent,omitempty"` // -slo-target，0 表示只报告
+	Within      int     `json:"within"`
+	Measured    int     `json:"measured"`
+	Compliance  float64 `json:"compliance_percent"`
+	Passed      bool    `json:"passed"` // 未设置 -slo-target 时总为 true
+}
+
+// newSLOReport 在未设置 -slo-ms（threshold 为 0）时返回 nil
+func newSLOReport(threshold, target float64, within, measured int) *sloReport {
+	if threshold <= 0 {
+		return nil
+	}
+	r := &sloReport{ThresholdMs: threshold, Target: target, Within: within, Measured: measured}
+	if measured > 0 {
+		r.Compliance = float64(within) / float64(measured) * 100
+	}
+	r.Passed = r.Compliance >= target
+	return r
+}
+
+// phasesReport 是 -phases 时 TLS 子阶段（见 tlsPhases）的分组统计
+type phasesReport struct {
+	ServerHello  Stats `json:"server_hello"`
+	ServerFlight Stats `json:"server_flight"`
+	Verify       Stats `json:"verify_connection"`
+	Finished     Stats `json:"finished"`
+}
+
+// phaseRecorders 依次收集 tlsPhases 的四段耗时
+type phaseRecorders [4]recorder
+
+func (p phaseRecorders) Add(ph *tlsPhases) {
+	for i, d := range []time.Duration{ph.ServerHello, ph.ServerFlight, ph.Verify, ph.Finished} {
+		p[i].Add(millis(d))
+	}
+}
+
+// Report 在没有任何样本时返回 nil
+func (p phaseRecorders) Report() *phasesReport {
+	if p[0].Len() == 0 {
+		return nil
+	}
+	return &phasesReport{p[0].Stats(), p[1].Stats(), p[2].Stats(), p[3].Stats()}
+}
+
+// resumption 是 -resume 模式下完整握手与会话恢复握手的分组统计
+type resumption struct {
+	ResumedPercent float64 `json:"resumed_percent"`
+	Full           *Stats  `json:"full,omitempty"`
+	Resumed        *Stats  `json:"resumed,omitempty"`
+}
+
+// ndjsonSample 是 -ndjson 模式下每次握手完成后立即输出的一行
+type ndjsonSample struct {
+	Target    string  `json:"target,omitempty"` // 仅多目标时输出
+	Index     int     `json:"index"`
+	Timestamp string  `json:"timestamp"`
+	OK        bool    `json:"ok"`
+	DNS       float64 `json:"dns_ms,omitempty"`
+	TCP       float64 `json:"tcp_ms,omitempty"`
+	TLS       float64 `json:"tls_ms,omitempty"`
+	Total     float64 `json:"total_ms,omitempty"`
+	Version   string  `json:"version,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func newNDJSONSample(target string, s sample) ndjsonSample {
+	line := ndjsonSample{Target: target, Index: s.Index, Timestamp: s.Start.Format(time.RFC3339Nano)}
+	if s.Err != nil {
+		line.Error = s.Err.Error()
+		return line
+	}
+	res := s.Result
+	line.OK = true
+	line.DNS = millis(res.DNS)
+	line.TCP = millis(res.TCP)
+	line.TLS = millis(res.TLS)
+	line.Total = millis(res.TCP + res.Proxy + res.TLS)
+	line.Version = tls.VersionName(res.State.Version)
+	return line
+}
+
+// csvSampleWriter 把每次正式握手写成一行 CSV。
+// 失败的握手同样输出一行：耗时列留空，error 列为错误信息。
+type csvSampleWriter struct {
+	w      *csv.Writer
+	closer io.Closer
+	// multiTarget 时每行首列为 target（当前目标的 host:port）
+	multiTarget bool
+	target      string
+}
+
+func newCSVSampleWriter(path string, multiTarget bool) (*csvSampleWriter, error) {
+	sw := &csvSampleWriter{multiTarget: multiTarget}
+	if path == "-" {
+		sw.w = csv.NewWriter(os.Stdout)
+	} else {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		sw.w = csv.NewWriter(f)
+		sw.closer = f
+	}
+	header := []string{"index", "dns_ms", "tcp_ms", "tls_ms", "total_ms", "timestamp", "error", "tls_version"}
+	if multiTarget {
+		header = append([]string{"target"}, header...)
+	}
+	if err := sw.w.Write(header); err != nil {
+		sw.Close()
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (sw *csvSampleWriter) Write(s sample) error {
+	row := []string{strconv.Itoa(s.Index), "", "", "", "", s.Start.Format(time.RFC3339Nano), "", ""}
+	if s.Err != nil {
+		row[6] = s.Err.Error()
+	} else {
+		res := s.Result
+		row[1] = strconv.FormatFloat(millis(res.DNS), 'f', 3, 64)
+		row[2] = strconv.FormatFloat(millis(res.TCP), 'f', 3, 64)
+		row[3] = strconv.FormatFloat(millis(res.TLS), 'f', 3, 64)
+		row[4] = strconv.FormatFloat(millis(res.TCP)+millis(res.Proxy)+millis(res.TLS), 'f', 3, 64)
+		row[7] = tls.VersionName(res.State.Version)
+	}
+	if sw.multiTarget {
+		row = append([]string{sw.target}, row...)
+	}
+	return sw.w.Write(row)
+}
+
+func (sw *csvSampleWriter) Close() error {
+	sw.w.Flush()
+	err := sw.w.Error()
+	if sw.closer != nil {
+		if cerr := sw.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// rawSampleWriter 把每个成功样本未经汇总的原始耗时写成 CSV，供 Python/R 等外部工具分析。
+// 与 -csv 不同，只含耗时列，失败的握手不输出。
+type rawSampleWriter struct {
+	w          *csv.Writer
+	f          *os.File
+	withTarget bool // 多目标时首列为 target
+	withWorker bool // 并发时输出 worker 列
+	target     string
+}
+
+func newRawSampleWriter(path string, withTarget, withWorker bool) (*rawSampleWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	rw := &rawSampleWriter{w: csv.NewWriter(f), f: f, withTarget: withTarget, withWorker: withWorker}
+	var header []string
+	if withTarget {
+		header = append(header, "target")
+	}
+	if withWorker {
+		header = append(header, "worker")
+	}
+	header = append(header, "tcp_ms", "tls_ms", "total_ms")
+	if err := rw.w.Write(header); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (rw *rawSampleWriter) Write(s sample) error {
+	if s.Err != nil {
+		return nil
+	}
+	var row []string
+	if rw.withTarget {
+		row = append(row, rw.target)
+	}
+	if rw.withWorker {
+		row = append(row, strconv.Itoa(s.Worker))
+	}
+	res := s.Result
+	row = append(row,
+		strconv.FormatFloat(millis(res.TCP), 'f', 6, 64),
+		strconv.FormatFloat(millis(res.TLS), 'f', 6, 64),
+		strconv.FormatFloat(millis(res.TCP+res.Proxy+res.TLS), 'f', 6, 64))
+	return rw.w.Write(row)
+}
+
+func (rw *rawSampleWriter) Close() error {
+	rw.w.Flush()
+	err := rw.w.Error()
+	if cerr := rw.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// promLabel 转义 Prometheus 标签值
+func promLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// newSelftestServer 启动 -selftest 使用的进程内 TLS 服务器（httptest 自签名证书，含 127.0.0.1）。
+// nextProtos 非空时服务器只接受这些 ALPN 协议，否则为 httptest 默认的 http/1.1。
+func newSelftestServer(nextProtos []string) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	}))
+	if len(nextProtos) > 0 {
+		srv.TLS = &tls.Config{NextProtos: nextProtos}
+	}
+	// 握手后客户端直接关闭连接，服务器端的 "TLS handshake error: EOF" 日志没有意义
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	return srv
+}
+
+// selftestProblems 检查一份报告的全部统计块，以及各块之间的关系：
+// 样本数与成功数一致，每个样本的 Total 不小于其中的 TLS，因此 Total 的最值不小于 TLS 的最值
+func selftestProblems(r *jsonReport) []string {
+	var problems []string
+	if r.Successful == 0 {
+		return []string{fmt.Sprintf("no successful handshakes (%d errors)", r.Errors)}
+	}
+	if r.Successful+r.Errors != r.Count {
+		problems = append(problems, fmt.Sprintf("successful %d + errors %d != count %d", r.Successful, r.Errors, r.Count))
+	}
+	blocks := []struct {
+		name string
+		s    *Stats
+	}{{"dns", r.DNS}, {"tcp", &r.TCP}, {"tls", &r.TLS}, {"verify", r.Verify}, {"total", &r.Total}}
+	for _, b := range blocks {
+		if b.s != nil {
+			problems = append(problems, statsProblems(b.name, *b.s)...)
+		}
+	}
+	for _, b := range blocks[1:3] {
+		if b.s.Count != r.Successful {
+			problems = append(problems, fmt.Sprintf("%s: %d samples for %d successful handshakes", b.name, b.s.Count, r.Successful))
+		}
+	}
+	if r.Total.Min < r.TLS.Min || r.Total.Max < r.TLS.Max {
+		problems = append(problems, fmt.Sprintf("total [%g, %g] below tls [%g, %g]", r.Total.Min, r.Total.Max, r.TLS.Min, r.TLS.Max))
+	}
+	return problems
+}
+
+// printSelftest 输出 -selftest 的检查结果，全部通过时返回 true
+func printSelftest(w io.Writer, reports []*jsonReport) bool {
+	fmt.Fprintln(w, "=== Self-test ===")
+	ok := true
+	for _, r := range reports {
+		for _, p := range selftestProblems(r) {
+			fmt.Fprintf(w, "❌ %s\n", p)
+			ok = false
+		}
+	}
+	if ok {
+		fmt.Fprintf(w, "✅ Stats are internally consistent (%d reports)\n", len(reports))
+	}
+	return ok
+}
+
+// runSummary 是 -append-jsonl 每行的内容：一个目标一轮测试的摘要，便于按时间序列导入
+type runSummary struct {
+	Timestamp  string `json:"timestamp"` // 本轮开始的时刻，RFC3339（UTC）
+	Schema     string `json:"schema"`
+	Tool       string `json:"tool"`
+	Library    string `json:"library"`
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	SNI        string `json:"sni,omitempty"`
+	Unix       string `json:"unix,omitempty"`
+	Run        int    `json:"run,omitempty"`
+	Count      int    `json:"count"`
+	Successful int    `json:"successful"`
+	Errors     int    `json:"errors"`
+	Unit       string `json:"unit"`
+	DNS        *Stats `json:"dns,omitempty"`
+	TCP        Stats  `json:"tcp"`
+	TLS        Stats  `json:"tls"`
+	Total      Stats  `json:"total"`
+	// Throughput 是计入 -delay 的握手速率，全部失败时为 0
+	Throughput float64 `json:"handshakes_per_sec"`
+}
+
+func newRunSummary(r *jsonReport, started time.Time) runSummary {
+	return runSummary{
+		Timestamp:  started.UTC().Format(time.RFC3339),
+		Schema:     reportSchema,
+		Tool:       "go",
+		Library:    tlsLibrary,
+		Host:       r.Host,
+		Port:       r.Port,
+		SNI:        r.SNI,
+		Unix:       r.Unix,
+		Run:        r.Run,
+		Count:      r.Count,
+		Successful: r.Successful,
+		Errors:     r.Errors,
+		Unit:       r.Unit,
+		DNS:        r.DNS,
+		TCP:        r.TCP,
+		TLS:        r.TLS,
+		Total:      r.Total,
+		Throughput: r.Throughput.WithDelay,
+	}
+}
+
+// appendJSONL 把 v 编码为一行追加到 path，文件不存在时创建。
+// 整行在一次 O_APPEND 写入中完成，多个进程同时追加同一文件时各行不会交错。
+func appendJSONL(path string, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writePromFile 以 node_exporter textfile collector 格式写出结果，每个目标一组 host/port 标签。
+// exemplars 时改写 OpenMetrics 文本格式，并按 -buckets 的区间（未指定时为 defaultPromBuckets）增加 TLS 握手直方图，
+// p99 所在区间附带该区间最慢一次握手的 exemplar（序号和发起时刻）。
+// 先写同目录下的临时文件再 rename，保证采集方不会读到写了一半的文件。
+func writePromFile(path string, reports []*jsonReport, exemplars bool) error {
+	var b strings.Builder
+	labels := func(r *jsonReport) string {
+		if r.Unix != "" {
+			return fmt.Sprintf(`socket="%s"`, promLabel(r.Unix))
+		}
+		if r.SNI != "" {
+			return fmt.Sprintf(`host="%s",port="%d",sni="%s"`, promLabel(r.Host), r.Port, promLabel(r.SNI))
+		}
+		return fmt.Sprintf(`host="%s",port="%d"`, promLabel(r.Host), r.Port)
+	}
+
+	type quantile struct {
+		q string
+		v float64
+	}
+	summary := func(name, help string, stats func(r *jsonReport) Stats) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s summary\n", name)
+		for _, r := range reports {
+			s := stats(r)
+			if s.Count > 0 {
+				quantiles := []quantile{{"0.5", s.P50}, {"0.9", s.P90}, {"0.95", s.P95}, {"0.99", s.P99}}
+				if s.Count >= p999MinSamples {
+					quantiles = append(quantiles, quantile{"0.999", s.P999})
+				}
+				for _, q := range quantiles {
+					fmt.Fprintf(&b, "%s{%s,quantile=\"%s\"} %g\n", name, labels(r), q.q, q.v)
+				}
+			}
+			fmt.Fprintf(&b, "%s_sum{%s} %g\n", name, labels(r), s.Mean*float64(s.Count))
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", name, labels(r), s.Count)
+		}
+	}
+	summary("tls_bench_tcp_connect_latency_ms", "TCP connect latency in milliseconds.", func(r *jsonReport) Stats { return r.TCP })
+	summary("tls_handshake_latency_ms", "TLS handshake latency in milliseconds.", func(r *jsonReport) Stats { return r.TLS })
+	summary("tls_bench_total_latency_ms", "TCP connect plus TLS handshake latency in milliseconds.", func(r *jsonReport) Stats { return r.Total })
+	if exemplars {
+		writePromHistogram(&b, "tls_bench_tls_handshake_duration_ms", "TLS handshake latency histogram in milliseconds; the p99 bucket links to its slowest handshake.", reports, labels)
+	}
+
+	gauge := func(name, typ, help string, value func(r *jsonReport) int64) {
+		family := name
+		if exemplars && typ == "counter" {
+			family = strings.TrimSuffix(name, "_total") // OpenMetrics 的 counter 族名不带 _total
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", family, help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", family, typ)
+		for _, r := range reports {
+			fmt.Fprintf(&b, "%s{%s} %d\n", name, labels(r), value(r))
+		}
+	}
+	now := time.Now().Unix()
+	gauge("tls_bench_errors_total", "counter", "Failed handshakes in the last run.", func(r *jsonReport) int64 { return int64(r.Errors) })
+	gauge("tls_bench_successful", "gauge", "Successful handshakes in the last run.", func(r *jsonReport) int64 { return int64(r.Successful) })
+	gauge("tls_bench_last_run_timestamp_seconds", "gauge", "Unix time the last run finished.", func(r *jsonReport) int64 { return now })
+	if exemplars {
+		b.WriteString("# EOF\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// CreateTemp 创建的文件权限为 0600，采集方通常以其他用户运行
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writePromHistogram 把各报告的 TLS 区间计数写成 OpenMetrics histogram。
+// 只有 p99 所在的区间带 exemplar：从尾延迟告警可以直接定位到 -csv / -ndjson 中的那一次握手。
+func writePromHistogram(b *strings.Builder, name, help string, reports []*jsonReport, labels func(r *jsonReport) string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for _, r := range reports {
+		if len(r.promBuckets) == 0 {
+			continue
+		}
+		total := 0
+		for _, bk := range r.promBuckets {
+			total += bk.Count
+		}
+		cum, p99Done := 0, false
+		for _, bk := range r.promBuckets {
+			cum += bk.Count
+			le := "+Inf"
+			if bk.LeMs != nil {
+				le = strconv.FormatFloat(*bk.LeMs, 'g', -1, 64)
+			}
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d", name, labels(r), le, cum)
+			if !p99Done && total > 0 && cum*100 >= total*99 {
+				p99Done = true
+				if ex := bk.Slowest; ex != nil {
+					fmt.Fprintf(b, " # {handshake=\"%d\"} %g %.3f", ex.Index, ex.Ms, float64(ex.At.UnixNano())/1e9)
+				}
+			}
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(b, "%s_sum{%s} %g\n", name, labels(r), r.TLS.Mean*float64(total))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels(r), total)
+	}
+}
+
+// csvCell 让以 = + - @ 开头的文本（如 targets 文件中的异常主机名）在电子表格中不被当作公式
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeCSVSummary 把每个目标（-repeat 时每轮）的汇总写成一行 CSV，是 -csv 逐样本输出的汇总版。
+// 某阶段没有成功样本时该阶段的列留空；样本不足 p999MinSamples 时 p999 列留空。
+func writeCSVSummary(path string, reports []*jsonReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	stages := []string{"tcp", "tls", "total"}
+	columns := []string{"min", "p50", "p90", "p95", "p99", "p999", "max", "mean", "stdev"}
+	header := []string{"host", "port", "sni", "unix", "run", "count", "successful", "errors"}
+	for _, stage := range stages {
+		for _, c := range columns {
+			header = append(header, stage+"_"+c+"_ms")
+		}
+	}
+	w.Write(header)
+	for _, r := range reports {
+		row := []string{csvCell(r.Host), strconv.Itoa(r.Port), csvCell(r.SNI), csvCell(r.Unix), "",
+			strconv.Itoa(r.Count), strconv.Itoa(r.Successful), strconv.Itoa(r.Errors)}
+		if r.Unix != "" {
+			row[1] = ""
+		}
+		if r.Run > 0 {
+			row[4] = strconv.Itoa(r.Run)
+		}
+		for _, s := range []Stats{r.TCP, r.TLS, r.Total} {
+			values := []float64{s.Min, s.P50, s.P90, s.P95, s.P99, s.P999, s.Max, s.Mean, s.Stdev}
+			for i, v := range values {
+				if s.Count == 0 || (columns[i] == "p999" && s.Count < p999MinSamples) {
+					row = append(row, "")
+				} else {
+					row = append(row, strconv.FormatFloat(v, 'f', 3, 64))
+				}
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadBaseline 读取之前 -json 输出的结果
+func loadBaseline(path string) (*jsonReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if report.TLS.Count == 0 {
+		return nil, fmt.Errorf("%s: baseline has no TLS samples", path)
+	}
+	return &report, nil
+}
+
+// Rust 版本（src/bin/tls_bench.rs）只接受 <host> <port> [count]，以下参数在其中写死
+const (
+	rustWarmup    = 3
+	rustDelay     = 50 * time.Millisecond
+	rustParityPct = 10.0 // TLS p50 相差不超过该百分比视为持平，与 Rust 版本的对比说明一致
+)
+
+// runRust 运行 Rust 版本并解析其文本报告。全部握手失败时 Rust 版本仍以 0 退出，
+// 只在 stderr 打印原因，这里把它作为错误返回
+func runRust(ctx context.Context, bin, host string, port, count int) (*jsonReport, error) {
+	cmd := exec.CommandContext(ctx, bin, host, strconv.Itoa(port), strconv.Itoa(count))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s not found; build it with: cargo build --release --bin tls_bench", bin)
+		}
+		if last := lastLine(stderr.String()); last != "" {
+			return nil, fmt.Errorf("%w: %s", err, last)
+		}
+		return nil, err
+	}
+	report, err := parseRustText(stdout.String())
+	if err != nil {
+		return nil, err
+	}
+	if report.Successful == 0 {
+		if last := lastLine(stderr.String()); last != "" {
+			return nil, fmt.Errorf("no successful handshakes (%s)", last)
+		}
+		return nil, errors.New("no successful handshakes")
+	}
+	return report, nil
+}
+
+// lastLine 返回 s 中最后一个非空行，用于在错误信息中附上子进程的 stderr
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// parseRustText 从 Rust 版本的文本报告中取出 -compare-go-rust 用到的统计量。
+// 进度行以 \r 覆盖，只取每行最后一个 \r 之后的部分。没有成功握手时 Rust 版本不输出
+// Results 部分，此时按头部的 Count 返回 Successful 为 0 的结果。
+func parseRustText(s string) (*jsonReport, error) {
+	report := &jsonReport{Tool: "rust", Unit: "ms"}
+	var cur *Stats
+	results := false
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+			line = line[i+1:]
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "TLS Library":
+			report.Library = value
+		case key == "Count":
+			report.Count, _ = strconv.Atoi(value)
+		case key == "Successful":
+			ok, count, _ := strings.Cut(value, "/")
+			report.Successful, _ = strconv.Atoi(ok)
+			report.Count, _ = strconv.Atoi(count)
+			results = true
+		case key == "Errors":
+			report.Errors, _ = strconv.Atoi(value)
+		case key == "TCP Connection Latency":
+			cur = &report.TCP
+		case strings.HasPrefix(key, "TLS Handshake Latency"):
+			cur = &report.TLS
+		case key == "Total (TCP + TLS)":
+			cur = &report.Total
+		case cur != nil && value != "":
+			v, err := strconv.ParseFloat(strings.TrimSuffix(value, "ms"), 64)
+			if err != nil {
+				continue // 如 "p90→p99 gap"
+			}
+			switch key {
+			case "min":
+				cur.Min = v
+			case "p50":
+				cur.P50 = v
+			case "p90":
+				cur.P90 = v
+			case "p99":
+				cur.P99 = v
+			case "max":
+				cur.Max = v
+			case "mean":
+				cur.Mean = v
+			case "stdev":
+				cur.Stdev = v
+			}
+		default:
+			cur = nil
+		}
+	}
+	if report.Count == 0 {
+		return nil, errors.New("output has no results (not the Rust tls_bench?)")
+	}
+	if !results {
+		report.Errors = report.Count
+	}
+	for _, s := range []*Stats{&report.TCP, &report.TLS, &report.Total} {
+		if s.Max > 0 {
+			s.Count = report.Successful
+		}
+	}
+	return report, nil
+}
+
+// printRustComparison 并排打印 Go 与 Rust 的统计量（delta 为 Rust 相对 Go），
+// 并按 TLS p50 给出结论：相差不超过 rustParityPct 视为持平
+func printRustComparison(w io.Writer, goReport, rustReport *jsonReport) {
+	fmt.Fprintf(w, "=== Go vs Rust (%s vs %s) ===\n", goReport.Library, rustReport.Library)
+	fmt.Fprintf(w, "Successful: Go %d/%d, Rust %d/%d\n", goReport.Successful, goReport.Count, rustReport.Successful, rustReport.Count)
+	block := func(title string, g, r Stats) {
+		fmt.Fprintln(w, title)
+		fmt.Fprintf(w, "  %-6s %*s %*s %*s\n", "", unit.col(10), "go", unit.col(10), "rust", unit.col(10), "delta")
+		rows := []struct {
+			name string
+			g, r float64
+		}{
+			{"min", g.Min, r.Min},
+			{"p50", g.P50, r.P50},
+			{"p90", g.P90, r.P90},
+			{"p99", g.P99, r.P99},
+			{"max", g.Max, r.Max},
+			{"mean", g.Mean, r.Mean},
+			{"stdev", g.Stdev, r.Stdev},
+		}
+		for _, row := range rows {
+			pct := ""
+			if row.g != 0 {
+				pct = fmt.Sprintf("%+8.1f%%", (row.r-row.g)/row.g*100.0)
+			}
+			fmt.Fprintf(w, "  %-6s %s %s %*s %9s\n", row.name+":", unit.f(8, row.g), unit.f(8, row.r), unit.col(10), unit.signed(row.r-row.g), pct)
+		}
+	}
+	if goReport.Unix == "" {
+		block("TCP Connection:", goReport.TCP, rustReport.TCP)
+	}
+	block("TLS Handshake:", goReport.TLS, rustReport.TLS)
+	block("Total (TCP + TLS):", goReport.Total, rustReport.Total)
+
+	g, r := goReport.TLS.P50, rustReport.TLS.P50
+	switch diff := (r - g) / g * 100.0; {
+	case math.Abs(diff) <= rustParityPct:
+		fmt.Fprintf(w, "✅ TLS p50 within %g%%: Rust %s vs Go %s (%+.1f%%)\n", rustParityPct, unit.f(0, r), unit.f(0, g), diff)
+	case diff > 0:
+		fmt.Fprintf(w, "⚠️  Rust TLS p50 is %.1f%% slower than Go (%s vs %s)\n", diff, unit.f(0, r), unit.f(0, g))
+	default:
+		fmt.Fprintf(w, "✅ Rust TLS p50 is %.1f%% faster than Go (%s vs %s)\n", -diff, unit.f(0, r), unit.f(0, g))
+	}
+}
+
+// printBaselineComparison 逐项打印当前结果与基线的差异。
+// TLS 或总延迟的 p50/p99 升幅超过 threshold（百分比）时标记 ⚠️ 并返回 true。
+func printBaselineComparison(w io.Writer, baseline *jsonReport, tcpStats, tlsStats, totalStats Stats, threshold float64) bool {
+	printBaselineHeader(w, baseline, threshold)
+
+	regressed := false
+	block := func(title string, gated bool, cur, base Stats) {
+		fmt.Fprintln(w, title)
+		fmt.Fprintf(w, "  %-6s %*s %*s %9s\n", "", unit.col(10), "current", unit.col(10), "baseline", "delta")
+		rows := []struct {
+			name      string
+			cur, base float64
+			gate      bool
+		}{
+			{"min", cur.Min, base.Min, false},
+			{"p50", cur.P50, base.P50, gated},
+			{"p90", cur.P90, base.P90, false},
+			{"p95", cur.P95, base.P95, false},
+			{"p99", cur.P99, base.P99, gated},
+			{"max", cur.Max, base.Max, false},
+			{"mean", cur.Mean, base.Mean, false},
+		}
+		for _, r := range rows {
+			delta := 0.0
+			if r.base != 0 {
+				delta = (r.cur - r.base) / r.base * 100.0
+			}
+			mark := ""
+			if r.gate && delta > threshold {
+				mark = "  ⚠️  regression"
+				regressed = true
+			}
+			fmt.Fprintf(w, "  %-6s %s %s %+8.1f%%%s\n", r.name+":", unit.f(8, r.cur), unit.f(8, r.base), delta, mark)
+		}
+	}
+	block("TCP Connection:", false, tcpStats, baseline.TCP)
+	block("TLS Handshake:", true, tlsStats, baseline.TLS)
+	block("Total (TCP + TLS):", true, totalStats, baseline.Total)
+
+	if regressed {
+		fmt.Fprintf(w, "❌ Regression beyond %.1f%% detected\n", threshold)
+	} else {
+		fmt.Fprintln(w, "✅ No regression beyond threshold")
+	}
+	return regressed
+}
+
+func printBaselineHeader(w io.Writer, baseline *jsonReport, threshold float64) {
+	fmt.Fprintf(w, "=== Baseline Comparison (%s, regression threshold %.1f%%) ===\n",
+		net.JoinHostPort(baseline.Host, strconv.Itoa(baseline.Port)), threshold)
+}
+
+// target 是一个待测的 host:port
+type target struct {
+	Host string
+	Port int
+	SNI  string // -sni-list 展开的 SNI；拨号目标不变，为空时使用 -sni 或 host
+	Unix string // unix://<path> 目标的套接字路径，此时 Host 为空、Port 为 0
+}
+
+func (t target) String() string {
+	if t.Unix != "" {
+		return "unix://" + t.Unix
+	}
+	if t.SNI != "" {
+		return net.JoinHostPort(t.Host, strconv.Itoa(t.Port)) + " (SNI " + t.SNI + ")"
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// parseSNIList 解析 -sni-list：逗号分隔的名称，或 @file（每行一个，允许 # 注释）。重复的名称只保留一个。
+func parseSNIList(s string) ([]string, error) {
+	var fields []string
+	if path, ok := strings.CutPrefix(s, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			fields = append(fields, line)
+		}
+	} else {
+		fields = strings.Split(s, ",")
+	}
+	var names []string
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" && !slices.Contains(names, f) {
+			names = append(names, f)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no SNI names given")
+	}
+	return names, nil
+}
+
+// sniFindings 对比 -sni-list 各 SNI 的结果：证书与多数 SNI 不同，或 TLS p50 比各 SNI p50 的中位数
+// 高出 threshold 百分比以上的 SNI 各给出一条说明；全部失败的 SNI 也会列出。
+func sniFindings(reports []*jsonReport, threshold float64) []string {
+	certs := make(map[string]int)
+	var p50s []float64
+	for _, r := range reports {
+		if r.Successful == 0 {
+			continue
+		}
+		p50s = append(p50s, r.TLS.P50)
+		if r.Cert != nil {
+			certs[r.Cert.Fingerprint]++
+		}
+	}
+	common, commonCount := "", 0
+	for fp, n := range certs {
+		if n > commonCount || n == commonCount && fp < common {
+			common, commonCount = fp, n
+		}
+	}
+	median := 0.0
+	if len(p50s) > 0 {
+		median = percentile(slices.Sorted(slices.Values(p50s)), 0.5)
+	}
+
+	var findings []string
+	for _, r := range reports {
+		switch {
+		case r.Successful == 0:
+			findings = append(findings, fmt.Sprintf("%s: all handshakes failed", r.SNI))
+			continue
+		case r.Cert != nil && r.Cert.Fingerprint != common:
+			findings = append(findings, fmt.Sprintf("%s: serves a different certificate (%s, issuer %s)", r.SNI, r.Cert.Subject, r.Cert.Issuer))
+		}
+		if median > 0 && r.TLS.P50 > median*(1+threshold/100) {
+			findings = append(findings, fmt.Sprintf("%s: TLS p50 %s is %.1f%% above the median across SNI names (%s)",
+				r.SNI, unit.f(0, r.TLS.P50), (r.TLS.P50-median)/median*100.0, unit.f(0, median)))
+		}
+	}
+	return findings
+}
+
+// edgeSpread 在 -each-ip 的各地址中按 Total p50（TCP + TLS，包含路由差异）找出最快和最慢的地址，
+// 并返回全部握手失败的地址；没有成功的地址时 fastest 和 slowest 为 nil
+func edgeSpread(reports []*jsonReport) (fastest, slowest *jsonReport, failed []*jsonReport) {
+	for _, r := range reports {
+		switch {
+		case r.Successful == 0:
+			failed = append(failed, r)
+		case fastest == nil:
+			fastest, slowest = r, r
+		case r.Total.P50 < fastest.Total.P50:
+			fastest = r
+		case r.Total.P50 > slowest.Total.P50:
+			slowest = r
+		}
+	}
+	return fastest, slowest, failed
+}
+
+// printEdgeComparison 输出 -each-ip 最快、最慢地址的对比；两者相差超过 threshold 百分比时给出警告
+func printEdgeComparison(w io.Writer, reports []*jsonReport, threshold float64) {
+	fmt.Fprintln(w, "=== Per-IP Comparison ===")
+	fastest, slowest, failed := edgeSpread(reports)
+	for _, r := range failed {
+		fmt.Fprintf(w, "⚠️  %s: all handshakes failed\n", r.Host)
+	}
+	if fastest == nil {
+		return
+	}
+	fmt.Fprintf(w, "Fastest: %s (total p50 %s, TCP p50 %s, TLS p50 %s)\n",
+		fastest.Host, unit.f(0, fastest.Total.P50), unit.f(0, fastest.TCP.P50), unit.f(0, fastest.TLS.P50))
+	if slowest == fastest {
+		return
+	}
+	spread := (slowest.Total.P50 - fastest.Total.P50) / fastest.Total.P50 * 100
+	fmt.Fprintf(w, "Slowest: %s (total p50 %s, TCP p50 %s, TLS p50 %s, %+.1f%%)\n",
+		slowest.Host, unit.f(0, slowest.Total.P50), unit.f(0, slowest.TCP.P50), unit.f(0, slowest.TLS.P50), spread)
+	if spread > threshold {
+		fmt.Fprintf(w, "⚠️  Addresses differ by more than %.0f%%: the edges are not equivalent (routing asymmetry or uneven load)\n", threshold)
+	} else {
+		fmt.Fprintf(w, "✅ All addresses within %.0f%% of the fastest\n", threshold)
+	}
+}
+
+// parseTarget 解析 host:port（IPv6 写作 [::1]:443）或 unix://<path>
+func parseTarget(s string) (target, error) {
+	if path, ok := strings.CutPrefix(s, "unix://"); ok {
+		if path == "" {
+			return target{}, fmt.Errorf("missing socket path in %q", s)
+		}
+		return target{Unix: path}, nil
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return target{}, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return target{}, fmt.Errorf("invalid port in %q", s)
+	}
+	if host == "" {
+		return target{}, fmt.Errorf("missing host in %q", s)
+	}
+	return target{Host: host, Port: port}, nil
+}
+
+// readTargets 逐行读取目标列表：每行 host:port、host,port 或 unix://<path>，忽略空行和 # 注释。
+// 无法解析的行不会中断读取，而是带行号收集到 errs 中。
+func readTargets(r io.Reader, name string) (targets []target, errs []error, err error) {
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if host, port, ok := strings.Cut(line, ","); ok && !strings.HasPrefix(line, "unix://") {
+			line = net.JoinHostPort(strings.TrimSpace(host), strings.TrimSpace(port))
+		}
+		t, perr := parseTarget(line)
+		if perr != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", name, lineNo, perr))
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets, errs, sc.Err()
+}
+
+// target 返回报告对应的目标
+func (r *jsonReport) target() target {
+	return target{Host: r.Host, Port: r.Port, SNI: r.SNI, Unix: r.Unix}
+}
+
+// printTargetSummary 打印多目标运行的排名表，按 TLS p50（-connect-only 时按 TCP p50）从低到高排序，
+// 全部失败的目标排在最后
+func printTargetSummary(w io.Writer, reports []*jsonReport) {
+	phase, stats := "TLS", func(r *jsonReport) Stats { return r.TLS }
+	if reports[0].ConnectOnly {
+		phase, stats = "TCP", func(r *jsonReport) Stats { return r.TCP }
+	}
+	ranked := append([]*jsonReport(nil), reports...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if (ranked[i].Successful == 0) != (ranked[j].Successful == 0) {
+			return ranked[j].Successful == 0
+		}
+		return stats(ranked[i]).P50 < stats(ranked[j]).P50
+	})
+
+	width := len("Target")
+	for _, r := range ranked {
+		width = max(width, len(r.target().String()))
+	}
+
+	fmt.Fprintf(w, "=== Summary (ranked by %s p50) ===\n", phase)
+	col := unit.col(10)
+	fmt.Fprintf(w, "  %-4s %-*s %9s %*s %*s %*s %*s %7s\n", "#", width, "Target", "OK", col, phase+" p50", col, phase+" p90", col, phase+" p99", col, "Total p50", phase+" CV")
+	for i, r := range ranked {
+		name := r.target().String()
+		ok := fmt.Sprintf("%d/%d", r.Successful, r.Count)
+		if r.Successful == 0 {
+			fmt.Fprintf(w, "  %-4d %-*s %9s %*s\n", i+1, width, name, ok, col, "failed")
+			continue
+		}
+		s := stats(r)
+		fmt.Fprintf(w, "  %-4d %-*s %9s %s %s %s %s %7.3f\n",
+			i+1, width, name, ok, unit.f(8, s.P50), unit.f(8, s.P90), unit.f(8, s.P99), unit.f(8, r.Total.P50), s.CV)
+	}
+}
+
+// printVersionBreakdown 按协商到的 TLS 版本分组列出 TLS 握手统计（混有多个版本时才调用）。
+// 占少数的版本中位数已超过整体 p99 时，整体尾部基本由它构成，单独提示。
+func printVersionBreakdown(w io.Writer, byVersion map[string]Stats, overall Stats) {
+	names := make([]string, 0, len(byVersion))
+	total := 0
+	for name, s := range byVersion {
+		names = append(names, name)
+		total += s.Count
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "TLS Handshake Latency by Version:")
+	col := unit.col(10)
+	fmt.Fprintf(w, "  %-8s %7s %7s %*s %*s %*s %*s\n", "Version", "Count", "Share", col, "p50", col, "p90", col, "p99", col, "max")
+	for _, name := range names {
+		s := byVersion[name]
+		fmt.Fprintf(w, "  %-8s %7d %6.1f%% %s %s %s %s\n", name, s.Count, float64(s.Count)/float64(total)*100.0,
+			unit.f(8, s.P50), unit.f(8, s.P90), unit.f(8, s.P99), unit.f(8, s.Max))
+	}
+	for _, name := range names {
+		if s := byVersion[name]; s.Count*2 < total && s.P50 >= overall.P99 {
+			fmt.Fprintf(w, "  ⚠️  %s handshakes (%d/%d) are slower than the overall p99 %s - they make up the tail\n", name, s.Count, total, unit.f(0, overall.P99))
+		}
+	}
+}
+
+// trendDeadBand 是 -repeat 趋势箭头的死区（百分比），相对上一轮的变化不超过它时显示 →
+const trendDeadBand = 3.0
+
+// trendArrow 返回 cur 相对 prev 的趋势箭头和变化百分比（保留一位小数，与显示一致）
+func trendArrow(prev, cur float64) (string, float64) {
+	if prev <= 0 {
+		return "→", 0
+	}
+	change := math.Round((cur-prev)/prev*1000) / 10
+	switch {
+	case change > trendDeadBand:
+		return "↑", change
+	case change < -trendDeadBand:
+		return "↓", change
+	}
+	return "→", change
+}
+
+// printTrend 打印 -repeat 时本轮 TLS / Total 各分位数相对上一轮的趋势，两轮都有成功握手时才调用
+func printTrend(w io.Writer, prev, cur *jsonReport) {
+	percentiles := []struct {
+		name string
+		v    func(Stats) float64
+	}{
+		{"p50", func(s Stats) float64 { return s.P50 }},
+		{"p90", func(s Stats) float64 { return s.P90 }},
+		{"p95", func(s Stats) float64 { return s.P95 }},
+		{"p99", func(s Stats) float64 { return s.P99 }},
+	}
+	fmt.Fprintf(w, "Trend vs run %d (↑/↓ beyond ±%g%%):\n", prev.Run, trendDeadBand)
+	for _, phase := range []struct {
+		name      string
+		prev, cur Stats
+	}{{"TLS", prev.TLS, cur.TLS}, {"Total", prev.Total, cur.Total}} {
+		parts := make([]string, 0, len(percentiles)+1)
+		for _, p := range percentiles {
+			arrow, change := trendArrow(p.v(phase.prev), p.v(phase.cur))
+			parts = append(parts, fmt.Sprintf("%s %s %s %+.1f%%", p.name, unit.f(0, p.v(phase.cur)), arrow, change))
+		}
+		if phase.prev.Count >= p999MinSamples && phase.cur.Count >= p999MinSamples {
+			arrow, change := trendArrow(phase.prev.P999, phase.cur.P999)
+			parts = append(parts, fmt.Sprintf("p99.9 %s %s %+.1f%%", unit.f(0, phase.cur.P999), arrow, change))
+		}
+		fmt.Fprintf(w, "  %-6s %s\n", phase.name+":", strings.Join(parts, "   "))
+	}
+}
+
+// runAggregate 是 -repeat 下同一目标各轮结果的汇总
+type runAggregate struct {
+	Runs       int   // 有成功握手、参与汇总的轮数
+	TLSMeans   Stats // 各轮 TLS 均值的分布
+	TotalMeans Stats // 各轮 Total 均值的分布
+	// WithinStdev 是各轮 TLS stdev 的平均值（轮内抖动），与 TLSMeans.Stdev（轮间漂移）对比
+	WithinStdev float64
+	// Percentiles 是各轮 TLS/Total 的 p50、p90、p99 本身在各轮之间的波动
+	Percentiles []percentileSpread
+}
+
+// percentileSpread 是一个分位数在各轮之间的最小、平均、最大值；
+// Spread 为 (max - min) / mean 的百分比，mean 为 0 时为 0
+type percentileSpread struct {
+	Name           string
+	Min, Mean, Max float64
+	Spread         float64
+}
+
+// spreadOf 计算 values（各轮同一分位数）的 percentileSpread
+func spreadOf(name string, values []float64) percentileSpread {
+	s := percentileSpread{Name: name, Min: slices.Min(values), Max: slices.Max(values)}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(values))
+	if s.Mean > 0 {
+		s.Spread = (s.Max - s.Min) / s.Mean * 100
+	}
+	return s
+}
+
+// aggregateRuns 汇总 runs 中有成功握手的各轮，全部失败时 ok 为 false
+func aggregateRuns(runs []*jsonReport) (agg runAggregate, ok bool) {
+	var tlsMeans, totalMeans []float64
+	var stdevSum float64
+	var succeeded []*jsonReport
+	for _, r := range runs {
+		if r.Successful == 0 {
+			continue
+		}
+		tlsMeans = append(tlsMeans, r.TLS.Mean)
+		totalMeans = append(totalMeans, r.Total.Mean)
+		stdevSum += r.TLS.Stdev
+		succeeded = append(succeeded, r)
+	}
+	if len(tlsMeans) == 0 {
+		return agg, false
+	}
+	agg = runAggregate{
+		Runs:        len(tlsMeans),
+		TLSMeans:    calculateStats(tlsMeans),
+		TotalMeans:  calculateStats(totalMeans),
+		WithinStdev: stdevSum / float64(len(tlsMeans)),
+	}
+	for _, m := range []struct {
+		name string
+		get  func(r *jsonReport) float64
+	}{
+		{"TLS p50", func(r *jsonReport) float64 { return r.TLS.P50 }},
+		{"TLS p90", func(r *jsonReport) float64 { return r.TLS.P90 }},
+		{"TLS p99", func(r *jsonReport) float64 { return r.TLS.P99 }},
+		{"Total p50", func(r *jsonReport) float64 { return r.Total.P50 }},
+		{"Total p90", func(r *jsonReport) float64 { return r.Total.P90 }},
+		{"Total p99", func(r *jsonReport) float64 { return r.Total.P99 }},
+	} {
+		values := make([]float64, len(succeeded))
+		for i, r := range succeeded {
+			values[i] = m.get(r)
+		}
+		agg.Percentiles = append(agg.Percentiles, spreadOf(m.name, values))
+	}
+	return agg, true
+}
+
+// printRepeatSummary 输出一个目标各轮的摘要和跨轮汇总；
+// 某个分位数跨轮的 spread 超过 unstable（百分比）时标记为不稳定
+func printRepeatSummary(w io.Writer, name string, runs []*jsonReport, unstable float64) {
+	fmt.Fprintf(w, "=== Repeat Summary: %s (%d runs) ===\n", name, len(runs))
+	col := unit.col(10)
+	fmt.Fprintf(w, "  %-4s %9s %*s %*s %*s %*s\n", "Run", "OK", col, "TLS mean", col, "TLS p50", col, "TLS p99", col, "Total mean")
+	for _, r := range runs {
+		ok := fmt.Sprintf("%d/%d", r.Successful, r.Count)
+		if r.Successful == 0 {
+			fmt.Fprintf(w, "  %-4d %9s %*s\n", r.Run, ok, col, "failed")
+			continue
+		}
+		fmt.Fprintf(w, "  %-4d %9s %s %s %s %s\n",
+			r.Run, ok, unit.f(8, r.TLS.Mean), unit.f(8, r.TLS.P50), unit.f(8, r.TLS.P99), unit.f(8, r.Total.Mean))
+	}
+
+	agg, ok := aggregateRuns(runs)
+	if !ok {
+		fmt.Fprintln(w, "  no successful runs")
+		return
+	}
+	fmt.Fprintf(w, "  Across %d runs (per-run means):\n", agg.Runs)
+	fmt.Fprintf(w, "    TLS mean:   p50 %s  p99 %s  range %s  stdev %s\n",
+		unit.f(0, agg.TLSMeans.P50), unit.f(0, agg.TLSMeans.P99), unit.f(0, agg.TLSMeans.Max-agg.TLSMeans.Min), unit.f(0, agg.TLSMeans.Stdev))
+	fmt.Fprintf(w, "    Total mean: p50 %s  p99 %s  range %s  stdev %s\n",
+		unit.f(0, agg.TotalMeans.P50), unit.f(0, agg.TotalMeans.P99), unit.f(0, agg.TotalMeans.Max-agg.TotalMeans.Min), unit.f(0, agg.TotalMeans.Stdev))
+	fmt.Fprintf(w, "  TLS jitter: within-run stdev %s (avg), between-run stdev of means %s\n",
+		unit.f(0, agg.WithinStdev), unit.f(0, agg.TLSMeans.Stdev))
+	if agg.Runs > 1 && agg.TLSMeans.Stdev > agg.WithinStdev {
+		fmt.Fprintln(w, "  ⚠️  run-to-run drift exceeds within-run jitter - results depend on when the run happened")
+	}
+	if agg.Runs < 2 {
+		return
+	}
+
+	fmt.Fprintf(w, "  Percentile stability across %d runs (spread = (max - min) / mean):\n", agg.Runs)
+	fmt.Fprintf(w, "    %-10s %*s %*s %*s %8s\n", "", col, "min", col, "mean", col, "max", "spread")
+	var flagged []string
+	for _, p := range agg.Percentiles {
+		fmt.Fprintf(w, "    %-10s %s %s %s %7.1f%%", p.Name, unit.f(8, p.Min), unit.f(8, p.Mean), unit.f(8, p.Max), p.Spread)
+		if p.Spread > unstable {
+			fmt.Fprint(w, "  unstable")
+			flagged = append(flagged, p.Name)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(flagged) > 0 {
+		fmt.Fprintf(w, "  ⚠️  %s vary by more than %g%% between runs - a single run's value is not trustworthy; raise -count or -repeat\n",
+			strings.Join(flagged, ", "), unstable)
+	} else {
+		fmt.Fprintf(w, "  ✅ All percentiles within %g%% across runs\n", unstable)
+	}
+}
+
+// printMarkdown 把一个目标的 TCP/TLS/Total 统计输出为 Markdown 表格，指标为行、分位数为列
+func printMarkdown(w io.Writer, r *jsonReport) {
+	fmt.Fprintf(w, "**TLS handshake benchmark** `%s` — %d handshakes (%d ok, %d errors), %s %s/%s\n\n",
+		r.target(), r.Count, r.Successful, r.Errors,
+		runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if r.Successful == 0 {
+		fmt.Fprintln(w, "_No successful handshakes._")
+		return
+	}
+
+	cols := []string{"min", "p50", "p90", "p95", "p99", "max", "mean", "stdev"}
+	fmt.Fprintf(w, "| %s |", unit.Name)
+	for _, c := range cols {
+		fmt.Fprintf(w, " %s |", c)
+	}
+	fmt.Fprint(w, "\n|---|")
+	for range cols {
+		fmt.Fprint(w, "---:|")
+	}
+	fmt.Fprintln(w)
+
+	rows := []struct {
+		name string
+		s    Stats
+	}{
+		{"TCP", r.TCP},
+		{"TLS", r.TLS},
+		{"Total", r.Total},
+	}
+	for _, row := range rows {
+		s := row.s
+		fmt.Fprintf(w, "| %s |", row.name)
+		for _, v := range []float64{s.Min, s.P50, s.P90, s.P95, s.P99, s.Max, s.Mean, s.Stdev} {
+			fmt.Fprintf(w, " %.*f |", unit.Prec, v*unit.PerMs)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// cryptoMode 描述 crypto/tls 的底层实现：FIPS 140-3 模式（GODEBUG=fips140=on）和 boringcrypto 实验构建
+func cryptoMode() string {
+	boring := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "GOEXPERIMENT" && strings.Contains(s.Value, "boringcrypto") {
+				boring = true
+			}
+		}
+	}
+	mode := "FIPS 140-3 mode off"
+	if fips140.Enabled() {
+		mode = "FIPS 140-3 mode ON"
+	}
+	if boring {
+		mode += ", boringcrypto"
+	}
+	return mode
+}
+
+// usage 打印用法和全部选项。flag 包在遇到第一个非选项参数时停止解析，
+// 因此选项必须写在 host/port 之前。
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s [options] <host> <port> [count]\n", os.Args[0])
+	fmt.Fprintf(w, "       %s [options] <host:port|unix://path> [...]\n", os.Args[0])
+	fmt.Fprintf(w, "Example: %s -concurrency 4 example.com 443 100\n", os.Args[0])
+	fmt.Fprintf(w, "Example: %s -count 50 a.example.com:443 b.example.com:443\n", os.Args[0])
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Options:")
+	flag.PrintDefaults()
+}
+
+// loadCertPool 从 PEM 文件加载 CA 证书池
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return pool, nil
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listFlag 是可重复指定的字符串选项
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// flagSet 判断命令行是否显式指定了某个选项
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// boolCount 返回为 true 的参数个数，用于检查互斥选项
+func boolCount(flags ...bool) int {
+	n := 0
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
+
+// usageErrorf 报告命令行参数错误并以状态码 2 退出（与 flag 包一致）
+func usageErrorf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	fmt.Fprintf(os.Stderr, "Run '%s -h' for usage.\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run 执行一次完整的基准测试并返回进程退出码
+func run() int {
+	countFlag := flag.Int("count", 100, "number of measured `handshakes` (may also be given as the third positional argument)")
+	jsonOutput := flag.Bool("json", false, "print results as a single JSON object on stdout")
+	var verbose, quiet bool
+	flag.BoolVar(&verbose, "v", false, "debug logging: per-handshake negotiated parameters and retry attempts on stderr")
+	flag.BoolVar(&verbose, "verbose", false, "same as -v")
+	flag.BoolVar(&quiet, "q", false, "print results only: no header, progress or warmup output")
+	flag.BoolVar(&quiet, "quiet", false, "same as -q")
+	compareRust := flag.Bool("compare-go-rust", false, "after the Go run, run the Rust tls_bench (-rust-bin) against the same target and count and print a side-by-side comparison")
+	rustBin := flag.String("rust-bin", "target/release/tls_bench", "`path` to the Rust tls_bench binary for -compare-go-rust")
+	baselinePath := flag.String("baseline", "", "compare against a previous -json report at `path` and exit 1 on regression")
+	regressThreshold := flag.Float64("regress-threshold", 10, "`percent` increase of TLS/total p50 or p99 over the baseline counted as a regression")
+	var warn warnThresholds
+	flag.Float64Var(&warn.Stdev, "warn-stdev", 10, "warn when TLS handshake stdev exceeds `ms`")
+	flag.Float64Var(&warn.Gap, "warn-gap", 10, "warn when the TLS p90→p99 gap exceeds `ms`")
+	flag.Float64Var(&warn.P50, "warn-p50", 30, "warn when TLS handshake p50 exceeds `ms`")
+	failOnWarn := flag.Bool("fail-on-warn", false, "exit 1 if any analysis warning (stdev, p90→p99 gap, p50) fires")
+	maxP50 := flag.Float64("max-p50", 0, "exit 1 if TLS handshake p50 exceeds `ms` (0 disables)")
+	maxP99 := flag.Float64("max-p99", 0, "exit 1 if TLS handshake p99 exceeds `ms` (0 disables)")
+	sloMs := flag.Float64("slo-ms", 0, "report the share of handshakes whose total latency (TCP + TLS) is within `ms`; failed handshakes count as misses (0 disables)")
+	sloTarget := flag.Float64("slo-target", 0, "exit 1 if fewer than `percent` of handshakes meet -slo-ms (0 only reports compliance)")
+	unitFlag := flag.String("unit", "ms", "`unit` for latencies in the text report: ms, us or ns (JSON, CSV and Prometheus output stay in ms)")
+	precision := flag.Int("precision", 0, "`N` decimal places for latencies in the text report (default 2 for ms, 1 for us, 0 for ns)")
+	trim := flag.Bool("trim", false, "also print TLS handshake stats with 1.5×IQR outliers removed")
+	hist := flag.Bool("hist", false, "print an ASCII histogram of TLS handshake latency")
+	histBuckets := flag.Int("hist-buckets", 20, "number of `buckets` for -hist")
+	bucketsFlag := flag.String("buckets", "", "comma-separated TLS latency bucket upper `bounds` in ms (e.g. 1,2,5,10,20,50,100); prints count, share and cumulative share per bucket instead of the equal-width -hist, and works with -hdr and -max-samples")
+	maxSamples := flag.Int("max-samples", 0, "keep at most `N` latencies per metric; beyond that reservoir-sample so the retained set stays a uniform random sample of all handshakes (bounds memory on long -duration runs; 0 = keep all)")
+	hdrDigits := flag.Int("hdr", 0, "keep the main run's latencies in HDR histograms with `digits` significant digits (1-5) instead of every sample, so memory stays fixed on long runs (0 = exact)")
+	repeat := flag.Int("repeat", 1, "run the whole benchmark `N` times and summarize run-to-run variance")
+	unstableSpread := flag.Float64("unstable-spread", 20, "with -repeat, flag a p50/p90/p99 as unstable when its (max - min) / mean across runs exceeds `percent`")
+	jsonlPath := flag.String("append-jsonl", "", "append one summary JSON line per target and run (RFC3339 timestamp, host, all percentiles) to `path`, creating it if missing")
+	csvSummaryPath := flag.String("csv-summary", "", "write one CSV row per target (and run with -repeat) with host, port, count, errors and every TCP/TLS/total percentile to `path`")
+	promPath := flag.String("prom", "", "write stats in Prometheus textfile-collector format to `path` (atomically replaced)")
+	promExemplars := flag.Bool("prom-exemplars", false, "with -prom, write OpenMetrics text instead and add a TLS latency histogram (the -buckets bounds, default 1,2,5,...,5000ms) whose p99 bucket carries an exemplar pointing at its slowest handshake (index and timestamp); for scrapers with exemplar support, otherwise keep plain -prom")
+	mdOutput := flag.Bool("md", false, "print TCP/TLS/Total stats as a Markdown table on stdout (report goes to stderr)")
+	ndjsonOutput := flag.Bool("ndjson", false, "stream one JSON object per completed handshake to stdout as it finishes (report goes to stderr)")
+	rawPath := flag.String("raw", "", "write the raw tcp/tls/total duration of every successful handshake as CSV to `path` (adds a worker column with -concurrency)")
+	csvPath := flag.String("csv", "", "write per-handshake samples as CSV to `path` (\"-\" for stdout); failed handshakes get an error column")
+	minVersionFlag := flag.String("min-version", "", "minimum TLS `version` to offer (1.0, 1.1, 1.2, 1.3)")
+	maxVersionFlag := flag.String("max-version", "", "maximum TLS `version` to offer (1.0, 1.1, 1.2, 1.3)")
+	resume := flag.Bool("resume", false, "share a session cache and report full and resumed handshakes separately")
+	duration := flag.Duration("duration", 0, "keep measuring for this long (e.g. 30s) instead of a fixed -count")
+	warmupCount := flag.Int("warmup", 3, "number of warmup `handshakes` excluded from the stats (0 skips warmup)")
+	coldStart := flag.Bool("warmup-discard-outliers", false, "also drop leading measured samples until the sliding median of 10 TLS times settles within 10% of the steady-state median (cold DNS/ARP/route caches)")
+	delay := flag.Duration("delay", 50*time.Millisecond, "per-worker sleep between handshakes to avoid server rate limiting (0 disables)")
+	noDelay := flag.Bool("no-delay", false, "shorthand for -delay 0")
+	concurrency := flag.Int("concurrency", 1, "number of parallel `workers` sharing the handshake count")
+	ipv4Only := flag.Bool("4", false, "connect over IPv4 only")
+	ipv6Only := flag.Bool("6", false, "connect over IPv6 only")
+	injectRTT := flag.Duration("inject-rtt", 0, "add `delay` to every round trip at the application layer (no root or tc needed) and compare with a direct run, e.g. 50ms")
+	injectJitter := flag.Duration("inject-jitter", 0, "standard deviation of the -inject-rtt delay, drawn per round trip (normal, clipped at 0)")
+	proxyProtocol := flag.String("proxy-protocol", "", "send a PROXY protocol `version` header (only v2) on each TCP connection before the TLS handshake, as a load balancer would")
+	proxyProtocolSrc := flag.String("proxy-protocol-src", "", "client `ip:port` to put in the PROXY protocol header (default: the local socket address)")
+	localAddr := flag.String("local-addr", "", "bind outgoing TCP connections to the source `IP or interface` (e.g. 192.0.2.10 or eth1) to compare uplinks on a multi-homed host")
+	dualStack := flag.Bool("dual", false, "race IPv6 and IPv4 (Happy Eyeballs) and report which family won")
+	ciphers := flag.String("ciphers", "", "comma-separated TLS 1.2 cipher `suites` to offer, e.g. TLS_RSA_WITH_AES_128_GCM_SHA256 (TLS 1.3 suites are not configurable)")
+	helloPadding := flag.Int("client-hello-padding", 0, "pad the ClientHello to `bytes` with dummy ALPN names (adds http/1.1 if -alpn is unset) and compare success rate and latency with an unpadded run (0 disables)")
+	alpn := flag.String("alpn", "", "comma-separated ALPN `protocols` to offer, e.g. h2,http/1.1")
+	selftest := flag.Bool("selftest", false, "benchmark an in-process TLS server on 127.0.0.1 instead of a target and check that the reported stats are internally consistent (exit 1 if not)")
+	insecure := flag.Bool("insecure", false, "skip certificate verification (DANGEROUS: for self-signed test endpoints only)")
+	maxChainDepth := flag.Int("max-chain-depth", 0, "count handshakes whose server certificate chain has more than `N` certificates as failures (deep chains add verification latency; 0 = no limit)")
+	memProfile := flag.String("memprofile", "", "after the run write a pprof allocation profile of the whole process to `path` (inspect with go tool pprof -sample_index=alloc_space)")
+	keyLogPath := flag.String("keylog", "", "append TLS session secrets in NSS key log format to `path` so Wireshark can decrypt a capture of the run (DEBUGGING ONLY: exposes session keys)")
+	caCert := flag.String("cacert", "", "verify the server against the PEM CA bundle at `path` instead of the system roots")
+	certFile := flag.String("cert", "", "PEM client certificate at `path` for mutual TLS (requires -key)")
+	keyFile := flag.String("key", "", "PEM private key at `path` for the -cert client certificate")
+	eachIP := flag.Bool("each-ip", false, "resolve the single target's hostname and benchmark every A/AAAA address separately (SNI and verification stay on the hostname), reporting the fastest and slowest address")
+	sniList := flag.String("sni-list", "", "benchmark the single target once per SNI `names` (comma-separated or @file) with the same dial address, flagging names that get a different certificate or a TLS p50 above -regress-threshold percent over the median")
+	sni := flag.String("sni", "", "send `name` as SNI instead of host (dialing still uses host; verification follows the SNI unless -insecure)")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "TCP connect timeout")
+	handshakeTimeout := flag.Duration("handshake-timeout", 10*time.Second, "TLS handshake timeout; a stalled handshake is recorded as an error (0 disables)")
+	abortOnCert := flag.Bool("abort-on-cert-error", false, "stop at the first certificate verification failure (including during warmup) and print the rejected certificate instead of counting it as an error; exit code 1")
+	failFast := flag.Int("fail-fast", 0, "abort a target after `N` consecutive failed handshakes and report the partial results with exit code 1 (0 disables)")
+	retries := flag.Int("retries", 0, "retry a failed handshake up to `N` times with exponential backoff before counting it as an error (cert, -max-chain-depth and TLS protocol failures are not retried)")
+	echFlag := flag.String("ech", "", "offer Encrypted Client Hello with the base64 ECHConfigList `config` (the HTTPS record's ech= value, or @file) and compare with a run without ECH")
+	groupsFlag := flag.String("groups", "", "comma-separated key exchange `groups` to offer in order, e.g. X25519 or P-256,X25519 (pin the same group as the Rust run for a fair comparison)")
+	pq := flag.Bool("pq", false, "offer only the hybrid post-quantum X25519MLKEM768 key exchange and compare with a classical X25519 run")
+	handshakeOnly := flag.Bool("handshake-only", false, "also run the same TLS client config against an in-process server over loopback and report it as the crypto-only (loopback) handshake cost, free of network round trips")
+	connectOnly := flag.Bool("connect-only", false, "only open the TCP connection (through any proxy) and close it without a TLS handshake; reports DNS and TCP latency only, works against non-TLS ports and ranks multiple targets by TCP p50")
+	seedFlag := flag.Uint64("seed", 0, "seed the random source used for -inject-jitter and -max-samples so identical runs are reproducible; the seed is always printed (default: a random seed)")
+	paired := flag.Bool("paired", false, "also run each iteration as a TCP-only connect immediately followed by a full TCP+TLS connect and report the paired difference as the TLS overhead, cancelling moment-to-moment network variance")
+	predial := flag.Bool("predial", false, fmt.Sprintf("also run the handshakes over TCP connections pre-dialed into a pool (up to %d, refilled in the background) and report TLS-only stats without TCP setup noise", predialMaxPool))
+	tfo := flag.Bool("tfo", false, "also run the handshakes over TCP Fast Open and compare with normal connects (Linux, build with tls_bench_tfo_linux.go)")
+	socks5 := flag.String("socks5", "", "dial through the SOCKS5 proxy at `[user:pass@]host:port`; the proxy resolves the target")
+	httpProxy := flag.String("http-proxy", "", "dial through an HTTP CONNECT tunnel via the proxy at `[user:pass@]host:port`")
+	chainFlag := flag.String("chain", "", "dial through a chain of proxies in order, e.g. socks5://a:1080,http://user:pass@b:8080; each hop's CONNECT is reported separately")
+	geoDB := flag.String("geodb", "", "annotate each target with the country/city of the connected IP from the offline MaxMind database at `path` (build with -tags geoip)")
+	geoOrigin := flag.String("geo-origin", "", "your own location as `lat,lon`; with -geodb also report the distance and light-in-fiber minimum RTT to each IP")
+	earlyData := flag.Bool("early-data", false, "with -quic, send an HTTP/3 GET for the -http path (default /) as 0-RTT early data and compare time to first response byte with the 1-RTT path (crypto/tls has no client 0-RTT over TCP)")
+	quicMode := flag.Bool("quic", false, "also measure QUIC 1-RTT and 0-RTT handshakes to an HTTP/3 endpoint (build with -tags quic)")
+	phases := flag.Bool("phases", false, "split each TLS handshake into approximate sub-phases (until ServerHello, server flight, VerifyConnection, until Finished) and report them separately")
+	reuse := flag.Int("reuse", 0, "after the benchmark send `N` keep-alive GET requests (the -http path, default /) over one TLS connection and report per-request latency apart from the handshake")
+	httpPath := flag.String("http", "", "after the handshake send GET `path` over HTTP/1.1 and measure time to first byte")
+	targetsFile := flag.String("targets-file", "", "read targets from `path`, one host:port or host,port per line (# comments allowed)")
+	var targetFlags listFlag
+	flag.Var(&targetFlags, "target", "benchmark `host:port` (repeatable; positional host:port arguments work too)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if boolCount(*jsonOutput, *csvPath == "-", *ndjsonOutput, *mdOutput) > 1 {
+		usageErrorf("only one of -json, -md, -csv - and -ndjson can write to stdout")
+	}
+
+	var baseline *jsonReport
+	if *baselinePath != "" {
+		b, err := loadBaseline(*baselinePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load -baseline: %v\n", err)
+			os.Exit(1)
+		}
+		baseline = b
+	}
+	u, ok := timeUnits[*unitFlag]
+	if !ok {
+		usageErrorf("invalid -unit %q (want ms, us or ns)", *unitFlag)
+	}
+	unit = u
+	seed := *seedFlag
+	if !flagSet("seed") {
+		seed = rand.Uint64()
+	}
+	seedRandom(seed)
+	if flagSet("precision") {
+		if *precision < 0 || *precision > 6 {
+			usageErrorf("-precision must be between 0 and 6")
+		}
+		unit.Wide = max(0, *precision-unit.Prec)
+		unit.Prec = *precision
+	}
+	if *histBuckets < 1 {
+		usageErrorf("-hist-buckets must be at least 1")
+	}
+	var bucketBounds []float64
+	if *bucketsFlag != "" {
+		if flagSet("hist-buckets") {
+			usageErrorf("-buckets and -hist-buckets are mutually exclusive")
+		}
+		bounds, err := parseBuckets(*bucketsFlag)
+		if err != nil {
+			usageErrorf("-buckets: %v", err)
+		}
+		bucketBounds = bounds
+	}
+	var promBounds []float64 // -prom-exemplars 直方图的上界，与 -buckets 的文本 / JSON 输出相互独立
+	if *promExemplars {
+		if *promPath == "" {
+			usageErrorf("-prom-exemplars requires -prom")
+		}
+		promBounds = bucketBounds
+		if promBounds == nil {
+			promBounds = defaultPromBuckets
+		}
+	}
+	if *reuse < 0 {
+		usageErrorf("-reuse must not be negative")
+	}
+	if *hdrDigits < 0 || *hdrDigits > 5 {
+		usageErrorf("-hdr must be between 1 and 5 significant digits (0 disables)")
+	}
+	if verbose && quiet {
+		usageErrorf("-v and -q cannot be combined")
+	}
+	diag.level = levelInfo
+	switch {
+	case verbose:
+		diag.level = levelDebug
+	case quiet:
+		diag.level = levelQuiet
+	}
+	if *hdrDigits > 0 && (*trim || *hist || *coldStart) {
+		usageErrorf("-trim, -hist and -warmup-discard-outliers need every sample and cannot be combined with -hdr")
+	}
+	switch {
+	case *maxSamples < 0:
+		usageErrorf("-max-samples must not be negative")
+	case *maxSamples > 0 && *hdrDigits > 0:
+		usageErrorf("-max-samples and -hdr are alternative ways to bound memory; pick one")
+	case *maxSamples > 0 && *coldStart:
+		usageErrorf("-warmup-discard-outliers needs every sample in order and cannot be combined with -max-samples")
+	}
+	if warn.Stdev < 0 || warn.Gap < 0 || warn.P50 < 0 {
+		usageErrorf("-warn-stdev, -warn-gap and -warn-p50 must not be negative")
+	}
+	if *maxP50 < 0 || *maxP99 < 0 {
+		usageErrorf("-max-p50 and -max-p99 must not be negative")
+	}
+	if *regressThreshold < 0 {
+		usageErrorf("-regress-threshold must not be negative")
+	}
+	if *sloMs < 0 || *sloTarget < 0 || *sloTarget > 100 {
+		usageErrorf("-slo-ms must not be negative and -slo-target must be between 0 and 100")
+	}
+	if *sloTarget > 0 && *sloMs == 0 {
+		usageErrorf("-slo-target needs -slo-ms")
+	}
+
+	var targets []target
+	for _, s := range targetFlags {
+		t, err := parseTarget(s)
+		if err != nil {
+			usageErrorf("invalid -target: %v", err)
+		}
+		targets = append(targets, t)
+	}
+	if *targetsFile != "" {
+		f, err := os.Open(*targetsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open -targets-file: %v\n", err)
+			os.Exit(1)
+		}
+		fileTargets, lineErrs, err := readTargets(f, *targetsFile)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read -targets-file: %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range lineErrs {
+			fmt.Fprintf(os.Stderr, "⚠️  Skipping invalid target: %v\n", e)
+		}
+		if len(fileTargets) == 0 {
+			usageErrorf("-targets-file %s contains no valid targets", *targetsFile)
+		}
+		targets = append(targets, fileTargets...)
+	}
+
+	// 位置参数有两种写法：旧的 <host> <port> [count]，或任意多个 host:port
+	legacyArgs := len(targets) == 0 && flag.NArg() > 0
+	if legacyArgs {
+		_, _, err := net.SplitHostPort(flag.Arg(0))
+		legacyArgs = err != nil && !strings.HasPrefix(flag.Arg(0), "unix://")
+	}
+	if legacyArgs {
+		if flag.NArg() < 2 || flag.NArg() > 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		port, err := strconv.Atoi(flag.Arg(1))
+		if err != nil || port < 1 || port > 65535 {
+			usageErrorf("invalid port %q", flag.Arg(1))
+		}
+		targets = append(targets, target{Host: flag.Arg(0), Port: port})
+
+		// 兼容旧用法：未指定 -count 时接受第三个位置参数
+		if flag.NArg() >= 3 {
+			if flagSet("count") {
+				usageErrorf("count given both as -count and as a positional argument")
+			}
+			n, err := strconv.Atoi(flag.Arg(2))
+			if err != nil {
+				usageErrorf("invalid count %q", flag.Arg(2))
+			}
+			*countFlag = n
+		}
+	} else {
+		for _, s := range flag.Args() {
+			t, err := parseTarget(s)
+			if err != nil {
+				usageErrorf("invalid target: %v", err)
+			}
+			targets = append(targets, t)
+		}
+	}
+	// -selftest：在进程内启动 TLS 服务器作为唯一目标，不依赖外部网络
+	var selfServer *httptest.Server
+	if *selftest {
+		switch {
+		case len(targets) > 0:
+			usageErrorf("-selftest takes no targets")
+		case *caCert != "":
+			usageErrorf("-selftest verifies against its own server certificate and cannot be combined with -cacert")
+		}
+		selfServer = newSelftestServer(nil)
+		defer selfServer.Close()
+		targets = []target{{Host: "127.0.0.1", Port: selfServer.Listener.Addr().(*net.TCPAddr).Port}}
+	}
+	if len(targets) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *sniList != "" {
+		if len(targets) != 1 {
+			usageErrorf("-sni-list needs exactly one target, got %d", len(targets))
+		}
+		if *sni != "" {
+			usageErrorf("-sni and -sni-list are mutually exclusive")
+		}
+		names, err := parseSNIList(*sniList)
+		if err != nil {
+			usageErrorf("invalid -sni-list: %v", err)
+		}
+		base := targets[0]
+		targets = targets[:0]
+		for _, name := range names {
+			targets = append(targets, target{Host: base.Host, Port: base.Port, SNI: name})
+		}
+	}
+	if *repeat < 1 {
+		usageErrorf("-repeat must be at least 1")
+	}
+	if *repeat > 1 && *promPath != "" {
+		usageErrorf("-repeat cannot be combined with -prom (every run would report the same series)")
+	}
+	if baseline != nil && len(targets) > 1 {
+		usageErrorf("-baseline compares a single target, got %d", len(targets))
+	}
+	count := *countFlag
+	if count < 1 {
+		usageErrorf("count must be at least 1, got %d", count)
+	}
+
+	minVersion, maxVersion, err := tlsVersionBounds(*minVersionFlag, *maxVersionFlag)
+	if err != nil {
+		usageErrorf("%v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: *insecure,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		NextProtos:         splitList(*alpn),
+	}
+	if *caCert != "" {
+		pool, err := loadCertPool(*caCert)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load -cacert: %v\n", err)
+			os.Exit(1)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if selfServer != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AddCert(selfServer.Certificate())
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		usageErrorf("-cert and -key must be given together")
+	}
+	if *ciphers != "" {
+		ids, insecureSuites, err := parseCipherSuites(*ciphers)
+		if err != nil {
+			usageErrorf("-ciphers: %v", err)
+		}
+		tlsConfig.CipherSuites = ids
+		if minVersion == tls.VersionTLS13 {
+			fmt.Fprintln(os.Stderr, "⚠️  WARNING: -ciphers only applies to TLS 1.2 and below, but -min-version 1.3 pins TLS 1.3; the suites have no effect.")
+			fmt.Fprintln(os.Stderr)
+		}
+		if len(insecureSuites) > 0 {
+			fmt.Fprintf(os.Stderr, "⚠️  WARNING: offering insecure cipher suites: %s\n", strings.Join(insecureSuites, ", "))
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+	if *groupsFlag != "" {
+		if *pq {
+			usageErrorf("-groups cannot be combined with -pq (which pins X25519MLKEM768)")
+		}
+		ids, err := parseGroups(*groupsFlag)
+		if err != nil {
+			usageErrorf("-groups: %v", err)
+		}
+		tlsConfig.CurvePreferences = ids
+	}
+	if *pq {
+		if maxVersion != 0 && maxVersion < tls.VersionTLS13 {
+			usageErrorf("-pq requires TLS 1.3, but -max-version is %s", *maxVersionFlag)
+		}
+		// 实际协商到的组在结果中按 ConnectionState.CurveID 核对
+		tlsConfig.CurvePreferences = []tls.CurveID{tls.X25519MLKEM768}
+	}
+	if *echFlag != "" {
+		if maxVersion != 0 && maxVersion < tls.VersionTLS13 {
+			usageErrorf("-ech requires TLS 1.3, but -max-version is %s", *maxVersionFlag)
+		}
+		list, err := decodeECHConfigList(*echFlag)
+		if err != nil {
+			usageErrorf("-ech: %v", err)
+		}
+		tlsConfig.EncryptedClientHelloConfigList = list
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load client certificate: %v\n", err)
+			os.Exit(1)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if *concurrency < 1 {
+		usageErrorf("-concurrency must be at least 1")
+	}
+	if *duration < 0 {
+		usageErrorf("-duration must be positive")
+	}
+	if *connectTimeout <= 0 {
+		usageErrorf("-connect-timeout must be positive")
+	}
+	if *handshakeTimeout < 0 {
+		usageErrorf("-handshake-timeout must not be negative")
+	}
+	if *helloPadding < 0 || *helloPadding > maxClientHello {
+		usageErrorf("-client-hello-padding must be between 0 and %d bytes", maxClientHello)
+	}
+	if *helloPadding > 0 && *quicMode {
+		usageErrorf("-client-hello-padding cannot be combined with -quic (the padding rides on ALPN)")
+	}
+	if *earlyData && !*quicMode {
+		usageErrorf("-early-data needs -quic: Go's crypto/tls cannot send TLS 1.3 early data over TCP")
+	}
+	if *quicMode && quicHandshake == nil {
+		usageErrorf("-quic is not compiled in; run with: go run -tags quic tls_bench_go.go tls_bench_quic.go")
+	}
+	if *tfo && *dualStack {
+		usageErrorf("-tfo cannot be combined with -dual")
+	}
+	if boolCount(*socks5 != "", *httpProxy != "", *chainFlag != "") > 1 {
+		usageErrorf("-socks5, -http-proxy and -chain are mutually exclusive")
+	}
+	proxyFlag, proxyScheme, proxyAddr := "-socks5", "socks5", *socks5
+	if *httpProxy != "" {
+		proxyFlag, proxyScheme, proxyAddr = "-http-proxy", "http", *httpProxy
+	}
+	var proxy *proxyConfig
+	var chain []*proxyConfig // -chain 时第一项之后的代理；第一项即 proxy，单代理的限制同样适用
+	if *chainFlag != "" {
+		proxyFlag = "-chain"
+		hops, err := parseChain(*chainFlag)
+		if err != nil {
+			usageErrorf("-chain: %v", err)
+		}
+		proxy, chain = hops[0], hops[1:]
+	}
+	if proxyAddr != "" {
+		proxy, err = parseProxy(proxyScheme, proxyAddr)
+		if err != nil {
+			usageErrorf("%s: %v", proxyFlag, err)
+		}
+	}
+	if proxy != nil {
+		switch {
+		case *dualStack:
+			usageErrorf("%s cannot be combined with -dual", proxyFlag)
+		case *tfo:
+			usageErrorf("%s cannot be combined with -tfo", proxyFlag)
+		case *quicMode:
+			usageErrorf("%s cannot be combined with -quic (the tunnel is TCP only)", proxyFlag)
+		case *predial:
+			usageErrorf("%s cannot be combined with -predial", proxyFlag)
+		case *paired:
+			usageErrorf("%s cannot be combined with -paired (the TCP-only connect would not include the tunnel)", proxyFlag)
+		}
+	}
+	var locate geoLocator
+	var origin *[2]float64
+	if *geoOrigin != "" {
+		if *geoDB == "" {
+			usageErrorf("-geo-origin needs -geodb")
+		}
+		lat, lon, err := parseLatLon(*geoOrigin)
+		if err != nil {
+			usageErrorf("-geo-origin: %v", err)
+		}
+		origin = &[2]float64{lat, lon}
+	}
+	if *geoDB != "" {
+		switch {
+		case geoOpen == nil:
+			usageErrorf("-geodb is not compiled in; run with: go run -tags geoip tls_bench_go.go tls_bench_geoip.go")
+		case proxy != nil:
+			usageErrorf("-geodb cannot be combined with %s (the connected IP is the proxy)", proxyFlag)
+		}
+		var closeDB func() error
+		locate, closeDB, err = geoOpen(*geoDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open -geodb: %v\n", err)
+			return 1
+		}
+		defer closeDB()
+	}
+	if slices.ContainsFunc(targets, func(t target) bool { return t.Unix != "" }) {
+		switch {
+		case proxy != nil:
+			usageErrorf("unix:// targets cannot be combined with %s", proxyFlag)
+		case *dualStack || *ipv4Only || *ipv6Only:
+			usageErrorf("unix:// targets cannot be combined with -dual, -4 or -6")
+		case *tfo:
+			usageErrorf("unix:// targets cannot be combined with -tfo")
+		case *quicMode:
+			usageErrorf("unix:// targets cannot be combined with -quic")
+		case *predial:
+			usageErrorf("unix:// targets cannot be combined with -predial (there is no TCP setup to exclude)")
+		case *paired:
+			usageErrorf("unix:// targets cannot be combined with -paired (there is no TCP connect to pair with)")
+		case *sniList != "":
+			usageErrorf("unix:// targets cannot be combined with -sni-list")
+		case *connectOnly:
+			usageErrorf("unix:// targets cannot be combined with -connect-only (there is no TCP connect)")
+		}
+	}
+	if *retries < 0 {
+		usageErrorf("-retries must not be negative")
+	}
+	if *warmupCount < 0 {
+		usageErrorf("-warmup must not be negative")
+	}
+	if *delay < 0 {
+		usageErrorf("-delay must not be negative")
+	}
+	if *noDelay {
+		if flagSet("delay") && *delay != 0 {
+			usageErrorf("-no-delay conflicts with -delay %s", *delay)
+		}
+		*delay = 0
+	}
+
+	if *httpPath != "" {
+		if !strings.HasPrefix(*httpPath, "/") {
+			usageErrorf("-http path must start with /")
+		}
+		for _, p := range tlsConfig.NextProtos {
+			if p == "h2" {
+				usageErrorf("-http speaks HTTP/1.1 only; do not offer h2 via -alpn")
+			}
+		}
+	}
+
+	opts := &handshakeOptions{
+		TLS:              tlsConfig,
+		Network:          "tcp",
+		DualStack:        *dualStack,
+		HTTPPath:         *httpPath,
+		SNI:              *sni,
+		ConnectTimeout:   *connectTimeout,
+		HandshakeTimeout: *handshakeTimeout,
+		Proxy:            proxy,
+		Chain:            chain,
+		Phases:           *phases,
+		EarlyData:        *earlyData,
+		ConnectOnly:      *connectOnly,
+		MaxChainDepth:    *maxChainDepth,
+	}
+	switch {
+	case boolCount(*ipv4Only, *ipv6Only, *dualStack) > 1:
+		usageErrorf("-4, -6 and -dual are mutually exclusive")
+	case *ipv4Only:
+		opts.Network = "tcp4"
+	case *ipv6Only:
+		opts.Network = "tcp6"
+	}
+	switch *proxyProtocol {
+	case "":
+		if *proxyProtocolSrc != "" {
+			usageErrorf("-proxy-protocol-src needs -proxy-protocol v2")
+		}
+	case "v2", "2":
+		switch {
+		case proxy != nil:
+			usageErrorf("-proxy-protocol cannot be combined with %s", proxyFlag)
+		case *quicMode:
+			usageErrorf("-proxy-protocol cannot be combined with -quic (the header is TCP only)")
+		case slices.ContainsFunc(targets, func(t target) bool { return t.Unix != "" }):
+			usageErrorf("unix:// targets cannot be combined with -proxy-protocol")
+		}
+		opts.ProxyHeader = true
+		if *proxyProtocolSrc != "" {
+			if opts.ProxyHeaderSrc, err = parseIPPort(*proxyProtocolSrc); err != nil {
+				usageErrorf("-proxy-protocol-src: %v", err)
+			}
+		}
+	default:
+		usageErrorf("-proxy-protocol: unsupported version %q (only v2)", *proxyProtocol)
+	}
+	if *compareRust {
+		// Rust 版本只支持单目标、固定次数、串行、固定预热和间隔，其余参数必须与之一致才可比
+		switch {
+		case len(targets) != 1 || targets[0].Unix != "":
+			usageErrorf("-compare-go-rust needs exactly one host:port target")
+		case *duration > 0:
+			usageErrorf("-compare-go-rust needs a fixed count; the Rust tool has no -duration")
+		case *concurrency != 1:
+			usageErrorf("-compare-go-rust needs -concurrency 1; the Rust tool runs sequentially")
+		case *delay != rustDelay:
+			usageErrorf("-compare-go-rust needs -delay %s, the Rust tool's fixed delay", rustDelay)
+		case *warmupCount != rustWarmup:
+			usageErrorf("-compare-go-rust needs -warmup %d, the Rust tool's fixed warmup", rustWarmup)
+		case *repeat > 1:
+			usageErrorf("-compare-go-rust cannot be combined with -repeat")
+		case proxy != nil:
+			usageErrorf("-compare-go-rust cannot be combined with %s; the Rust tool connects directly", proxyFlag)
+		case *quicMode:
+			usageErrorf("-compare-go-rust cannot be combined with -quic")
+		}
+	} else if flagSet("rust-bin") {
+		usageErrorf("-rust-bin needs -compare-go-rust")
+	}
+	if *connectOnly {
+		// 这些选项要么配置 TLS 握手，要么统计它的结果，没有握手时会静默失效
+		for _, name := range []string{"quic", "early-data", "http", "reuse", "resume", "phases", "paired", "predial", "tfo",
+			"ech", "pq", "groups", "alpn", "ciphers", "min-version", "max-version", "sni", "sni-list", "cert", "handshake-timeout",
+			"client-hello-padding", "proxy-protocol", "inject-rtt", "abort-on-cert-error", "compare-go-rust", "baseline", "repeat",
+			"trim", "hist", "hist-buckets", "buckets", "prom-exemplars", "warmup-discard-outliers", "max-p50", "max-p99", "fail-on-warn", "handshake-only", "max-chain-depth", "keylog"} {
+			if flagSet(name) {
+				usageErrorf("-connect-only cannot be combined with -%s (there is no TLS handshake)", name)
+			}
+		}
+	}
+	if *maxChainDepth < 0 {
+		usageErrorf("-max-chain-depth must not be negative")
+	}
+	if *handshakeOnly && *echFlag != "" {
+		usageErrorf("-handshake-only cannot be combined with -ech (the in-process server has no ECH keys)")
+	}
+	if *injectRTT < 0 || *injectJitter < 0 {
+		usageErrorf("-inject-rtt and -inject-jitter must not be negative")
+	}
+	if *injectJitter > 0 && *injectRTT == 0 {
+		usageErrorf("-inject-jitter needs -inject-rtt")
+	}
+	if *injectRTT > 0 {
+		switch {
+		case *tfo:
+			usageErrorf("-inject-rtt cannot be combined with -tfo (the SYN would carry data the delay cannot model)")
+		case *quicMode:
+			usageErrorf("-inject-rtt cannot be combined with -quic (only TCP connections are wrapped)")
+		}
+		opts.Netem = &netem{RTT: *injectRTT, Jitter: *injectJitter}
+	}
+	var localIface string
+	var ifaceNames map[string]string // 源 IP → 接口名，用于标注每条连接的源地址
+	if *localAddr != "" {
+		if *dualStack {
+			usageErrorf("-local-addr cannot be combined with -dual (the source address fixes the family)")
+		}
+		if *quicMode {
+			usageErrorf("-local-addr cannot be combined with -quic")
+		}
+		if slices.ContainsFunc(targets, func(t target) bool { return t.Unix != "" }) {
+			usageErrorf("unix:// targets cannot be combined with -local-addr")
+		}
+		opts.LocalAddr, localIface, err = parseLocalAddr(*localAddr, opts.Network)
+		if err != nil {
+			usageErrorf("-local-addr: %v", err)
+		}
+		// 源地址决定了地址族，只解析同族的目标地址
+		network := "tcp6"
+		if opts.LocalAddr.To4() != nil {
+			network = "tcp4"
+		}
+		if opts.Network != "tcp" && opts.Network != network {
+			usageErrorf("-local-addr %s is %s but -%s was given", opts.LocalAddr, familyName(network), strings.TrimPrefix(opts.Network, "tcp"))
+		}
+		opts.Network = network
+		ifaceNames = localInterfaces()
+	}
+
+	// -each-ip：把唯一的目标展开为它解析出的每个地址，SNI 固定为原主机名
+	if *eachIP {
+		switch {
+		case len(targets) != 1:
+			usageErrorf("-each-ip needs exactly one target, got %d", len(targets))
+		case targets[0].Unix != "":
+			usageErrorf("-each-ip cannot be combined with unix:// targets")
+		case net.ParseIP(targets[0].Host) != nil:
+			usageErrorf("-each-ip needs a hostname, %s is already an IP address", targets[0].Host)
+		case *sniList != "":
+			usageErrorf("-each-ip and -sni-list are mutually exclusive")
+		case proxy != nil:
+			usageErrorf("-each-ip cannot be combined with %s (the proxy resolves the hostname)", proxyFlag)
+		case *dualStack:
+			usageErrorf("-each-ip cannot be combined with -dual (use -4 or -6 to pick a family)")
+		case baseline != nil:
+			usageErrorf("-baseline compares a single target and cannot be combined with -each-ip")
+		}
+		base := targets[0]
+		addrs, _, err := resolve(base.Host, opts.Network)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to resolve %s for -each-ip: %v\n", base.Host, err)
+			return 1
+		}
+		name := base.Host
+		if *sni != "" {
+			name = *sni
+		}
+		targets = targets[:0]
+		for _, a := range addrs {
+			targets = append(targets, target{Host: a, Port: base.Port, SNI: name})
+		}
+	}
+
+	// 参数全部校验通过后再打开，用法错误时不创建文件
+	if *keyLogPath != "" {
+		// 所有握手（含预热和附加测量）追加写入同一个文件；*os.File 的并发写入是安全的
+		f, err := openKeyLog(*keyLogPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open -keylog file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		tlsConfig.KeyLogWriter = f
+		fmt.Fprintf(os.Stderr, "⚠️  WARNING: -keylog writes every TLS session secret to %s - anyone with this file can decrypt captured traffic. Use it only for debugging and delete the file afterwards.\n", *keyLogPath)
+		fmt.Fprintln(os.Stderr)
+	}
+
+	// -json、-csv - 或 -ndjson 模式下 stdout 只输出机器可读数据，进度信息和报告改走 stderr
+	var out io.Writer = os.Stdout
+	if *jsonOutput || *mdOutput || *csvPath == "-" || *ndjsonOutput {
+		out = os.Stderr
+	}
+	// os.Stdout 不带缓冲，每行 Encode 即刻写出
+	ndjson := json.NewEncoder(os.Stdout)
+
+	var csvOut *csvSampleWriter
+	if *csvPath != "" {
+		csvOut, err = newCSVSampleWriter(*csvPath, len(targets) > 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open CSV output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var rawOut *rawSampleWriter
+	if *rawPath != "" {
+		rawOut, err = newRawSampleWriter(*rawPath, len(targets) > 1, *concurrency > 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open -raw output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *tfo && tfoControl == nil {
+		fmt.Fprintln(os.Stderr, "⚠️  WARNING: TCP Fast Open is not supported on this platform/build, -tfo ignored.")
+		fmt.Fprintln(os.Stderr, "⚠️  On Linux run: go run tls_bench_go.go tls_bench_tfo_linux.go -tfo ...")
+		fmt.Fprintln(os.Stderr)
+		*tfo = false
+	}
+
+	if *insecure {
+		fmt.Fprintln(os.Stderr, "⚠️  WARNING: -insecure is set, certificate verification is DISABLED.")
+		fmt.Fprintln(os.Stderr, "⚠️  The server's identity is not checked; do not rely on these results in a security-sensitive context.")
+		fmt.Fprintln(os.Stderr)
+	}
+
+	// Ctrl-C：不再发起新的握手，等进行中的握手结束后按已收集的样本出报告；再按一次立即退出
+	stop := make(chan struct{})
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+	go func() {
+		<-sigc
+		fmt.Fprintln(os.Stderr, "\nInterrupted: waiting for in-flight handshakes, then reporting partial results (Ctrl-C again to abort)")
+		close(stop)
+		<-sigc
+		os.Exit(130)
+	}()
+	basePlan := runPlan{Count: count, Concurrency: *concurrency, Delay: *delay, Stop: stop, FailFast: *failFast}
+	if *abortOnCert {
+		basePlan.StopOn = func(err error) bool { return classifyError(err) == errCert }
+	}
+
+	// 运行参数头部属于诊断信息，-q 时省略
+	head := out
+	if diag.level == levelQuiet {
+		head = io.Discard
+	}
+	fmt.Fprintln(head, "=== TLS Handshake Latency Benchmark ===")
+	if len(targets) == 1 {
+		fmt.Fprintf(head, "Host: %s\n", targets[0])
+	} else {
+		names := make([]string, len(targets))
+		for i, t := range targets {
+			names[i] = t.String()
+		}
+		fmt.Fprintf(head, "Targets: %d (%s)\n", len(targets), strings.Join(names, ", "))
+	}
+	if *duration > 0 {
+		fmt.Fprintf(head, "Duration: %s\n", *duration)
+	} else {
+		fmt.Fprintf(head, "Count: %d\n", count)
+	}
+	if *concurrency > 1 {
+		fmt.Fprintf(head, "Concurrency: %d workers, delay %s per worker\n", *concurrency, *delay)
+	} else {
+		fmt.Fprintf(head, "Delay: %s\n", *delay)
+	}
+	if *connectOnly {
+		fmt.Fprintln(head, "Mode: TCP connect only, no TLS handshake (-connect-only)")
+	} else {
+		fmt.Fprintf(head, "TLS Library: %s\n", tlsLibrary)
+	}
+	fmt.Fprintf(head, "Random Seed: %d (replay with -seed %d)\n", seed, seed)
+	fmt.Fprintf(head, "Go Version: %s %s/%s (%s)\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, cryptoMode())
+	if len(tlsConfig.NextProtos) > 0 {
+		fmt.Fprintf(head, "ALPN Offered: %s\n", strings.Join(tlsConfig.NextProtos, ","))
+	}
+	if *groupsFlag != "" {
+		names := make([]string, len(tlsConfig.CurvePreferences))
+		for i, id := range tlsConfig.CurvePreferences {
+			names[i] = id.String()
+		}
+		fmt.Fprintf(head, "Key Exchange Groups Offered: %s\n", strings.Join(names, ","))
+	}
+	if len(tlsConfig.CipherSuites) > 0 {
+		names := make([]string, len(tlsConfig.CipherSuites))
+		for i, id := range tlsConfig.CipherSuites {
+			names[i] = tls.CipherSuiteName(id)
+		}
+		fmt.Fprintf(head, "Cipher Suites (TLS 1.2): %s\n", strings.Join(names, ","))
+		if maxVersion == 0 || maxVersion >= tls.VersionTLS13 {
+			fmt.Fprintln(head, "  note: TLS 1.3 may still be negotiated and ignores this list; add -max-version 1.2 to compare suites")
+		}
+	}
+	switch {
+	case *insecure:
+		fmt.Fprintln(head, "Certificate Verification: DISABLED (-insecure)")
+	case *caCert != "":
+		fmt.Fprintf(head, "CA Bundle: %s\n", *caCert)
+	}
+	if *certFile != "" {
+		fmt.Fprintf(head, "Client Certificate: %s\n", *certFile)
+	}
+	if *maxChainDepth > 0 {
+		fmt.Fprintf(head, "Max Chain Depth: %d certificates (longer chains count as failures)\n", *maxChainDepth)
+	}
+	if *keyLogPath != "" {
+		fmt.Fprintf(head, "Key Log: %s (NSS format, session secrets exposed)\n", *keyLogPath)
+	}
+	if *sni != "" {
+		fmt.Fprintf(head, "SNI: %s\n", *sni)
+	}
+	if *eachIP {
+		fmt.Fprintf(head, "Each IP: %d addresses of %s (SNI and verification use the hostname)\n", len(targets), targets[0].SNI)
+	}
+	if *sniList != "" {
+		fmt.Fprintf(head, "SNI List: %d names against %s:%d\n", len(targets), targets[0].Host, targets[0].Port)
+	}
+	switch {
+	case *chainFlag != "":
+		names := []string{}
+		for _, p := range append([]*proxyConfig{proxy}, chain...) {
+			names = append(names, p.Scheme+"://"+p.String())
+		}
+		fmt.Fprintf(head, "Proxy Chain: %s → target (TCP/DNS figures are for the first proxy)\n", strings.Join(names, " → "))
+	case proxy != nil:
+		fmt.Fprintf(head, "%s Proxy: %s (TCP/DNS figures are for the proxy)\n", proxy.Name(), proxy)
+	}
+	if opts.LocalAddr != nil {
+		fmt.Fprintf(head, "Source Address: %s (%s)\n", opts.LocalAddr, localIface)
+	}
+	if opts.ProxyHeader {
+		src := "local socket address"
+		if opts.ProxyHeaderSrc != nil {
+			src = opts.ProxyHeaderSrc.String()
+		}
+		fmt.Fprintf(head, "PROXY Protocol: v2 header before each handshake (client %s)\n", src)
+	}
+	if n := opts.Netem; n != nil {
+		fmt.Fprintf(head, "Injected Latency: +%s per round trip", n.RTT)
+		if n.Jitter > 0 {
+			fmt.Fprintf(head, " (jitter stdev %s)", n.Jitter)
+		}
+		fmt.Fprintln(head, ", compared with a direct run")
+	}
+	switch {
+	case opts.DualStack:
+		fmt.Fprintln(head, "Address Family: dual-stack (Happy Eyeballs)")
+	case opts.Network != "tcp":
+		fmt.Fprintf(head, "Address Family: %s only\n", familyName(opts.Network))
+	}
+	if minVersion != 0 || maxVersion != 0 {
+		fmt.Fprintf(head, "TLS Versions: %s\n", versionRange(tlsConfig))
+	}
+	if *pq {
+		fmt.Fprintln(head, "Key Exchange: X25519MLKEM768 only (classical X25519 baseline run afterwards)")
+	}
+	if *echFlag != "" {
+		fmt.Fprintln(head, "Encrypted Client Hello: offered (baseline without ECH run afterwards)")
+	}
+	if *helloPadding > 0 {
+		fmt.Fprintf(head, "ClientHello Padding: to %d bytes via dummy ALPN names (unpadded run afterwards)\n", *helloPadding)
+	}
+	if *reuse > 0 {
+		fmt.Fprintf(head, "Connection Reuse: %d keep-alive requests on one connection afterwards\n", *reuse)
+	}
+	if *hdrDigits > 0 {
+		fmt.Fprintf(head, "Stats: HDR histograms, %d significant digits (percentiles within %g%%)\n", *hdrDigits, 100*math.Pow10(-*hdrDigits))
+	}
+	fmt.Fprintln(head)
+
+	// benchTarget 对单个目标完成预热、正式测试和文本报告，返回结果和该目标的退出码
+	benchTarget := func(tg target) (*jsonReport, int) {
+		host, port := tg.Host, tg.Port
+		// 经代理时本地只解析代理地址
+		dnsSkipped := net.ParseIP(host) != nil
+		if proxy != nil {
+			t, _ := parseTarget(proxy.Addr)
+			dnsSkipped = net.ParseIP(t.Host) != nil
+		}
+
+		// 每个目标使用独立的配置副本，-resume 的会话缓存不跨目标共享
+		opts := *opts
+		opts.TLS = tlsConfig.Clone()
+		if tg.SNI != "" {
+			opts.SNI = tg.SNI
+		}
+		opts.Unix = tg.Unix
+		if tg.Unix != "" {
+			dnsSkipped = true
+		}
+
+		var padding *paddingReport
+		var realProtos []string
+		if *helloPadding > 0 {
+			probe := opts.TLS.Clone()
+			probe.ServerName = opts.serverName(host)
+			unpadded, padded, protos, err := padClientHello(probe, *helloPadding)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to size the ClientHello: %v\n", err)
+				os.Exit(1)
+			}
+			opts.TLS.NextProtos = probe.NextProtos
+			opts.HelloSize = true
+			realProtos = protos
+			padding = &paddingReport{TargetSize: *helloPadding, UnpaddedSize: unpadded}
+			if padded == unpadded {
+				diag.Infof("ClientHello: %d bytes, already at least -client-hello-padding %d; not padded\n", unpadded, *helloPadding)
+			} else {
+				diag.Infof("ClientHello: %d bytes unpadded, padded to %d bytes\n", unpadded, padded)
+			}
+		}
+		if csvOut != nil {
+			csvOut.target = tg.String()
+		}
+		if rawOut != nil {
+			rawOut.target = tg.String()
+		}
+
+		newRec := func() recorder {
+			if *maxSamples > 0 {
+				return newReservoirRecorder(*maxSamples)
+			}
+			return newRecorder(*hdrDigits)
+		}
+		dnsDurations := newRec()
+		tcpDurations := newRec()
+		tlsDurations := newRec()
+		verifyDurations := newRec()
+		phaseDurations := phaseRecorders{newRec(), newRec(), newRec(), newRec()}
+		ttfbDurations := newRec()
+		proxyDurations := newRec()
+		var hopDurations []recorder // -chain 时每一跳一个
+		if len(chain) > 0 {
+			hopDurations = make([]recorder, len(chain)+1)
+			for i := range hopDurations {
+				hopDurations[i] = newRec()
+			}
+		}
+		totalDurations := newRec()
+		httpStatuses := make(map[string]int)
+		errorCounts := make(map[string]int)
+		fullDurations := newRec()
+		resumedDurations := newRec()
+		versionDurations := make(map[string]recorder) // 按协商到的 TLS 版本分组
+		var buckets *latencyBuckets
+		if bucketBounds != nil {
+			buckets = newLatencyBuckets(bucketBounds)
+		}
+		var promBuckets *latencyBuckets
+		if promBounds != nil {
+			promBuckets = newLatencyBuckets(promBounds)
+		}
+		var warmup []warmupSample
+		var first negotiated
+		var cert *certInfo
+		ocsp := &ocspReport{Status: make(map[string]int)}
+		ocspDurations := newRec()
+		versions := make(map[string]int)
+		groups := make(map[string]int)
+		chainDepths := make(map[string]int) // 服务器发送的证书数 → 握手数
+		families := make(map[string]int)
+		remoteIPs := make(map[string]int) // -geodb：各对端 IP 的握手数
+		var sourceAddrs map[string]int    // -local-addr：各源地址（含接口名）的握手数
+		if opts.LocalAddr != nil {
+			sourceAddrs = make(map[string]int)
+		}
+		clientCertRequests := 0
+		retried, retryAttempts := 0, 0
+		tlsRounds := 0 // 成功握手的 TLS 往返数之和（-inject-rtt）
+		sloWithin := 0 // 总耗时不超过 -slo-ms 的成功握手数
+		errors := 0
+		var busy time.Duration
+		var jitterSum jitterAcc
+		var ech *echReport
+		if *echFlag != "" {
+			ech = &echReport{}
+		}
+
+		// 预热
+		if *warmupCount == 0 {
+			diag.Infof("Warmup skipped (-warmup 0): first handshakes may include cold DNS/TCP/TLS caches\n")
+		} else {
+			diag.Infof("Warmup (%d connections)...\n", *warmupCount)
+		}
+		for i := 0; i < *warmupCount && !stopped(stop); i++ {
+			res, err := measureHandshake(host, port, &opts)
+			if err != nil && *abortOnCert && classifyError(err) == errCert {
+				// 证书问题不会自行消失，不进入正式测试
+				diag.Infof("  Warmup %d failed\n\n", i+1)
+				printCertDiagnostic(os.Stderr, err)
+				warmup = append(warmup, warmupSample{Error: err.Error()})
+				return &jsonReport{Schema: reportSchema, Tool: "go", Library: tlsLibrary, Host: host, Port: port, SNI: tg.SNI, Unix: tg.Unix, Aborted: true, Unit: "ms",
+					Warmup: warmup, ErrorKinds: map[string]int{errCert: 1}}, 1
+			}
+			if err != nil {
+				diag.Infof("  Warmup %d failed: %v\n", i+1, err)
+				warmup = append(warmup, warmupSample{Error: err.Error()})
+			} else {
+				w := warmupSample{DNS: millis(res.DNS), TCP: millis(res.TCP), TLS: millis(res.TLS)}
+				switch {
+				case opts.ConnectOnly && dnsSkipped:
+					diag.Infof("  Warmup %d: TCP=%s\n", i+1, unit.f(0, w.TCP))
+				case opts.ConnectOnly:
+					diag.Infof("  Warmup %d: DNS=%s, TCP=%s\n", i+1, unit.f(0, w.DNS), unit.f(0, w.TCP))
+				case tg.Unix != "":
+					diag.Infof("  Warmup %d: TLS=%s\n", i+1, unit.f(0, w.TLS))
+				case dnsSkipped:
+					diag.Infof("  Warmup %d: TCP=%s, TLS=%s\n", i+1, unit.f(0, w.TCP), unit.f(0, w.TLS))
+				default:
+					diag.Infof("  Warmup %d: DNS=%s, TCP=%s, TLS=%s\n", i+1, unit.f(0, w.DNS), unit.f(0, w.TCP), unit.f(0, w.TLS))
+				}
+				warmup = append(warmup, w)
+			}
+		}
+		diag.Infof("\n")
+
+		// 会话缓存在预热之后才启用：第一次正式握手是完整握手并拿到 ticket，后续握手走会话恢复
+		if *resume {
+			opts.TLS.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		}
+
+		// 正式测试
+		// 间隔按 worker 计：N 个 worker 时整体请求速率约为单 worker 的 N 倍
+		plan := basePlan
+		if *duration > 0 {
+			diag.Infof("Running handshakes for %s (concurrency %d)...\n", *duration, *concurrency)
+		} else {
+			diag.Infof("Running %d handshakes (concurrency %d)...\n", count, *concurrency)
+		}
+		var cpuUser, cpuSys time.Duration // 正式测试开始时的 CPU 读数
+		if processCPU != nil {
+			cpuUser, cpuSys = processCPU()
+		}
+		var memBefore, memAfter runtime.MemStats
+		runtime.ReadMemStats(&memBefore)
+		testStart := time.Now()
+		if *duration > 0 {
+			plan.Deadline = testStart.Add(*duration)
+		}
+
+		// collect 把一个样本计入各项统计并写出 -csv/-raw 行
+		collect := func(s sample) {
+			if csvOut != nil {
+				if err := csvOut.Write(s); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to write CSV: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if rawOut != nil {
+				if err := rawOut.Write(s); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to write -raw output: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if s.Result.Retries > 0 {
+				retried++
+				retryAttempts += s.Result.Retries
+			}
+			if s.Err != nil {
+				errors++
+				errorCounts[classifyError(s.Err)]++
+				return
+			}
+			res := s.Result
+			busy += s.Elapsed
+			if padding != nil && res.ClientHello > 0 {
+				if padding.MinSize == 0 || res.ClientHello < padding.MinSize {
+					padding.MinSize = res.ClientHello
+				}
+				padding.MaxSize = max(padding.MaxSize, res.ClientHello)
+			}
+			jitterSum.Add(s)
+			dnsDurations.Add(millis(res.DNS))
+			tcpDurations.Add(millis(res.TCP))
+			tlsDurations.Add(millis(res.TLS))
+			if buckets != nil {
+				buckets.Observe(millis(res.TLS), s.Index, s.Start)
+			}
+			if promBuckets != nil {
+				promBuckets.Observe(millis(res.TLS), s.Index, s.Start)
+			}
+			total := millis(res.TCP) + millis(res.TLS)
+			if proxy != nil {
+				proxyDurations.Add(millis(res.Proxy))
+				total += millis(res.Proxy)
+				for i, d := range res.Hops {
+					hopDurations[i].Add(millis(d))
+				}
+			}
+			totalDurations.Add(total)
+			if *sloMs > 0 && total <= *sloMs {
+				sloWithin++
+			}
+			families[res.Family]++
+			if sourceAddrs != nil && res.LocalIP != "" {
+				sourceAddrs[sourceLabel(res.LocalIP, ifaceNames)]++
+			}
+			if locate != nil && res.RemoteIP != "" {
+				remoteIPs[res.RemoteIP]++
+			}
+			if opts.ConnectOnly {
+				return // 以下均为 TLS 握手的结果
+			}
+			if tlsDurations.Len() == 1 {
+				first = negotiatedFrom(res.State)
+				cert = certInfoFrom(res.State, time.Now())
+			}
+			version := tls.VersionName(res.State.Version)
+			versions[version]++
+			if versionDurations[version] == nil {
+				versionDurations[version] = newRec()
+			}
+			versionDurations[version].Add(millis(res.TLS))
+			if res.State.CurveID != 0 {
+				groups[res.State.CurveID.String()]++
+			}
+			chainDepths[strconv.Itoa(len(res.State.PeerCertificates))]++
+			if res.Verify > 0 {
+				verifyDurations.Add(millis(res.Verify))
+			}
+			if res.Phases != nil {
+				phaseDurations.Add(res.Phases)
+			}
+			if opts.HTTPPath != "" {
+				ttfbDurations.Add(millis(res.TTFB))
+				httpStatuses[strconv.Itoa(res.HTTPStatus)]++
+			}
+			if res.ClientCertRequested {
+				clientCertRequests++
+			}
+			if ech != nil {
+				ech.Successful++
+				if res.ECH {
+					ech.Accepted++
+				}
+			}
+			tlsRounds += tlsRoundTrips(res.State)
+			if res.State.DidResume {
+				resumedDurations.Add(millis(res.TLS))
+			} else {
+				fullDurations.Add(millis(res.TLS))
+				ocsp.FullHandshakes++
+			}
+			if st := res.OCSP; st != nil {
+				ocsp.Stapled++
+				ocsp.Status[st.Status]++
+				ocspDurations.Add(millis(res.OCSPVerify))
+				if st.SignatureErr != nil {
+					if ocsp.Unverified == 0 {
+						ocsp.SignatureError = st.SignatureErr.Error()
+					}
+					ocsp.Unverified++
+				}
+				if ocsp.ThisUpdate == nil && !st.ThisUpdate.IsZero() {
+					ocsp.ThisUpdate = &st.ThisUpdate
+					if !st.NextUpdate.IsZero() {
+						ocsp.NextUpdate = &st.NextUpdate
+					}
+				}
+			}
+		}
+
+		// -hdr、-max-samples 时样本不保留，在完成时逐个汇总（-csv/-raw 按完成顺序写出）
+		plan.Discard = *hdrDigits > 0 || *maxSamples > 0
+		completed := 0
+		samples, abort := runHandshakes(plan, func() (handshakeResult, error) {
+			return measureWithRetries(*retries, retryBackoff, func() (handshakeResult, error) {
+				return measureHandshake(host, port, &opts)
+			})
+		}, func(done int, s sample) {
+			completed = done
+			debugSample("", s)
+			if plan.Discard {
+				collect(s)
+			}
+			if *ndjsonOutput {
+				name := ""
+				if len(targets) > 1 {
+					name = tg.String()
+				}
+				if err := ndjson.Encode(newNDJSONSample(name, s)); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to write NDJSON: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			// -v 已逐条输出，不再打印进度
+			if diag.level >= levelDebug {
+				return
+			}
+			if s.Err != nil {
+				diag.Infof("\n  Error at %d: %v\n", s.Index, s.Err)
+			}
+			if done%10 == 0 || done == 1 {
+				if *duration > 0 {
+					diag.Infof("\r[%d, %.0fs left] ", done, time.Until(plan.Deadline).Seconds())
+				} else {
+					diag.Infof("\r[%d/%d] ", done, count)
+				}
+			}
+		})
+
+		totalTime := time.Since(testStart)
+		// 中止后仍在进行的握手可能成功，不影响结论
+		aborted := abort.Err != nil
+		var certErr error // -abort-on-cert-error 时触发中止的证书校验错误
+		if abort.StopOn {
+			certErr = abort.Err
+		}
+		var cpuUserEnd, cpuSysEnd time.Duration
+		if processCPU != nil {
+			cpuUserEnd, cpuSysEnd = processCPU()
+		}
+		runtime.ReadMemStats(&memAfter)
+		interrupted := stopped(stop)
+		if interrupted {
+			diag.Infof("\rInterrupted after %d handshakes in %.1fs\n", completed, totalTime.Seconds())
+		} else if aborted {
+			diag.Infof("\rAborted after %d handshakes in %.1fs\n", completed, totalTime.Seconds())
+		} else {
+			diag.Infof("\rCompleted %d handshakes in %.1fs\n", completed, totalTime.Seconds())
+		}
+		diag.Infof("\n")
+
+		// -duration 模式下以实际完成的次数为准
+		measured := completed
+
+		// 冷启动样本在汇总前丢弃，不计入任何统计
+		coldDiscarded := 0
+		if *coldStart {
+			var tlsTimes []float64
+			var at []int // 每个成功样本在 samples 中的位置
+			for i, s := range samples {
+				if s.Err == nil {
+					tlsTimes = append(tlsTimes, millis(s.Result.TLS))
+					at = append(at, i)
+				}
+			}
+			if k := coldStartCutoff(tlsTimes); k > 0 {
+				coldDiscarded = at[k]
+				samples = samples[coldDiscarded:]
+				measured -= coldDiscarded
+				fmt.Fprintf(out, "Cold start: discarded the first %d samples until the TLS median settled (window %d, ±%.0f%%)\n",
+					coldDiscarded, coldStartWindow, coldStartTolerance*100)
+			} else {
+				fmt.Fprintln(out, "Cold start: none detected, no samples discarded")
+			}
+			fmt.Fprintln(out)
+		}
+
+		// 按发起顺序汇总
+		var orderedTLS, orderedTCP []float64
+		for _, s := range samples {
+			collect(s)
+			if s.Err == nil {
+				orderedTLS = append(orderedTLS, millis(s.Result.TLS))
+				orderedTCP = append(orderedTCP, millis(s.Result.TCP))
+			}
+		}
+		// -hdr 时样本不保留，没有发起顺序可供对比
+		warmupEffect := serverWarmup(orderedTLS, orderedTCP, serverWarmupN)
+
+		// 提前结束（Ctrl-C、-fail-fast 或 -abort-on-cert-error）时不再进行附加测量
+		partial := interrupted || aborted
+
+		if ech != nil && !partial {
+			ech.Baseline, ech.Errors = measureWithoutECH(basePlan, *duration, host, port, opts, diag)
+		}
+
+		if padding != nil {
+			padding.Handshakes = measured
+			padding.Successful = tlsDurations.Len()
+			if !partial {
+				measureUnpadded(basePlan, *duration, host, port, opts, realProtos, padding, diag)
+			}
+		}
+
+		var pqStats *pqReport
+		if *pq && !partial {
+			pqStats = measureClassical(basePlan, *duration, host, port, opts, diag)
+		}
+
+		var netemStats *netemReport
+		if opts.Netem != nil && !partial {
+			netemStats = measureDirect(basePlan, *duration, host, port, opts, diag)
+			if n := fullDurations.Len() + resumedDurations.Len(); n > 0 {
+				netemStats.Rounds = float64(tlsRounds) / float64(n)
+			}
+		}
+
+		var tfoStats *tfoReport
+		if *tfo && !partial {
+			tfoStats = measureTFO(basePlan, *duration, host, port, opts, diag)
+		}
+
+		var predialStats *predialReport
+		if *predial && !partial {
+			predialStats = measurePredial(basePlan, *duration, host, port, opts, diag)
+		}
+
+		var pairedStats *pairedReport
+		if *paired && !partial {
+			pairedStats = measurePaired(basePlan, *duration, host, port, opts, diag)
+		}
+
+		var cryptoOnly *cryptoOnlyReport
+		if *handshakeOnly && !partial {
+			cryptoOnly = measureCryptoOnly(basePlan, *duration, opts, diag)
+		}
+
+		var reuseStats *reuseReport
+		if *reuse > 0 && !partial {
+			path := opts.HTTPPath
+			if path == "" {
+				path = "/"
+			}
+			reuseStats = measureReuse(*reuse, *delay, stop, path, host, port, opts, newRec(), diag)
+		}
+
+		var quicStats *quicReport
+		if *quicMode && !partial {
+			quicStats = measureQUIC(basePlan, *duration, host, port, opts, diag)
+		}
+
+		if tlsDurations.Len() == 0 {
+			// 全部失败时依然返回报告，-prom 照常写出错误计数，便于告警
+			fmt.Fprintln(os.Stderr, "No successful handshakes!")
+			if errors > 0 {
+				fmt.Fprintf(os.Stderr, "Errors: %d (%s)\n", errors, formatErrorKinds(errorCounts))
+			}
+			if certErr != nil {
+				printCertDiagnostic(os.Stderr, certErr)
+			} else if aborted {
+				fmt.Fprintf(os.Stderr, "Aborted: %d consecutive failures (-fail-fast)\n", *failFast)
+			}
+			slo := newSLOReport(*sloMs, *sloTarget, 0, measured)
+			code := 0
+			if slo != nil && !slo.Passed || aborted {
+				code = 1
+			}
+			// 没有样本可比较也是阈值失败，否则端点整个不可用时 CI 门禁反而通过
+			if *failOnWarn || *maxP50 > 0 || *maxP99 > 0 {
+				fmt.Fprintln(out)
+				fmt.Fprintln(out, "=== Threshold Check ===")
+				fmt.Fprintf(out, "❌ no successful handshakes (%d errors)\n", errors)
+				code = 1
+			}
+			// 同理，有基线时全部失败按回归处理
+			if baseline != nil {
+				fmt.Fprintln(out)
+				printBaselineHeader(out, baseline, *regressThreshold)
+				fmt.Fprintln(out, "❌ No successful handshakes to compare, treated as a regression")
+				code = 1
+			}
+			return &jsonReport{Schema: reportSchema, Tool: "go", Library: tlsLibrary, Host: host, Port: port, SNI: tg.SNI, Unix: tg.Unix, Count: measured, Interrupted: interrupted, Aborted: aborted, Errors: errors, ErrorKinds: errorCounts, Unit: "ms",
+				Warmup: warmup, Retried: retried, RetryAttempts: retryAttempts, SLO: slo}, code
+		}
+
+		// 统计 DNS
+		var dnsStats *Stats
+		if !dnsSkipped {
+			s := dnsDurations.Stats()
+			dnsStats = &s
+		}
+
+		// 统计 TCP
+		tcpStats := tcpDurations.Stats()
+
+		// 统计 TLS
+		tlsStats := tlsDurations.Stats()
+
+		// 证书链校验
+		var verifyStats *Stats
+		if verifyDurations.Len() > 0 {
+			s := verifyDurations.Stats()
+			verifyStats = &s
+		}
+
+		phasesStats := phaseDurations.Report()
+
+		var geo []geoInfo
+		if locate != nil {
+			geo = annotateGeo(locate, remoteIPs, origin)
+		}
+
+		// OCSP staple 校验
+		if ocspDurations.Len() > 0 {
+			s := ocspDurations.Stats()
+			ocsp.Verify = &s
+		}
+
+		// HTTP 首字节
+		var ttfbStats *Stats
+		if ttfbDurations.Len() > 0 {
+			s := ttfbDurations.Stats()
+			ttfbStats = &s
+		}
+
+		// SOCKS5 代理一跳
+		var proxyStats *Stats
+		if proxyDurations.Len() > 0 {
+			s := proxyDurations.Stats()
+			proxyStats = &s
+		}
+
+		// 总延迟
+		totalStats := totalDurations.Stats()
+
+		rate := throughputFrom(tlsDurations.Len(), busy, totalTime, *concurrency)
+		var cpu *cpuReport
+		if processCPU != nil {
+			cpu = cpuFrom(cpuUser, cpuSys, cpuUserEnd, cpuSysEnd, tlsDurations.Len(), totalTime)
+		}
+		mem := memFrom(&memBefore, &memAfter, tlsDurations.Len())
+
+		var sampling *samplingReport
+		if *maxSamples > 0 {
+			sampling = &samplingReport{MaxSamples: *maxSamples, Successful: tlsDurations.Len(), Retained: tlsStats.Count}
+		}
+
+		// 离群值、-trim 和 -hist 需要全部样本，-hdr 时不可用
+		var outliers *outlierReport
+		var trimmedStats *Stats
+		var tlsValues []float64
+		switch rec := tlsDurations.(type) {
+		case *exactRecorder:
+			tlsValues = rec.values
+		case *reservoirRecorder:
+			tlsValues = rec.values // 均匀抽样，离群值比例和直方图形状仍有代表性
+		}
+		if tlsValues != nil {
+			r, tlsKept := findOutliers(tlsValues)
+			outliers = &r
+			if *trim {
+				s := calculateStats(tlsKept)
+				trimmedStats = &s
+			}
+		}
+
+		var jitter *float64
+		if j, ok := jitterSum.Value(); ok {
+			jitter = &j
+		}
+
+		var bucketStats, promStats []bucketReport
+		if buckets != nil {
+			bucketStats = buckets.Report()
+		}
+		if promBuckets != nil {
+			promStats = promBuckets.Report()
+		}
+
+		var byVersion map[string]Stats
+		if len(versionDurations) > 1 {
+			byVersion = make(map[string]Stats, len(versionDurations))
+			for name, r := range versionDurations {
+				byVersion[name] = r.Stats()
+			}
+		}
+
+		var resumed *resumption
+		if *resume {
+			resumed = &resumption{
+				ResumedPercent: float64(resumedDurations.Len()) / float64(tlsDurations.Len()) * 100.0,
+			}
+			if fullDurations.Len() > 0 {
+				full := fullDurations.Stats()
+				resumed.Full = &full
+			}
+			if resumedDurations.Len() > 0 {
+				r := resumedDurations.Stats()
+				resumed.Resumed = &r
+			}
+		}
+
+		// 与基线对比
+		regressed := false
+		compareBaseline := func() {
+			if baseline != nil {
+				fmt.Fprintln(out)
+				regressed = printBaselineComparison(out, baseline, tcpStats, tlsStats, totalStats, *regressThreshold)
+			}
+		}
+
+		report := &jsonReport{
+			Schema:             reportSchema,
+			Tool:               "go",
+			Library:            tlsLibrary,
+			Host:               host,
+			Port:               port,
+			SNI:                tg.SNI,
+			Unix:               tg.Unix,
+			ConnectOnly:        opts.ConnectOnly,
+			Count:              measured,
+			Interrupted:        interrupted,
+			Aborted:            aborted,
+			Successful:         tlsDurations.Len(),
+			Errors:             errors,
+			ErrorKinds:         errorCounts,
+			Unit:               "ms",
+			GoVersion:          runtime.Version(),
+			CryptoMode:         cryptoMode(),
+			Seed:               seed,
+			DNS:                dnsStats,
+			Verify:             verifyStats,
+			Phases:             phasesStats,
+			TTFB:               ttfbStats,
+			HTTPStatus:         httpStatuses,
+			TCP:                tcpStats,
+			TLS:                tlsStats,
+			Total:              totalStats,
+			Negotiated:         first,
+			Cert:               cert,
+			OCSP:               ocsp,
+			Versions:           versions,
+			ByVersion:          byVersion,
+			Buckets:            bucketStats,
+			promBuckets:        promStats,
+			Groups:             groups,
+			ChainDepths:        chainDepths,
+			Families:           families,
+			SourceAddrs:        sourceAddrs,
+			ClientCertRequests: clientCertRequests,
+			Throughput:         rate,
+			CPU:                cpu,
+			Memory:             mem,
+			Outliers:           outliers,
+			TLSTrimmed:         trimmedStats,
+			ServerWarmup:       warmupEffect,
+			Resumption:         resumed,
+			QUIC:               quicStats,
+			TFO:                tfoStats,
+			Netem:              netemStats,
+			Predial:            predialStats,
+			Paired:             pairedStats,
+			CryptoOnly:         cryptoOnly,
+			Reuse:              reuseStats,
+			PQ:                 pqStats,
+			ECH:                ech,
+			Padding:            padding,
+			TLSJitter:          jitter,
+			HDRDigits:          *hdrDigits,
+			Sampling:           sampling,
+			ColdStartDiscarded: coldDiscarded,
+			Retried:            retried,
+			RetryAttempts:      retryAttempts,
+			SLO:                newSLOReport(*sloMs, *sloTarget, sloWithin, measured),
+			Geo:                geo,
+			Warmup:             warmup,
+		}
+		// 阈值检查
+		failures := thresholdFailures(tlsStats, warn, *failOnWarn, *maxP50, *maxP99)
+		if slo := report.SLO; slo != nil && !slo.Passed {
+			failures = append(failures, fmt.Sprintf("SLO compliance %.1f%% < -slo-target %g%% (total <= %s)", slo.Compliance, slo.Target, unit.f(0, slo.ThresholdMs)))
+		}
+		checkThresholds := func() {
+			if !*failOnWarn && *maxP50 == 0 && *maxP99 == 0 && *sloTarget == 0 {
+				return
+			}
+			fmt.Fprintln(out)
+			fmt.Fprintln(out, "=== Threshold Check ===")
+			if len(failures) == 0 {
+				fmt.Fprintln(out, "✅ All thresholds passed")
+				return
+			}
+			for _, f := range failures {
+				fmt.Fprintf(out, "❌ %s\n", f)
+			}
+		}
+
+		exitCode := func() int {
+			if regressed || len(failures) > 0 || aborted {
+				return 1
+			}
+			return 0
+		}
+
+		if len(hopDurations) > 0 {
+			for i, p := range append([]*proxyConfig{proxy}, chain...) {
+				hop := chainHop{Scheme: p.Scheme, Addr: p.Addr}
+				if hopDurations[i].Len() > 0 {
+					s := hopDurations[i].Stats()
+					hop.Connect = &s
+				}
+				report.Chain = append(report.Chain, hop)
+			}
+			report.Tunnel = proxyStats
+		} else if proxy != nil && proxy.Scheme == "http" {
+			report.HTTPConnect = proxyStats
+		} else {
+			report.SOCKS5 = proxyStats
+		}
+
+		if *jsonOutput {
+			compareBaseline()
+			checkThresholds()
+			return report, exitCode()
+		}
+
+		fmt.Fprintln(out, "=== Results ===")
+		fmt.Fprintf(out, "Successful: %d/%d\n", tlsDurations.Len(), measured)
+		if sampling != nil && sampling.Retained < sampling.Successful {
+			fmt.Fprintf(out, "Sampling: stats from a uniform reservoir sample of %d/%d successful handshakes (-max-samples %d)\n",
+				sampling.Retained, sampling.Successful, sampling.MaxSamples)
+		}
+		if errors > 0 {
+			fmt.Fprintf(out, "Errors: %d (%s)\n", errors, formatErrorKinds(errorCounts))
+		} else {
+			fmt.Fprintln(out, "Errors: 0")
+		}
+		if interrupted {
+			fmt.Fprintln(out, "⚠️  Run interrupted (Ctrl-C): statistics cover only the handshakes completed so far")
+		}
+		if certErr != nil {
+			fmt.Fprintln(out, "⚠️  Run aborted on a certificate verification failure; statistics cover only the handshakes completed so far")
+			printCertDiagnostic(out, certErr)
+		} else if aborted {
+			fmt.Fprintf(out, "⚠️  Run aborted: %d consecutive failures (-fail-fast); statistics cover only the handshakes completed so far\n", *failFast)
+		}
+		if *delay > 0 {
+			fmt.Fprintf(out, "Throughput: %.1f handshakes/s (%.1f/s excluding -delay sleep)\n", rate.WithDelay, rate.WithoutDelay)
+		} else {
+			fmt.Fprintf(out, "Throughput: %.1f handshakes/s\n", rate.WithDelay)
+		}
+		if cpu != nil {
+			fmt.Fprintf(out, "CPU Time: %s user + %s sys", unit.f(0, cpu.UserMs), unit.f(0, cpu.SysMs))
+			if cpu.PerHandshakeMs > 0 {
+				fmt.Fprintf(out, " = %s per handshake", unit.f(0, cpu.PerHandshakeMs))
+			}
+			fmt.Fprintf(out, " (%.0f%% of one core)\n", cpu.Utilization)
+			if selfServer != nil {
+				fmt.Fprintln(out, "  note: includes the in-process -selftest server's side of every handshake")
+			}
+		}
+		fmt.Fprintf(out, "Allocations: %d allocs, %s", mem.Allocs, formatBytes(float64(mem.Bytes)))
+		if mem.AllocsPerHandshake > 0 {
+			fmt.Fprintf(out, " (%.0f allocs, %s per handshake)", mem.AllocsPerHandshake, formatBytes(mem.BytesPerHandshake))
+		}
+		fmt.Fprintf(out, ", %d GC cycles\n", mem.GCCycles)
+		if *retries > 0 {
+			fmt.Fprintf(out, "Retried: %d/%d samples needed a retry (%d retries total)\n", retried, measured, retryAttempts)
+		}
+		if slo := report.SLO; slo != nil {
+			fmt.Fprintf(out, "SLO compliance: %.1f%% (%d/%d handshakes with total <= %s", slo.Compliance, slo.Within, slo.Measured, unit.f(0, slo.ThresholdMs))
+			if slo.Target > 0 {
+				fmt.Fprintf(out, ", target %g%%", slo.Target)
+			}
+			fmt.Fprintln(out, ")")
+		}
+		if !opts.ConnectOnly {
+			fmt.Fprintf(out, "Negotiated: %s\n", first)
+			if len(versions) > 1 {
+				fmt.Fprintf(out, "⚠️  TLS version changed during the run: %s\n", formatCounts(versions))
+			}
+			if len(groups) > 0 {
+				fmt.Fprintf(out, "Key Exchange: %s\n", formatCounts(groups))
+				if len(groups) > 1 {
+					fmt.Fprintln(out, "⚠️  More than one key exchange group was negotiated; their costs differ, pin one with -groups")
+				}
+			}
+			if cert != nil {
+				fmt.Fprintf(out, "Certificate: %s\n", cert.Subject)
+				fmt.Fprintf(out, "  issuer:  %s\n", cert.Issuer)
+				fmt.Fprintf(out, "  expires: %s (%d days left, chain of %d)\n", cert.NotAfter.UTC().Format(time.DateOnly), cert.DaysLeft, cert.ChainDepth)
+				if len(chainDepths) > 1 {
+					fmt.Fprintf(out, "  ⚠️  chain length varied between handshakes (certificates sent: %s) - different edges serve different chains\n", formatCounts(chainDepths))
+				}
+				switch {
+				case time.Now().After(cert.NotAfter):
+					fmt.Fprintln(out, "  ⚠️  certificate has EXPIRED")
+				case time.Until(cert.NotAfter) < certExpiryWarn:
+					fmt.Fprintf(out, "  ⚠️  certificate expires within %d days\n", int(certExpiryWarn.Hours()/24))
+				}
+			}
+			switch {
+			case ocsp.Stapled == 0:
+				fmt.Fprintf(out, "OCSP Stapling: not stapled (0/%d full handshakes)\n", ocsp.FullHandshakes)
+			default:
+				fmt.Fprintf(out, "OCSP Stapling: %d/%d full handshakes (%s)\n", ocsp.Stapled, ocsp.FullHandshakes, formatCounts(ocsp.Status))
+				if ocsp.NextUpdate != nil {
+					fmt.Fprintf(out, "  next update: %s\n", ocsp.NextUpdate.UTC().Format(time.RFC3339))
+					if time.Now().After(*ocsp.NextUpdate) {
+						fmt.Fprintln(out, "  ⚠️  stapled response is stale (past its next update)")
+					}
+				}
+				if ocsp.Unverified > 0 {
+					fmt.Fprintf(out, "  ⚠️  signature not verified in %d staples: %s\n", ocsp.Unverified, ocsp.SignatureError)
+				}
+				if ocsp.Status["revoked"] > 0 {
+					fmt.Fprintln(out, "  ⚠️  staple reports the certificate as REVOKED")
+				}
+			}
+			if pqCount := groups[tls.X25519MLKEM768.String()]; *pq && pqCount != tlsDurations.Len() {
+				fmt.Fprintf(out, "⚠️  Only %d/%d handshakes used X25519MLKEM768 - the rest are NOT post-quantum numbers\n", pqCount, tlsDurations.Len())
+			}
+		}
+		if *dualStack {
+			fmt.Fprintf(out, "Dual-stack winners: %s\n", formatCounts(families))
+		}
+		if len(sourceAddrs) > 0 {
+			fmt.Fprintf(out, "Source Addresses: %s\n", formatCounts(sourceAddrs))
+			if len(sourceAddrs) > 1 || sourceAddrs[sourceLabel(opts.LocalAddr.String(), ifaceNames)] == 0 {
+				fmt.Fprintf(out, "⚠️  some connections did not leave from -local-addr %s\n", opts.LocalAddr)
+			}
+		}
+		for _, g := range geo {
+			printGeo(out, g, tcpStats.P50)
+		}
+		if len(tlsConfig.NextProtos) > 0 && first.ALPN == "" {
+			fmt.Fprintln(out, "ALPN: server selected no protocol")
+		}
+		switch {
+		case clientCertRequests > 0:
+			fmt.Fprintf(out, "Client Certificate: requested by server (%d/%d handshakes)\n", clientCertRequests, tlsDurations.Len())
+		case len(tlsConfig.Certificates) > 0:
+			fmt.Fprintln(out, "⚠️  Client Certificate: configured but never requested by the server (mTLS not in use)")
+		}
+		fmt.Fprintln(out)
+
+		// -max-samples 时按保留的样本数判断
+		if names, need := thinPercentiles(tlsStats.Count); len(names) > 0 {
+			counts := make([]string, len(need))
+			for i, m := range need {
+				counts[i] = strconv.Itoa(m)
+			}
+			raise := "-count"
+			if sampling != nil {
+				raise = "-max-samples"
+			}
+			fmt.Fprintf(out, "⚠️  Only %d successful samples: %s below are rough estimates (need >= %s samples respectively; raise %s)\n",
+				tlsStats.Count, strings.Join(names, ", "), strings.Join(counts, ", "), raise)
+			fmt.Fprintln(out)
+		}
+
+		dnsTitle, tcpTitle, totalTitle := "DNS Resolution Latency:", "TCP Connection Latency:", "Total (TCP + TLS):"
+		dnsHost := "host"
+		if proxy != nil {
+			dnsTitle, tcpTitle = "DNS Resolution Latency (proxy host):", "TCP Connection Latency (to proxy):"
+			totalTitle = "Total (TCP + " + proxy.Name() + " + TLS):"
+			dnsHost = "proxy host"
+		}
+		switch {
+		case tg.Unix != "":
+			fmt.Fprintln(out, "DNS Resolution Latency: n/a (Unix socket)")
+			fmt.Fprintln(out, "TCP Connection Latency: n/a (Unix socket)")
+			fmt.Fprintln(out)
+			totalTitle = "Total (TLS over Unix socket):"
+		case dnsStats != nil:
+			printStats(out, dnsTitle, *dnsStats)
+			fmt.Fprintln(out)
+			printStats(out, tcpTitle, tcpStats)
+			fmt.Fprintln(out)
+		default:
+			fmt.Fprintf(out, "DNS Resolution Latency: skipped (%s is an IP literal)\n", dnsHost)
+			fmt.Fprintln(out)
+			printStats(out, tcpTitle, tcpStats)
+			fmt.Fprintln(out)
+		}
+
+		if proxyStats != nil && report.Chain != nil {
+			printStats(out, fmt.Sprintf("Proxy Chain Tunnel Latency (%d hops):", len(report.Chain)), *proxyStats)
+			fmt.Fprintf(out, "  share of total: %.1f%% (mean)\n", proxyStats.Mean/totalStats.Mean*100.0)
+			// 各跳依次计时，互不重叠，之和即隧道总耗时；第 i 跳的往返要穿过前 i-1 跳
+			fmt.Fprintln(out, "  per-hop CONNECT (each includes the round trip through earlier hops):")
+			for i, hop := range report.Chain {
+				next := "target"
+				if i+1 < len(report.Chain) {
+					next = report.Chain[i+1].Addr
+				}
+				if hop.Connect == nil {
+					fmt.Fprintf(out, "    %d. %s %s → %s: no samples\n", i+1, hop.Scheme, hop.Addr, next)
+					continue
+				}
+				fmt.Fprintf(out, "    %d. %s %s → %s: p50 %s, mean %s (%.1f%% of the tunnel)\n", i+1, hop.Scheme, hop.Addr, next,
+					unit.f(0, hop.Connect.P50), unit.f(0, hop.Connect.Mean), hop.Connect.Mean/proxyStats.Mean*100.0)
+			}
+			fmt.Fprintln(out)
+		} else if proxyStats != nil {
+			title := "SOCKS5 CONNECT Latency (proxy → target hop):"
+			if proxy.Scheme == "http" {
+				title = "HTTP CONNECT Latency (proxy → target hop):"
+			}
+			printStats(out, title, *proxyStats)
+			fmt.Fprintf(out, "  share of total: %.1f%% (mean)\n", proxyStats.Mean/totalStats.Mean*100.0)
+			fmt.Fprintln(out)
+		}
+
+		if !opts.ConnectOnly {
+			printStats(out, "TLS Handshake Latency ("+tlsLibrary+"):", tlsStats)
+			fmt.Fprintf(out, "  p90→p99 gap: %s\n", unit.f(6, tlsStats.P99-tlsStats.P90))
+			if jitter != nil {
+				if *concurrency > 1 {
+					fmt.Fprintf(out, "  jitter:      %s (per worker)\n", unit.f(6, *jitter))
+				} else {
+					fmt.Fprintf(out, "  jitter:      %s\n", unit.f(6, *jitter))
+				}
+			}
+			fmt.Fprintln(out)
+
+			switch {
+			case outliers == nil:
+				fmt.Fprintln(out, "TLS Outliers (1.5×IQR): not tracked with -hdr (samples are not kept)")
+			case len(outliers.Values) == 0:
+				fmt.Fprintln(out, "TLS Outliers (1.5×IQR): none")
+			default:
+				fmt.Fprintf(out, "TLS Outliers (outside 1.5×IQR fences [%s, %s]): %d/%d\n",
+					unit.f(0, outliers.LowerFence), unit.f(0, outliers.UpperFence), len(outliers.Values), tlsDurations.Len())
+				shown := make([]string, 0, maxOutliersShown)
+				for i := len(outliers.Values) - 1; i >= 0 && len(shown) < maxOutliersShown; i-- {
+					shown = append(shown, unit.f(0, outliers.Values[i])) // 最慢的排在前面
+				}
+				if rest := len(outliers.Values) - len(shown); rest > 0 {
+					shown = append(shown, fmt.Sprintf("... and %d more", rest))
+				}
+				fmt.Fprintf(out, "  %s\n", strings.Join(shown, ", "))
+			}
+			fmt.Fprintln(out)
+
+			if trimmedStats != nil {
+				printStats(out, "TLS Handshake Latency (outliers removed):", *trimmedStats)
+				fmt.Fprintln(out)
+			}
+
+			if verifyStats != nil {
+				printStats(out, "Certificate Chain Verification (inside TLS):", *verifyStats)
+				fmt.Fprintln(out)
+			}
+
+			if ocsp.Verify != nil {
+				printStats(out, "OCSP Staple Parsing + Signature Check:", *ocsp.Verify)
+				fmt.Fprintln(out)
+			}
+
+			if phasesStats != nil {
+				for _, p := range []struct {
+					title string
+					s     Stats
+				}{
+					{"TLS Phase 1/4 - ClientHello to first server bytes:", phasesStats.ServerHello},
+					{"TLS Phase 2/4 - first server bytes to VerifyConnection:", phasesStats.ServerFlight},
+					{"TLS Phase 3/4 - VerifyConnection (chain + OCSP checks):", phasesStats.Verify},
+					{"TLS Phase 4/4 - VerifyConnection to Finished:", phasesStats.Finished},
+				} {
+					printStats(out, p.title, p.s)
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintln(out, "  note: TLS phases are approximations; crypto/tls exposes only socket reads and the VerifyConnection callback")
+				fmt.Fprintln(out)
+			}
+
+			printStats(out, totalTitle, totalStats)
+			fmt.Fprintln(out)
+
+			if buckets != nil {
+				printBuckets(out, "TLS Handshake Latency Distribution (-buckets):", buckets)
+				fmt.Fprintln(out)
+			} else if *hist {
+				printHistogram(out, "TLS Handshake Latency Distribution:", tlsValues, *histBuckets)
+				fmt.Fprintln(out)
+			}
+		}
+
+		if ttfbStats != nil {
+			printStats(out, fmt.Sprintf("HTTP TTFB (GET %s after handshake):", opts.HTTPPath), *ttfbStats)
+			fmt.Fprintf(out, "  status: %s\n", formatCounts(httpStatuses))
+			fmt.Fprintln(out)
+		}
+
+		if byVersion != nil {
+			printVersionBreakdown(out, byVersion, tlsStats)
+			fmt.Fprintln(out)
+		}
+
+		if resumed != nil {
+			fmt.Fprintf(out, "Session Resumption: %.1f%% of handshakes resumed (%d/%d)\n",
+				resumed.ResumedPercent, resumedDurations.Len(), tlsDurations.Len())
+			fmt.Fprintln(out)
+			if resumed.Full != nil {
+				printStats(out, "Full Handshake Latency:", *resumed.Full)
+				fmt.Fprintln(out)
+			}
+			if resumed.Resumed != nil {
+				printStats(out, "Resumed Handshake Latency:", *resumed.Resumed)
+				fmt.Fprintln(out)
+			}
+		}
+
+		if ech != nil {
+			fmt.Fprintf(out, "Encrypted Client Hello: accepted in %d/%d handshakes\n", ech.Accepted, ech.Successful)
+			if ech.Accepted < ech.Successful {
+				fmt.Fprintln(out, "  ⚠️  some handshakes completed without ECH - the numbers above mix ECH and plain handshakes")
+			}
+			if b := ech.Baseline; b != nil {
+				printStats(out, "Without ECH (TLS handshake):", *b)
+				fmt.Fprintf(out, "  ECH overhead: p50 %s (%+.1f%%), mean %s (%+.1f%%)\n",
+					unit.signed(tlsStats.P50-b.P50), (tlsStats.P50-b.P50)/b.P50*100.0,
+					unit.signed(tlsStats.Mean-b.Mean), (tlsStats.Mean-b.Mean)/b.Mean*100.0)
+			} else if !interrupted {
+				fmt.Fprintln(out, "Without ECH: no successful handshakes")
+			}
+			if ech.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", ech.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if p := padding; p != nil {
+			sent := strconv.Itoa(p.MinSize)
+			if p.MaxSize != p.MinSize {
+				sent = fmt.Sprintf("%d-%d", p.MinSize, p.MaxSize)
+			}
+			fmt.Fprintf(out, "ClientHello Padding: %s bytes sent (target %d, unpadded %d)\n", sent, p.TargetSize, p.UnpaddedSize)
+			padRate := float64(p.Successful) / float64(p.Handshakes) * 100.0
+			fmt.Fprintf(out, "  success: padded %d/%d (%.1f%%)", p.Successful, p.Handshakes, padRate)
+			if p.UnpaddedHandshakes > 0 {
+				rate := float64(p.UnpaddedSuccessful) / float64(p.UnpaddedHandshakes) * 100.0
+				fmt.Fprintf(out, ", unpadded %d/%d (%.1f%%)\n", p.UnpaddedSuccessful, p.UnpaddedHandshakes, rate)
+				if padRate < rate {
+					fmt.Fprintln(out, "  ⚠️  padded handshakes failed more often - a middlebox or MTU issue may be dropping large ClientHellos")
+				}
+			} else {
+				fmt.Fprintln(out)
+			}
+			if b := p.Unpadded; b != nil {
+				printStats(out, "Without Padding (TLS handshake):", *b)
+				fmt.Fprintf(out, "  padding overhead: p50 %s (%+.1f%%), p99 %s (%+.1f%%)\n",
+					unit.signed(tlsStats.P50-b.P50), (tlsStats.P50-b.P50)/b.P50*100.0,
+					unit.signed(tlsStats.P99-b.P99), (tlsStats.P99-b.P99)/b.P99*100.0)
+			} else if !interrupted {
+				fmt.Fprintln(out, "Without Padding: no successful handshakes")
+			}
+			fmt.Fprintln(out)
+		}
+
+		if pqStats != nil {
+			if c := pqStats.Classical; c != nil {
+				printStats(out, "Classical X25519 Baseline (TLS handshake):", *c)
+				fmt.Fprintf(out, "  X25519MLKEM768 overhead: p50 %s (%+.1f%%), mean %s (%+.1f%%)\n",
+					unit.signed(tlsStats.P50-c.P50), (tlsStats.P50-c.P50)/c.P50*100.0,
+					unit.signed(tlsStats.Mean-c.Mean), (tlsStats.Mean-c.Mean)/c.Mean*100.0)
+			} else {
+				fmt.Fprintln(out, "Classical X25519 Baseline: no successful handshakes")
+			}
+			if pqStats.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", pqStats.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if reuseStats != nil {
+			if r := reuseStats.Requests; r != nil {
+				printStats(out, fmt.Sprintf("Keep-Alive Request Latency (GET %s ×%d on one connection):", reuseStats.Path, r.Count), *r)
+				fmt.Fprintf(out, "  handshake (once):      %s\n", unit.f(0, reuseStats.Handshake))
+				fmt.Fprintf(out, "  amortized per request: %s (handshake spread over %d requests)\n", unit.f(0, reuseStats.Amortized), r.Count)
+				fmt.Fprintf(out, "  a new connection per request would add %s (mean %s)\n", unit.f(0, totalStats.Mean), strings.TrimSuffix(totalTitle, ":"))
+			} else {
+				fmt.Fprintf(out, "Keep-Alive Requests (GET %s): no successful requests\n", reuseStats.Path)
+			}
+			if reuseStats.Error != "" {
+				fmt.Fprintf(out, "  ⚠️  %s\n", reuseStats.Error)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if n := netemStats; n != nil {
+			if n.DirectTLS != nil {
+				// 中位数受抖动影响最小；期望 TCP 增加 1 个往返，TLS 增加 Rounds 个往返
+				tcpAdded, tlsAdded := tcpStats.P50-n.DirectTCP.P50, tlsStats.P50-n.DirectTLS.P50
+				fmt.Fprintf(out, "Injected Latency (+%s per round trip", unit.f(0, n.RTTMs))
+				if n.JitterMs > 0 {
+					fmt.Fprintf(out, ", jitter stdev %s", unit.f(0, n.JitterMs))
+				}
+				fmt.Fprintln(out, "):")
+				if tg.Unix == "" {
+					fmt.Fprintf(out, "  TCP p50: %s direct → %s (%s, expected +%s)\n",
+						unit.f(0, n.DirectTCP.P50), unit.f(0, tcpStats.P50), unit.signed(tcpAdded), unit.f(0, n.RTTMs))
+				}
+				fmt.Fprintf(out, "  TLS p50: %s direct → %s (%s, expected +%s for %.1f round trips)\n",
+					unit.f(0, n.DirectTLS.P50), unit.f(0, tlsStats.P50), unit.signed(tlsAdded), unit.f(0, n.Rounds*n.RTTMs), n.Rounds)
+				if n.JitterMs > 0 {
+					fmt.Fprintf(out, "  TLS stdev: %s direct → %s\n", unit.f(0, n.DirectTLS.Stdev), unit.f(0, tlsStats.Stdev))
+				}
+				if want := n.Rounds * n.RTTMs; want > 0 {
+					fmt.Fprintf(out, "  TLS sensitivity: %.2f (observed / expected added latency)\n", tlsAdded/want)
+				}
+			} else {
+				fmt.Fprintln(out, "Direct Run (no injected latency): no successful handshakes")
+			}
+			if n.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", n.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if tfoStats != nil {
+			if tfoStats.Total != nil {
+				printStats(out, "TCP Fast Open (TCP + TLS):", *tfoStats.Total)
+				fmt.Fprintf(out, "  SYN data accepted: %d/%d\n", tfoStats.SYNDataAccepted, tfoStats.Successful)
+				fmt.Fprintf(out, "  vs normal connect: p50 %s, mean %s\n",
+					unit.signed(tfoStats.Total.P50-totalStats.P50), unit.signed(tfoStats.Total.Mean-totalStats.Mean))
+				if tfoStats.SYNDataAccepted == 0 {
+					fmt.Fprintln(out, "  ⚠️  server never accepted SYN data (TFO disabled on the server or middlebox?)")
+				}
+			} else {
+				fmt.Fprintln(out, "TCP Fast Open: no successful handshakes")
+			}
+			if tfoStats.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", tfoStats.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if predialStats != nil {
+			if p := predialStats.TLS; p != nil {
+				printStats(out, "TLS-only (pre-dialed) Handshake Latency:", *p)
+				fmt.Fprintf(out, "  pool: %d TCP connections dialed before timing started\n", predialStats.PoolSize)
+				fmt.Fprintf(out, "  vs TLS phase of normal connects: p50 %s, stdev %s\n",
+					unit.signed(p.P50-tlsStats.P50), unit.signed(p.Stdev-tlsStats.Stdev))
+			} else {
+				fmt.Fprintln(out, "TLS-only (pre-dialed): no successful handshakes")
+			}
+			if predialStats.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", predialStats.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if pairedStats != nil {
+			if o := pairedStats.Overhead; o != nil {
+				printStats(out, "Paired TLS Overhead ((TCP + TLS) − adjacent TCP-only connect):", *o)
+				fmt.Fprintf(out, "  pairs: %d, TCP-only connect p50 %s\n", pairedStats.Pairs, unit.f(0, pairedStats.TCPOnly.P50))
+				fmt.Fprintf(out, "  vs TLS phase of the main run: p50 %s, stdev %s vs %s\n",
+					unit.signed(o.P50-tlsStats.P50), unit.f(0, o.Stdev), unit.f(0, tlsStats.Stdev))
+				if o.Min < 0 {
+					fmt.Fprintln(out, "  note: some differences are negative - the TCP-only connect was slower than the full connect's TCP phase")
+				}
+			} else {
+				fmt.Fprintln(out, "Paired TLS Overhead: no successful pairs")
+			}
+			if pairedStats.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", pairedStats.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if cryptoOnly != nil {
+			if c := cryptoOnly.TLS; c != nil {
+				printStats(out, fmt.Sprintf("Crypto-only (loopback) TLS Handshake (in-process server, %s certificate):", cryptoOnly.Certificate), *c)
+				if d := tlsStats.P50 - c.P50; d > 0 {
+					fmt.Fprintf(out, "  network round trips + target server time: p50 %s (%.1f%% of the main run's TLS phase)\n", unit.f(0, d), d/tlsStats.P50*100.0)
+				} else {
+					fmt.Fprintf(out, "  note: not faster than the main run's TLS phase (p50 %s) - the target is local too or signs with a cheaper key than %s\n",
+						unit.f(0, tlsStats.P50), cryptoOnly.Certificate)
+				}
+				fmt.Fprintln(out, "  includes the in-process server's CPU cost; compare tools with the same -handshake-only setup")
+			} else {
+				fmt.Fprintln(out, "Crypto-only (loopback): no successful handshakes")
+			}
+			if cryptoOnly.Errors > 0 {
+				fmt.Fprintf(out, "  errors: %d\n", cryptoOnly.Errors)
+			}
+			fmt.Fprintln(out)
+		}
+
+		if quicStats != nil {
+			if quicStats.OneRTT != nil {
+				printStats(out, "QUIC Handshake Latency (1-RTT):", *quicStats.OneRTT)
+				fmt.Fprintln(out)
+			}
+			if quicStats.ZeroRTT != nil {
+				printStats(out, "QUIC Handshake Latency (0-RTT attempted, until connection usable):", *quicStats.ZeroRTT)
+				fmt.Fprintf(out, "  0-RTT accepted: %d/%d\n", quicStats.ZeroRTTAccepted, quicStats.ZeroRTTAttempts)
+				fmt.Fprintln(out)
+			}
+			if ed := quicStats.EarlyData; ed != nil {
+				if ed.OneRTT != nil {
+					printStats(out, fmt.Sprintf("HTTP/3 GET %s Sent After 1-RTT Handshake (dial to first response byte):", ed.Path), *ed.OneRTT)
+					fmt.Fprintln(out)
+				}
+				if ed.ZeroRTT != nil {
+					printStats(out, fmt.Sprintf("HTTP/3 GET %s Sent as 0-RTT Early Data (dial to first response byte):", ed.Path), *ed.ZeroRTT)
+					fmt.Fprintf(out, "  early data accepted: %d, rejected and resent after the handshake: %d\n", ed.Accepted, ed.Rejected)
+					if ed.OneRTT != nil {
+						fmt.Fprintf(out, "  p50 saving vs 1-RTT: %s\n", unit.signed(ed.OneRTT.P50-ed.ZeroRTT.P50))
+					}
+					fmt.Fprintln(out)
+				}
+			}
+			if quicStats.Errors > 0 {
+				fmt.Fprintf(out, "QUIC errors: %d\n", quicStats.Errors)
+				fmt.Fprintln(out)
+			}
+		}
+
+		// 分析（-connect-only 时没有握手可分析）
+		if !opts.ConnectOnly {
+			fmt.Fprintln(out, "=== Analysis ===")
+			tlsRatio := tlsStats.Mean / totalStats.Mean * 100.0
+			fmt.Fprintf(out, "TLS handshake accounts for %.1f%% of total latency\n", tlsRatio)
+			if verifyStats != nil {
+				fmt.Fprintf(out, "Chain verification accounts for %.1f%% of TLS handshake time (mean %s)\n",
+					verifyStats.Mean/tlsStats.Mean*100.0, unit.f(0, verifyStats.Mean))
+			}
+
+			if tlsStats.Stdev > warn.Stdev {
+				fmt.Fprintf(out, "⚠️  High TLS variance (stdev=%s > %s) - handshake time unstable\n", unit.f(0, tlsStats.Stdev), unit.f(0, warn.Stdev))
+			} else {
+				fmt.Fprintf(out, "✅ TLS variance is acceptable (stdev=%s <= %s)\n", unit.f(0, tlsStats.Stdev), unit.f(0, warn.Stdev))
+			}
+
+			if tlsStats.P99-tlsStats.P90 > warn.Gap {
+				fmt.Fprintf(out, "⚠️  Large p90→p99 gap (%s > %s) - occasional slow handshakes\n", unit.f(0, tlsStats.P99-tlsStats.P90), unit.f(0, warn.Gap))
+			} else {
+				fmt.Fprintf(out, "✅ p90→p99 gap is acceptable (%s <= %s)\n", unit.f(0, tlsStats.P99-tlsStats.P90), unit.f(0, warn.Gap))
+			}
+
+			if tlsStats.Stdev > 0 {
+				fmt.Fprintf(out, "TLS distribution shape: skewness %.2f, excess kurtosis %.2f (%s)\n",
+					tlsStats.Skewness, tlsStats.Kurtosis, describeShape(tlsStats.Skewness, tlsStats.Kurtosis))
+			}
+
+			if tlsStats.P50 > warn.P50 {
+				fmt.Fprintf(out, "⚠️  High p50 (%s > %s) - base handshake latency is high\n", unit.f(0, tlsStats.P50), unit.f(0, warn.P50))
+			} else {
+				fmt.Fprintf(out, "✅ p50 is acceptable (%s <= %s)\n", unit.f(0, tlsStats.P50), unit.f(0, warn.P50))
+			}
+
+			if w := warmupEffect; w != nil {
+				detail := fmt.Sprintf("first %d vs last %d handshakes: TLS median %s vs %s, %.2f×, Mann-Whitney p=%.3f",
+					w.N, w.N, unit.f(0, w.FirstMedian), unit.f(0, w.LastMedian), w.Ratio, w.PValue)
+				switch {
+				case !w.Detected:
+					fmt.Fprintf(out, "✅ No server cold start (%s)\n", detail)
+				case w.TCPRatio >= serverWarmupRatio:
+					fmt.Fprintf(out, "⚠️  Cold start detected, but TCP connects were also %.1f× slower - likely the network path rather than server TLS caches (%s)\n", w.TCPRatio, detail)
+				default:
+					fmt.Fprintf(out, "⚠️  Server cold-start detected: first %d handshakes %.1f× slower (%s; session ticket/OCSP caches warming up? -warmup handshakes are already excluded)\n",
+						w.N, w.Ratio, detail)
+				}
+			}
+		}
+
+		compareBaseline()
+		checkThresholds()
+		return report, exitCode()
+	}
+
+	var reports []*jsonReport
+	code := 0
+	previous := make(map[target]*jsonReport) // -repeat 时每个目标上一轮的报告，用于趋势箭头
+	for run := 1; run <= *repeat && !stopped(stop); run++ {
+		if *repeat > 1 {
+			if run > 1 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "=== Run %d/%d ===\n", run, *repeat)
+		}
+		for i, t := range targets {
+			if stopped(stop) {
+				fmt.Fprintf(out, "\nSkipping %d remaining targets (interrupted)\n", len(targets)-i)
+				break
+			}
+			if len(targets) > 1 {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "=== Target %d/%d: %s ===\n", i+1, len(targets), t)
+			}
+			started := time.Now()
+			report, c := benchTarget(t)
+			if *repeat > 1 {
+				report.Run = run
+				if p := previous[t]; p != nil && p.Successful > 0 && report.Successful > 0 && !*jsonOutput {
+					fmt.Fprintln(out)
+					printTrend(out, p, report)
+				}
+				previous[t] = report
+			}
+			if *jsonlPath != "" {
+				if err := appendJSONL(*jsonlPath, newRunSummary(report, started)); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to append to -append-jsonl file: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			reports = append(reports, report)
+			code = max(code, c)
+		}
+	}
+	if *memProfile != "" {
+		if err := writeMemProfile(*memProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write -memprofile: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *selftest {
+		fmt.Fprintln(out)
+		if !printSelftest(out, reports) {
+			code = 1
+		}
+	}
+
+	// Rust 端失败不影响已完成的 Go 结果，只给出原因并以 1 退出
+	if *compareRust && !stopped(stop) {
+		t := targets[0]
+		fmt.Fprintf(out, "\nRunning Rust: %s %s %d %d ...\n", *rustBin, t.Host, t.Port, count)
+		fmt.Fprintln(out, "  note: the Rust tool verifies against webpki roots with its default ALPN and groups; Go-only options do not apply to it")
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		rustReport, err := runRust(ctx, *rustBin, t.Host, t.Port, count)
+		cancel()
+		fmt.Fprintln(out)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "⚠️  Rust run failed, no comparison: %v\n", err)
+			code = max(code, 1)
+		case reports[0].Successful == 0:
+			fmt.Fprintln(out, "⚠️  Go run had no successful handshakes, no comparison")
+			code = max(code, 1)
+		default:
+			printRustComparison(out, reports[0], rustReport)
+		}
+	}
+
+	if csvOut != nil {
+		if err := csvOut.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write CSV: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if rawOut != nil {
+		if err := rawOut.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write -raw output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *csvSummaryPath != "" {
+		if err := writeCSVSummary(*csvSummaryPath, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write -csv-summary file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *promPath != "" {
+		if err := writePromFile(*promPath, reports, *promExemplars); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write Prometheus file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *jsonOutput {
+		// 单目标保持原来的单个对象，多目标或 -repeat 输出数组
+		var v any = reports
+		if len(reports) == 1 && *repeat == 1 {
+			v = reports[0] // 全部失败时同样输出，successful 为 0，error_kinds 给出原因
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode JSON: %v\n", err)
+			os.Exit(1)
+		}
+		return code
+	}
+
+	if *mdOutput {
+		for i, r := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			printMarkdown(os.Stdout, r)
+		}
+	}
+
+	if *repeat > 1 {
+		seen := make(map[target]bool)
+		for _, t := range targets {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			var runs []*jsonReport
+			for _, r := range reports {
+				if r.target() == t {
+					runs = append(runs, r)
+				}
+			}
+			if len(runs) > 0 {
+				fmt.Fprintln(out)
+				printRepeatSummary(out, t.String(), runs, *unstableSpread)
+			}
+		}
+		return code
+	}
+	if len(targets) > 1 {
+		fmt.Fprintln(out)
+		printTargetSummary(out, reports)
+	}
+	if *sniList != "" && len(reports) > 1 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "=== SNI Comparison ===")
+		if findings := sniFindings(reports, *regressThreshold); len(findings) > 0 {
+			for _, f := range findings {
+				fmt.Fprintf(out, "⚠️  %s\n", f)
+			}
+		} else {
+			fmt.Fprintf(out, "✅ All %d SNI names got the same certificate with TLS p50 within %.0f%% of the median\n", len(reports), *regressThreshold)
+		}
+	}
+	if *eachIP && len(reports) > 1 {
+		fmt.Fprintln(out)
+		printEdgeComparison(out, reports, *regressThreshold)
 	}
+	return code
 }
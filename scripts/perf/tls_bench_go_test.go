@@ -0,0 +1,2546 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCalculateStatsPercentiles(t *testing.T) {
+	durations := make([]float64, 100)
+	for i := range durations {
+		durations[i] = float64(100 - i) // 乱序输入，验证排序
+	}
+
+	s := calculateStats(durations)
+
+	cases := []struct {
+		name      string
+		got, want float64
+	}{
+		{"min", s.Min, 1},
+		{"max", s.Max, 100},
+		{"p50", s.P50, 50.5},
+		{"p90", s.P90, 90.1},
+		{"p95", s.P95, 95.05},
+		{"p99", s.P99, 99.01},
+		{"p99.9 (clamped)", s.P999, 100},
+		{"mean", s.Mean, 50.5},
+	}
+	for _, c := range cases {
+		if !approxEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestCalculateStatsSmallSample(t *testing.T) {
+	s := calculateStats([]float64{10, 20})
+	if !approxEqual(s.P50, 15) || !approxEqual(s.P90, 19) || !approxEqual(s.P99, 19.9) {
+		t.Errorf("got p50=%v p90=%v p99=%v, want 15 19 19.9", s.P50, s.P90, s.P99)
+	}
+
+	s = calculateStats([]float64{7})
+	if s.P50 != 7 || s.P90 != 7 || s.P99 != 7 {
+		t.Errorf("single sample: got p50=%v p90=%v p99=%v, want 7", s.P50, s.P90, s.P99)
+	}
+}
+
+func TestCalculateStatsP999(t *testing.T) {
+	durations := make([]float64, p999MinSamples)
+	for i := range durations {
+		durations[i] = float64(i + 1)
+	}
+
+	s := calculateStats(durations)
+	if !approxEqual(s.P999, 999.001) {
+		t.Errorf("p99.9 = %v, want 999.001", s.P999)
+	}
+}
+
+func TestRunHandshakesConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	measure := func() (handshakeResult, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return handshakeResult{TCP: time.Millisecond, TLS: 2 * time.Millisecond}, nil
+	}
+
+	lastDone := 0
+	samples, _ := runHandshakes(runPlan{Count: 50, Concurrency: 4}, measure, func(done int, s sample) {
+		if done != lastDone+1 {
+			t.Errorf("done = %d after %d", done, lastDone)
+		}
+		lastDone = done
+	})
+
+	if calls != 50 || len(samples) != 50 || lastDone != 50 {
+		t.Fatalf("calls=%d samples=%d done=%d, want 50", calls, len(samples), lastDone)
+	}
+	for i, s := range samples {
+		if s.Index != i+1 {
+			t.Errorf("samples[%d].Index = %d, want %d", i, s.Index, i+1)
+		}
+		if s.Worker < 0 || s.Worker >= 4 {
+			t.Errorf("samples[%d].Worker = %d, want [0, 4)", i, s.Worker)
+		}
+	}
+}
+
+func TestDialDualStackFallsBackToIPv4(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// ::1 上没有监听，主地址族立即失败，应切换到 IPv4
+	conn, err := dialDualStack([]string{"::1", "127.0.0.1"}, port, time.Second)
+	if err != nil {
+		t.Fatalf("dialDualStack: %v", err)
+	}
+	defer conn.Close()
+	if got := addrFamily(conn.RemoteAddr()); got != "IPv4" {
+		t.Errorf("winner family = %s, want IPv4", got)
+	}
+}
+
+func TestCalculateStatsEmpty(t *testing.T) {
+	s := calculateStats(nil)
+	if s != (Stats{}) {
+		t.Errorf("calculateStats(nil) = %+v, want zero Stats", s)
+	}
+
+	s = calculateStats([]float64{})
+	if s.Count != 0 || math.IsNaN(s.Mean) {
+		t.Errorf("calculateStats(empty) = %+v, want zero Stats", s)
+	}
+}
+
+func TestRunHandshakesFailFast(t *testing.T) {
+	// 前两次失败后成功一次，计数清零；此后连续失败 3 次即停止
+	calls := 0
+	measure := func() (handshakeResult, error) {
+		calls++
+		if calls == 3 {
+			return handshakeResult{}, nil
+		}
+		return handshakeResult{}, errors.New("refused")
+	}
+	samples, abort := runHandshakes(runPlan{Count: 100, Concurrency: 1, FailFast: 3}, measure, nil)
+	if len(samples) != 6 {
+		t.Fatalf("got %d samples, want 6", len(samples))
+	}
+	if abort.Err == nil || abort.StopOn {
+		t.Errorf("FailFast: abort = %+v", abort)
+	}
+
+	// StopOn 命中的第一次失败即停止
+	calls = 0
+	stopOn := func(err error) bool { return err.Error() == "cert" }
+	samples, abort = runHandshakes(runPlan{Count: 100, Concurrency: 1, StopOn: stopOn}, func() (handshakeResult, error) {
+		calls++
+		if calls == 4 {
+			return handshakeResult{}, errors.New("cert")
+		}
+		return handshakeResult{}, errors.New("refused")
+	}, nil)
+	if len(samples) != 4 {
+		t.Fatalf("StopOn: got %d samples, want 4", len(samples))
+	}
+	if !abort.StopOn || abort.Err == nil || abort.Err.Error() != "cert" {
+		t.Errorf("StopOn: abort = %+v", abort)
+	}
+}
+
+func TestRunHandshakesDeadline(t *testing.T) {
+	measure := func() (handshakeResult, error) {
+		time.Sleep(time.Millisecond)
+		return handshakeResult{}, nil
+	}
+
+	plan := runPlan{Deadline: time.Now().Add(50 * time.Millisecond), Concurrency: 3, Count: 1}
+	samples, _ := runHandshakes(plan, measure, nil)
+	if len(samples) <= 3 {
+		t.Fatalf("got %d samples, want more than one per worker", len(samples))
+	}
+	for i, s := range samples {
+		if s.Index != i+1 {
+			t.Fatalf("samples[%d].Index = %d, want %d", i, s.Index, i+1)
+		}
+	}
+}
+
+func TestRunHandshakesStop(t *testing.T) {
+	stop := make(chan struct{})
+	measure := func() (handshakeResult, error) {
+		time.Sleep(5 * time.Millisecond)
+		return handshakeResult{}, nil
+	}
+
+	// 休眠远长于测试时间：Stop 必须打断休眠，并等进行中的测量完成后才返回
+	plan := runPlan{Count: 1000, Concurrency: 4, Delay: time.Hour, Stop: stop}
+	time.AfterFunc(20*time.Millisecond, func() { close(stop) })
+	start := time.Now()
+	samples, abort := runHandshakes(plan, measure, nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("runHandshakes took %s after stop", elapsed)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("got %d samples, want one per worker before the stop", len(samples))
+	}
+	if abort.Err != nil {
+		t.Errorf("Stop is not an abort: %+v", abort)
+	}
+}
+
+func TestPrintHistogramBuckets(t *testing.T) {
+	var buf bytes.Buffer
+	printHistogram(&buf, "hist", []float64{1, 1, 2, 3, 4, 5}, 4)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want title + 4 buckets:\n%s", len(lines), buf.String())
+	}
+	want := []int{2, 1, 1, 2} // [1,2) [2,3) [3,4) [4,5]
+	for i, w := range want {
+		fields := strings.Fields(strings.NewReplacer("[", "", ",", "", ")", "", "]", "").Replace(lines[i+1]))
+		if fields[3] != strconv.Itoa(w) {
+			t.Errorf("bucket %d: %q, want count %d", i, lines[i+1], w)
+		}
+	}
+
+	buf.Reset()
+	printHistogram(&buf, "hist", []float64{7, 7, 7}, 10)
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("identical samples: got %d lines, want 2:\n%s", n, buf.String())
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in   string
+		want target
+		ok   bool
+	}{
+		{"example.com:443", target{Host: "example.com", Port: 443}, true},
+		{"[::1]:8443", target{Host: "::1", Port: 8443}, true},
+		{"127.0.0.1:1", target{Host: "127.0.0.1", Port: 1}, true},
+		{"example.com", target{}, false},
+		{"example.com:0", target{}, false},
+		{"example.com:https", target{}, false},
+		{":443", target{}, false},
+		{"unix:///run/proxy.sock", target{Unix: "/run/proxy.sock"}, true},
+		{"unix://", target{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTarget(%q) = %v, %v; want %v, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	in := `# fleet
+example.com:443
+  b.example.com, 8443   # trailing comment
+
+[::1]:443
+bad-line
+c.example.com:99999
+unix:///run/a,b.sock
+`
+	targets, errs, err := readTargets(strings.NewReader(in), "list.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []target{{Host: "example.com", Port: 443}, {Host: "b.example.com", Port: 8443}, {Host: "::1", Port: 443}, {Unix: "/run/a,b.sock"}}
+	if len(targets) != len(want) {
+		t.Fatalf("targets = %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("targets[%d] = %v, want %v", i, targets[i], want[i])
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("errs = %v, want 2 line errors", errs)
+	}
+	for i, prefix := range []string{"list.txt:6:", "list.txt:7:"} {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("errs[%d] = %q, want prefix %q", i, errs[i], prefix)
+		}
+	}
+}
+
+func TestMeasureWithRetries(t *testing.T) {
+	calls := 0
+	flaky := func() (handshakeResult, error) {
+		calls++
+		if calls < 3 {
+			return handshakeResult{}, errors.New("connection reset")
+		}
+		return handshakeResult{TLS: time.Millisecond}, nil
+	}
+	res, err := measureWithRetries(5, 0, flaky)
+	if err != nil || calls != 3 || res.Retries != 2 || res.TLS != time.Millisecond {
+		t.Fatalf("got res=%+v err=%v after %d calls; want success on the 3rd call with Retries=2", res, err, calls)
+	}
+
+	calls = 0
+	res, err = measureWithRetries(1, 0, flaky)
+	if err == nil || calls != 2 || res.Retries != 1 {
+		t.Fatalf("got res=%+v err=%v after %d calls; want failure after 1 retry", res, err, calls)
+	}
+
+	calls = 0
+	_, err = measureWithRetries(3, 0, func() (handshakeResult, error) {
+		calls++
+		return handshakeResult{}, &tls.CertificateVerificationError{Err: errors.New("bad cert")}
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("certificate errors must not be retried: err=%v, calls=%d", err, calls)
+	}
+
+	calls = 0
+	_, err = measureWithRetries(3, 0, func() (handshakeResult, error) {
+		calls++
+		return handshakeResult{}, &net.OpError{Op: "remote error", Err: tls.AlertError(40)}
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("TLS alerts must not be retried: err=%v, calls=%d", err, calls)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{&net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}, errDNS},
+		{fmt.Errorf("TCP connect timed out after 1s: %w", timeout), errTCPTimeout},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, errTCPRefused},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, errTCPConnect},
+		{&proxyError{errors.New("socks5: proxy rejected the username/password")}, errProxy},
+		{&proxyError{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}, errProxy},
+		{fmt.Errorf("TLS handshake timed out after 1s: %w", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}), errTLSTimeout},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, errCert},
+		{x509.HostnameError{Host: "a.test", Certificate: &x509.Certificate{}}, errCert},
+		{&net.OpError{Op: "remote error", Err: tls.AlertError(40)}, errTLSProtocol},
+		{&tlsHandshakeError{errors.New("tls: server selected unsupported protocol version 301")}, errTLSProtocol},
+		{errors.New("tls: not from a handshake"), errOther},
+		{&tlsHandshakeError{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, errReset},
+		{&httpError{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}, errHTTP},
+		{&httpError{errors.New("http: malformed status line \"x\"")}, errHTTP},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, errReset},
+		{io.EOF, errReset},
+		{errors.New("HTTP request failed"), errOther},
+	} {
+		if got := classifyError(tc.err); got != tc.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+	if got := formatErrorKinds(map[string]int{errCert: 2, errTCPTimeout: 5}); got != "5 TCP connect timeout, 2 cert verification failure" {
+		t.Errorf("formatErrorKinds = %q", got)
+	}
+}
+
+func TestConnPool(t *testing.T) {
+	var mu sync.Mutex
+	dialed := 0
+	var open []net.Conn
+	dial := func() (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialed++
+		if dialed == 2 {
+			return nil, errors.New("dial failed")
+		}
+		c, s := net.Pipe()
+		open = append(open, s)
+		return c, nil
+	}
+	p := newConnPool(3, dial)
+	mu.Lock()
+	if dialed < 3 {
+		t.Errorf("newConnPool returned after %d dials, want the pool filled first", dialed)
+	}
+	mu.Unlock()
+	for i := 1; i <= 5; i++ {
+		conn, err := p.Get()
+		if (i == 2) != (err != nil) {
+			t.Fatalf("Get #%d: err = %v", i, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+	p.Close()
+
+	// Close 之后池中剩余的连接都已关闭，对端读到 EOF
+	mu.Lock()
+	defer mu.Unlock()
+	for i, s := range open {
+		s.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := s.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("conn %d after Close: %v, want EOF", i, err)
+		}
+	}
+}
+
+func TestParseLocalAddr(t *testing.T) {
+	ip, iface, err := parseLocalAddr("127.0.0.1", "tcp")
+	if err != nil || !ip.Equal(net.IPv4(127, 0, 0, 1)) || iface == "" {
+		t.Fatalf("parseLocalAddr(127.0.0.1) = %v, %q, %v", ip, iface, err)
+	}
+	// 按接口名解析时取该接口的 IPv4 地址
+	if ip, name, err := parseLocalAddr(iface, "tcp"); err != nil || ip.To4() == nil || name != iface {
+		t.Errorf("parseLocalAddr(%s) = %v, %q, %v", iface, ip, name, err)
+	}
+	if _, _, err := parseLocalAddr("192.0.2.254", "tcp"); err == nil || !strings.Contains(err.Error(), "not assigned") {
+		t.Errorf("unassigned address: err = %v", err)
+	}
+	if _, _, err := parseLocalAddr("no-such-iface0", "tcp"); err == nil {
+		t.Error("unknown interface accepted")
+	}
+	if got := sourceLabel("127.0.0.1", map[string]string{"127.0.0.1": "lo"}); got != "127.0.0.1 (lo)" {
+		t.Errorf("sourceLabel = %q", got)
+	}
+}
+
+func TestProxyHeaderV2(t *testing.T) {
+	const sig = "0d0a0d0a000d0a515549540a"
+	for _, tc := range []struct {
+		name     string
+		src, dst *net.TCPAddr
+		want     string
+	}{
+		{"ipv4", &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324}, &net.TCPAddr{IP: net.IPv4(198, 51, 100, 2), Port: 443},
+			sig + "2111000c" + "c0000201" + "c6336402" + "dc04" + "01bb"},
+		{"mixed families", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2},
+			sig + "21210024" + "20010db8000000000000000000000001" + "00000000000000000000ffff7f000001" + "0001" + "0002"},
+		{"no addresses", nil, nil, sig + "20000000"},
+	} {
+		if got := hex.EncodeToString(proxyHeaderV2(tc.src, tc.dst)); got != tc.want {
+			t.Errorf("%s: proxyHeaderV2 = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseIPPort(t *testing.T) {
+	if a, err := parseIPPort("[2001:db8::7]:4711"); err != nil || a.Port != 4711 || !a.IP.Equal(net.ParseIP("2001:db8::7")) {
+		t.Errorf("parseIPPort = %v, %v", a, err)
+	}
+	for _, s := range []string{"192.0.2.1", "example.com:80", "192.0.2.1:70000"} {
+		if _, err := parseIPPort(s); err == nil {
+			t.Errorf("parseIPPort(%q) succeeded", s)
+		}
+	}
+}
+
+func TestMannWhitneyGreater(t *testing.T) {
+	// 与穷举全部 C(m+n, m) 种分组的结果对照
+	for _, tc := range []struct {
+		a, b []float64
+		want float64
+	}{
+		{[]float64{5, 6, 7, 8, 9}, []float64{0, 1, 2, 3, 4}, 1.0 / 252},
+		{[]float64{3, 1, 4, 1.5, 9}, []float64{2, 6, 5, 3.5, 8}, 0.8452380952380952},
+		{[]float64{1, 2, 3}, []float64{4, 5, 6, 7}, 1},
+	} {
+		if got := mannWhitneyGreater(tc.a, tc.b); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("mannWhitneyGreater(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestServerWarmup(t *testing.T) {
+	tlsTimes := make([]float64, 20)
+	tcpTimes := make([]float64, 20)
+	for i := range tlsTimes {
+		tlsTimes[i] = 1 + float64(i%3)*0.01
+		tcpTimes[i] = 0.2
+	}
+	if w := serverWarmup(tlsTimes, tcpTimes, 5); w == nil || w.Detected {
+		t.Errorf("steady run: %+v", w)
+	}
+	for i := range 5 {
+		tlsTimes[i] = 2.1 + float64(i)*0.01
+	}
+	w := serverWarmup(tlsTimes, tcpTimes, 5)
+	if w == nil || !w.Detected || w.Ratio < 2 || w.TCPRatio != 1 || w.PValue > 0.01 {
+		t.Errorf("cold first 5: %+v", w)
+	}
+	if serverWarmup(tlsTimes[:19], tcpTimes[:19], 5) != nil {
+		t.Error("fewer than 4N samples should not be compared")
+	}
+}
+
+func TestTimeUnitFormat(t *testing.T) {
+	ms := timeUnits["ms"]
+	if got := ms.f(8, 1.5); got != "    1.50ms" {
+		t.Errorf("ms.f(8, 1.5) = %q", got)
+	}
+	if got := timeUnits["us"].signed(-0.25); got != "-250.0us" {
+		t.Errorf("us.signed(-0.25) = %q", got)
+	}
+	// -precision 4：多出的两位加宽列，表格仍然对齐
+	ms.Prec, ms.Wide = 4, 2
+	if got := ms.f(8, 1.5); got != "    1.5000ms" || ms.col(10) != 12 || ms.col(0) != 0 {
+		t.Errorf("-precision 4: f = %q, col(10) = %d", got, ms.col(10))
+	}
+}
+
+func TestReservoirRecorder(t *testing.T) {
+	r := newReservoirRecorder(100)
+	for i := range 100 {
+		r.Add(float64(i))
+	}
+	if s := r.Stats(); r.Len() != 100 || s.Count != 100 || s.Min != 0 || s.Max != 99 {
+		t.Fatalf("below the cap every sample is kept: Len=%d, %+v", r.Len(), s)
+	}
+	for i := 100; i < 100000; i++ {
+		r.Add(float64(i))
+	}
+	s := r.Stats()
+	if r.Len() != 100000 || s.Count != 100 || len(r.values) != 100 {
+		t.Fatalf("Len=%d Count=%d retained=%d, want 100000/100/100", r.Len(), s.Count, len(r.values))
+	}
+	// 均匀抽样：中位数在 50000 附近（100 个样本的标准误约 2900）
+	if s.P50 < 35000 || s.P50 > 65000 {
+		t.Errorf("reservoir p50 = %v, want about 50000", s.P50)
+	}
+}
+
+func TestSeedRandom(t *testing.T) {
+	sample := func(seed uint64) []float64 {
+		seedRandom(seed)
+		r := newReservoirRecorder(10)
+		for i := range 1000 {
+			r.Add(float64(i))
+		}
+		return r.values
+	}
+	a, b := sample(42), sample(42)
+	if !slices.Equal(a, b) {
+		t.Errorf("same seed gave different samples: %v vs %v", a, b)
+	}
+	if c := sample(43); slices.Equal(a, c) {
+		t.Errorf("different seeds gave identical samples: %v", c)
+	}
+}
+
+func TestWritePromFileExemplars(t *testing.T) {
+	b := newLatencyBuckets([]float64{1, 5})
+	at := time.Unix(1700000000, 500_000_000)
+	for i := 1; i <= 100; i++ {
+		ms := 0.5
+		if i > 98 {
+			ms = float64(i) / 25 // 两个 (1, 5] 区间内的慢样本，p99 落在这里
+		}
+		b.Observe(ms, i, at)
+	}
+	r := &jsonReport{Host: "example.com", Port: 443, Successful: 100, TLS: Stats{Count: 100, Mean: 0.6}, promBuckets: b.Report()}
+	path := filepath.Join(t.TempDir(), "tls.prom")
+
+	if err := writePromFile(path, []*jsonReport{r}, true); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	out := string(data)
+	for _, want := range []string{
+		"# TYPE tls_bench_tls_handshake_duration_ms histogram\n",
+		`tls_bench_tls_handshake_duration_ms_bucket{host="example.com",port="443",le="1"} 98` + "\n",
+		`tls_bench_tls_handshake_duration_ms_bucket{host="example.com",port="443",le="5"} 100 # {handshake="100"} 4 1700000000.500` + "\n",
+		`tls_bench_tls_handshake_duration_ms_bucket{host="example.com",port="443",le="+Inf"} 100` + "\n",
+		"# TYPE tls_bench_errors counter\ntls_bench_errors_total{",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("OpenMetrics output must end with # EOF:\n%s", out)
+	}
+
+	// 不加 -prom-exemplars 时保持原来的 textfile 格式
+	if err := writePromFile(path, []*jsonReport{r}, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if out := string(data); strings.Contains(out, "# EOF") || strings.Contains(out, "_bucket") || !strings.Contains(out, "# TYPE tls_bench_errors_total counter") {
+		t.Errorf("plain output changed:\n%s", out)
+	}
+}
+
+func TestTrendArrow(t *testing.T) {
+	for _, c := range []struct {
+		prev, cur float64
+		arrow     string
+	}{
+		{10, 10.3, "→"}, {10, 9.7, "→"}, {10, 10.304, "→"}, {10, 10.4, "↑"}, {10, 9.5, "↓"}, {0, 5, "→"},
+	} {
+		if arrow, _ := trendArrow(c.prev, c.cur); arrow != c.arrow {
+			t.Errorf("trendArrow(%v, %v) = %s, want %s", c.prev, c.cur, arrow, c.arrow)
+		}
+	}
+
+	prev := &jsonReport{Run: 1, TLS: Stats{Count: 10, P50: 1, P90: 2, P95: 2, P99: 4}, Total: Stats{Count: 10, P50: 2, P90: 3, P95: 3, P99: 5}}
+	cur := &jsonReport{Run: 2, TLS: Stats{Count: 10, P50: 1.01, P90: 2.5, P95: 2, P99: 3}, Total: prev.Total}
+	var buf bytes.Buffer
+	printTrend(&buf, prev, cur)
+	out := buf.String()
+	for _, want := range []string{"Trend vs run 1", "p50 1.01ms → +1.0%", "p90 2.50ms ↑ +25.0%", "p99 3.00ms ↓ -25.0%", "Total: p50 2.00ms → +0.0%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "p99.9") {
+		t.Errorf("p99.9 shown with too few samples:\n%s", out)
+	}
+}
+
+func TestCPUFrom(t *testing.T) {
+	r := cpuFrom(100*time.Millisecond, 20*time.Millisecond, 400*time.Millisecond, 70*time.Millisecond, 50, 700*time.Millisecond)
+	if r.UserMs != 300 || r.SysMs != 50 || r.PerHandshakeMs != 7 || r.Utilization != 50 {
+		t.Errorf("cpuFrom = %+v", *r)
+	}
+	if r := cpuFrom(0, 0, time.Millisecond, 0, 0, 0); r.PerHandshakeMs != 0 || r.Utilization != 0 {
+		t.Errorf("no handshakes: %+v", *r)
+	}
+}
+
+func TestMemFrom(t *testing.T) {
+	before := &runtime.MemStats{Mallocs: 100, TotalAlloc: 4096, NumGC: 2}
+	after := &runtime.MemStats{Mallocs: 1100, TotalAlloc: 4096 + 20<<10, NumGC: 5}
+	r := memFrom(before, after, 10)
+	if r.Allocs != 1000 || r.Bytes != 20<<10 || r.AllocsPerHandshake != 100 || r.BytesPerHandshake != 2048 || r.GCCycles != 3 {
+		t.Errorf("memFrom = %+v", *r)
+	}
+	if r := memFrom(before, after, 0); r.AllocsPerHandshake != 0 || r.BytesPerHandshake != 0 {
+		t.Errorf("no handshakes: %+v", *r)
+	}
+	for b, want := range map[float64]string{512: "512 B", 2048: "2.0 KiB", 3 << 20: "3.0 MiB"} {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%v) = %q, want %q", b, got, want)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "mem.pprof")
+	if err := writeMemProfile(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+		t.Errorf("profile not written: %v", err)
+	}
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	r := &jsonReport{Host: "example.com", Port: 443, Count: 10, Successful: 9, Errors: 1,
+		TCP:   Stats{Min: 1, P50: 2, P90: 3, P95: 3.5, P99: 4, Max: 5, Mean: 2.5, Stdev: 0.5},
+		TLS:   Stats{Min: 10, P50: 12, P90: 14, P95: 15, P99: 16, Max: 18, Mean: 12.5, Stdev: 1.25},
+		Total: Stats{Min: 11, P50: 14, P90: 17, P95: 18.5, P99: 20, Max: 23, Mean: 15, Stdev: 1.75},
+	}
+	var buf bytes.Buffer
+	printMarkdown(&buf, r)
+	want := "**TLS handshake benchmark** `example.com:443` — 10 handshakes (9 ok, 1 errors), " +
+		runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH + "\n\n" +
+		"| ms | min | p50 | p90 | p95 | p99 | max | mean | stdev |\n" +
+		"|---|---:|---:|---:|---:|---:|---:|---:|---:|\n" +
+		"| TCP | 1.00 | 2.00 | 3.00 | 3.50 | 4.00 | 5.00 | 2.50 | 0.50 |\n" +
+		"| TLS | 10.00 | 12.00 | 14.00 | 15.00 | 16.00 | 18.00 | 12.50 | 1.25 |\n" +
+		"| Total | 11.00 | 14.00 | 17.00 | 18.50 | 20.00 | 23.00 | 15.00 | 1.75 |\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printMarkdown =\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	printMarkdown(&buf, &jsonReport{Host: "example.com", Port: 443, Count: 3, Errors: 3})
+	if !strings.HasSuffix(buf.String(), "\n\n_No successful handshakes._\n") {
+		t.Errorf("no successes:\n%s", buf.String())
+	}
+}
+
+func TestTLSVersionBounds(t *testing.T) {
+	if v, err := parseTLSVersion("1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("parseTLSVersion(1.3) = %v, %v", v, err)
+	}
+	if v, err := parseTLSVersion(""); err != nil || v != 0 {
+		t.Errorf("parseTLSVersion(\"\") = %v, %v", v, err)
+	}
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Error("parseTLSVersion(1.4) succeeded")
+	}
+	for _, tc := range []struct {
+		min, max         string
+		wantMin, wantMax uint16
+		wantErr          bool
+	}{
+		{"", "", 0, 0, false},
+		{"1.2", "", tls.VersionTLS12, 0, false},
+		{"", "1.2", 0, tls.VersionTLS12, false},
+		{"", "1.1", tls.VersionTLS10, tls.VersionTLS11, false}, // 上限低于默认下限时放开下限
+		{"1.1", "1.1", tls.VersionTLS11, tls.VersionTLS11, false},
+		{"1.3", "1.2", 0, 0, true},
+		{"1.5", "", 0, 0, true},
+	} {
+		lo, hi, err := tlsVersionBounds(tc.min, tc.max)
+		if (err != nil) != tc.wantErr || lo != tc.wantMin || hi != tc.wantMax {
+			t.Errorf("tlsVersionBounds(%q, %q) = %x, %x, %v", tc.min, tc.max, lo, hi, err)
+		}
+	}
+}
+
+func TestPinnedVersionErrors(t *testing.T) {
+	// 进程内服务器默认最低 TLS 1.2，以 protocol_version alert 拒绝 1.0 - 1.1
+	srv := newSelftestServer(nil)
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	opts := &handshakeOptions{TLS: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}, Network: "tcp", ConnectTimeout: time.Second}
+	_, err := measureHandshake("127.0.0.1", port, opts)
+	if err == nil || !strings.HasPrefix(err.Error(), "server cannot satisfy pinned TLS version range (TLS 1.0 - TLS 1.1): ") || classifyError(err) != errTLSProtocol {
+		t.Errorf("TLS 1.0 - 1.1: %v (%s)", err, classifyError(err))
+	}
+
+	// 其他握手失败只附上区间：服务器要求客户端证书，以 bad_certificate 结束握手
+	mtls := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	mtls.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	mtls.Config.ErrorLog = log.New(io.Discard, "", 0)
+	mtls.StartTLS()
+	defer mtls.Close()
+	opts.TLS = &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12}
+	_, err = measureHandshake("127.0.0.1", mtls.Listener.Addr().(*net.TCPAddr).Port, opts)
+	if err == nil || !strings.HasSuffix(err.Error(), " (TLS versions pinned to TLS 1.2 - TLS 1.2)") || strings.Contains(err.Error(), "cannot satisfy") {
+		t.Errorf("client cert required: %v", err)
+	}
+
+	// 端到端：-max-version 1.1 对 -selftest 服务器全部失败，按 TLS 协议错误计数
+	code, out := runCLI(t, "-selftest", "-max-version", "1.1", "-json", "-q", "-warmup", "0", "-delay", "0", "-count", "3")
+	var r jsonReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("stdout is not a JSON report (%v): %q", err, out)
+	}
+	if code != 1 || r.Successful != 0 || r.ErrorKinds[errTLSProtocol] != 3 {
+		t.Errorf("-selftest -max-version 1.1: exit %d, successful %d, error_kinds %v", code, r.Successful, r.ErrorKinds)
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	ids, err := parseGroups("p-256, X25519,secp384r1,x25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tls.CurveID{tls.CurveP256, tls.X25519, tls.CurveP384}
+	if !slices.Equal(ids, want) {
+		t.Errorf("parseGroups = %v, want %v", ids, want)
+	}
+	if ids, err := parseGroups("X25519MLKEM768"); err != nil || !slices.Equal(ids, []tls.CurveID{tls.X25519MLKEM768}) {
+		t.Errorf("parseGroups(X25519MLKEM768) = %v, %v", ids, err)
+	}
+	for _, bad := range []string{"", "ffdhe2048", "P-255"} {
+		if _, err := parseGroups(bad); err == nil {
+			t.Errorf("parseGroups(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDelayConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	const rtt = 30 * time.Millisecond
+	c := newDelayConn(client, &netem{RTT: rtt})
+
+	start := time.Now()
+	for _, b := range []string{"hello", " world"} {
+		if n, err := c.Write([]byte(b)); err != nil || n != len(b) {
+			t.Fatalf("Write(%q) = %d, %v", b, n, err)
+		}
+	}
+	if d := time.Since(start); d >= rtt {
+		t.Errorf("Write blocked for %s, want it to return immediately", d)
+	}
+	got := make([]byte, len("hello world"))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < rtt {
+		t.Errorf("data arrived after %s, want at least %s", d, rtt)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("got %q, want writes in order", got)
+	}
+
+	// Close 后底层连接在送完数据后关闭
+	c.Close()
+	if _, err := c.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write after Close: %v, want net.ErrClosed", err)
+	}
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("server Read after Close: %v, want EOF", err)
+	}
+}
+
+func TestPrintVersionBreakdown(t *testing.T) {
+	tls13 := calculateStats([]float64{1, 1.1, 1.2, 1.3, 1.4, 1.5, 1.6, 1.7, 1.8})
+	tls12 := calculateStats([]float64{9, 10})
+	overall := calculateStats([]float64{1, 1.1, 1.2, 1.3, 1.4, 1.5, 1.6, 1.7, 1.8, 9, 10})
+	overall.P99 = 9 // 让 TLS 1.2 的中位数落在整体 p99 之上
+
+	var buf bytes.Buffer
+	printVersionBreakdown(&buf, map[string]Stats{"TLS 1.3": tls13, "TLS 1.2": tls12}, overall)
+	out := buf.String()
+	if i, j := strings.Index(out, "TLS 1.2 "), strings.Index(out, "TLS 1.3 "); i < 0 || j < 0 || i > j {
+		t.Errorf("versions missing or not sorted:\n%s", out)
+	}
+	if !strings.Contains(out, "  18.2%") || !strings.Contains(out, "  81.8%") {
+		t.Errorf("shares missing:\n%s", out)
+	}
+	if !strings.Contains(out, "TLS 1.2 handshakes (2/11) are slower than the overall p99") {
+		t.Errorf("tail warning missing:\n%s", out)
+	}
+	if strings.Contains(out, "TLS 1.3 handshakes") {
+		t.Errorf("majority version flagged:\n%s", out)
+	}
+}
+
+func TestParseRustText(t *testing.T) {
+	// 与 src/bin/tls_bench.rs 的输出格式一致，进度行以 \r 覆盖
+	out := "=== TLS Handshake Latency Benchmark ===\nHost: example.com:443\nCount: 20\nTLS Library: rustls 0.23 + aws-lc-rs\n\n" +
+		"Running 20 handshakes...\n\r[1/20] \r[10/20] \r[20/20] \rCompleted in 1.2s\n\n" +
+		"=== Results ===\nSuccessful: 19/20\nErrors: 1\n\n" +
+		"TCP Connection Latency:\n  min:       1.00ms\n  p50:       2.00ms\n  p90:       3.00ms\n  p99:       4.00ms\n  max:       5.00ms\n  mean:      2.50ms\n  stdev:     0.50ms\n\n" +
+		"TLS Handshake Latency (rustls 0.23 + aws-lc-rs):\n  min:      10.00ms\n  p50:      12.00ms\n  p90:      14.00ms\n  p99:      16.00ms\n  max:      18.00ms\n  mean:     12.50ms\n  stdev:     1.50ms\n  p90→p99 gap:   2.00ms\n\n" +
+		"Total (TCP + TLS):\n  min:      11.00ms\n  p50:      14.00ms\n  p90:      17.00ms\n  p99:      20.00ms\n  max:      23.00ms\n  mean:     15.00ms\n  stdev:     2.00ms\n\n" +
+		"=== Analysis ===\nTLS handshake accounts for 83.3% of total latency\n"
+	r, err := parseRustText(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Library != "rustls 0.23 + aws-lc-rs" || r.Count != 20 || r.Successful != 19 || r.Errors != 1 {
+		t.Errorf("got library=%q count=%d successful=%d errors=%d", r.Library, r.Count, r.Successful, r.Errors)
+	}
+	wantTLS := Stats{Count: 19, Min: 10, P50: 12, P90: 14, P99: 16, Max: 18, Mean: 12.5, Stdev: 1.5}
+	if r.TLS != wantTLS {
+		t.Errorf("TLS = %+v, want %+v", r.TLS, wantTLS)
+	}
+	if r.TCP.P99 != 4 || r.Total.Max != 23 {
+		t.Errorf("TCP p99 = %g, Total max = %g", r.TCP.P99, r.Total.Max)
+	}
+
+	if _, err := parseRustText("Usage: tls_bench <host> <port> [count]\n"); err == nil {
+		t.Error("parseRustText(usage) succeeded, want error")
+	}
+
+	// 全部失败时没有 Results 部分
+	r, err = parseRustText(rustAllFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Count != 5 || r.Successful != 0 || r.Errors != 5 {
+		t.Errorf("all failed: count=%d successful=%d errors=%d", r.Count, r.Successful, r.Errors)
+	}
+}
+
+// rustAllFailed 是 Rust 版本全部握手失败时的 stdout（原因只在 stderr）
+const rustAllFailed = "=== TLS Handshake Latency Benchmark ===\nHost: example.com:443\nCount: 5\nTLS Library: rustls 0.23 + aws-lc-rs\n\n" +
+	"Warmup (3 connections)...\n  Warmup 1 failed: connection refused\n\nRunning 5 handshakes...\n\r[1/5] \rCompleted in 0.3s\n\n"
+
+func TestRunRustNoSuccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script")
+	}
+	bin := filepath.Join(t.TempDir(), "tls_bench")
+	script := "#!/bin/sh\nprintf '" + strings.ReplaceAll(rustAllFailed, "\n", "\\n") + "'\necho 'No successful handshakes!' >&2\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_, err := runRust(context.Background(), bin, "example.com", 443, 5)
+	if err == nil || err.Error() != "no successful handshakes (No successful handshakes!)" {
+		t.Errorf("runRust = %v", err)
+	}
+}
+
+func TestParseChain(t *testing.T) {
+	chain, err := parseChain("socks5://127.0.0.1:1080, http://user:p@ss@proxy.example:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("got %d hops, want 2", len(chain))
+	}
+	if c := chain[0]; c.Scheme != "socks5" || c.Addr != "127.0.0.1:1080" || c.User != "" {
+		t.Errorf("hop 1 = %+v", *c)
+	}
+	if c := chain[1]; c.Scheme != "http" || c.Addr != "proxy.example:8080" || c.User != "user" || c.Pass != "p@ss" {
+		t.Errorf("hop 2 = %+v", *c)
+	}
+	for _, bad := range []string{"", "127.0.0.1:1080", "https://a:443", "socks5://a", "socks5://:pw@a:1080"} {
+		if _, err := parseChain(bad); err == nil {
+			t.Errorf("parseChain(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestPrintCertDiagnostic(t *testing.T) {
+	ca, caKey := testCert(t, "Test Root", 1, nil, nil)
+	leaf, _ := testCert(t, "leaf.test", 2, ca, caKey)
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: x509.NewCertPool()})
+	wrapped := fmt.Errorf("handshake: %w", &tls.CertificateVerificationError{UnverifiedCertificates: []*x509.Certificate{leaf, ca}, Err: err})
+	if got := rejectedCert(wrapped); got != leaf {
+		t.Fatalf("rejectedCert = %v, want the leaf", got)
+	}
+
+	var buf bytes.Buffer
+	printCertDiagnostic(&buf, wrapped)
+	out := buf.String()
+	for _, want := range []string{"subject: CN=leaf.test", "issuer:  CN=Test Root", "-cacert"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diagnostic missing %q:\n%s", want, out)
+		}
+	}
+
+	// 没有证书的错误只打印错误本身
+	buf.Reset()
+	printCertDiagnostic(&buf, errors.New("boom"))
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("diagnostic without a certificate:\n%s", buf.String())
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	bounds, err := parseBuckets("1, 2,5,10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newLatencyBuckets(bounds)
+	start := time.Unix(1700000000, 0)
+	for i, ms := range []float64{0.5, 1, 1.5, 2, 3, 9.9, 10, 11, 50} {
+		b.Observe(ms, i+1, start.Add(time.Duration(i)*time.Second))
+	}
+	// 区间为 (上一个上界, 上界]，边界值计入较低的区间
+	wantCounts := []int{2, 2, 1, 2, 2}
+	wantCum := []float64{200.0 / 9, 400.0 / 9, 500.0 / 9, 700.0 / 9, 100}
+	r := b.Report()
+	for i := range r {
+		if r[i].Count != wantCounts[i] || math.Abs(r[i].Cumulative-wantCum[i]) > 1e-9 {
+			t.Errorf("bucket %d = %d (%.2f%%), want %d (%.2f%%)", i, r[i].Count, r[i].Cumulative, wantCounts[i], wantCum[i])
+		}
+	}
+	if r[3].LeMs == nil || *r[3].LeMs != 10 || r[4].LeMs != nil {
+		t.Errorf("le bounds wrong: %v, %v", r[3].LeMs, r[4].LeMs)
+	}
+	// 每个区间记下最慢的样本
+	if ex := r[3].Slowest; ex == nil || ex.Ms != 10 || ex.Index != 7 || !ex.At.Equal(start.Add(6*time.Second)) {
+		t.Errorf("bucket 3 slowest = %+v, want the 10ms sample #7", ex)
+	}
+
+	var buf bytes.Buffer
+	printBuckets(&buf, "buckets", b)
+	if !strings.Contains(buf.String(), "(5.00, 10.00ms]") || !strings.Contains(buf.String(), "> 10.00ms") {
+		t.Errorf("unexpected labels:\n%s", buf.String())
+	}
+
+	for _, bad := range []string{"", "0,1", "2,1", "1,1", "x"} {
+		if _, err := parseBuckets(bad); err == nil {
+			t.Errorf("parseBuckets(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestThresholdFailures(t *testing.T) {
+	s := Stats{P50: 35, P90: 40, P99: 55, Stdev: 5}
+	warn := warnThresholds{Stdev: 10, Gap: 10, P50: 30}
+	if got := thresholdFailures(s, warn, false, 0, 0); len(got) != 0 {
+		t.Errorf("no thresholds configured: got %v", got)
+	}
+	if got := thresholdFailures(s, warn, true, 0, 0); len(got) != 2 {
+		t.Errorf("-fail-on-warn: got %v, want p90→p99 gap and p50", got)
+	}
+	if got := thresholdFailures(s, warn, false, 40, 50); len(got) != 1 || !strings.Contains(got[0], "-max-p99") {
+		t.Errorf("-max-p50 40 -max-p99 50: got %v, want only p99", got)
+	}
+	if got := thresholdFailures(s, warnThresholds{Stdev: 1, Gap: 20, P50: 50}, true, 0, 0); len(got) != 1 || !strings.Contains(got[0], "-warn-stdev") {
+		t.Errorf("custom warn thresholds: got %v, want only stdev", got)
+	}
+}
+
+func TestTLSJitter(t *testing.T) {
+	ms := func(v float64) handshakeResult {
+		return handshakeResult{TLS: time.Duration(v * float64(time.Millisecond))}
+	}
+	// worker 0: 1 → 3 → 2，worker 1: 10 → 14；失败的样本不参与配对
+	samples := []sample{
+		{Index: 1, Worker: 0, Result: ms(1)},
+		{Index: 2, Worker: 1, Result: ms(10)},
+		{Index: 3, Worker: 0, Result: ms(3)},
+		{Index: 4, Worker: 0, Err: errors.New("reset")},
+		{Index: 5, Worker: 1, Result: ms(14)},
+		{Index: 6, Worker: 0, Result: ms(2)},
+	}
+	got, ok := tlsJitter(samples)
+	if want := (2.0 + 1.0 + 4.0) / 3; !ok || !approxEqual(got, want) {
+		t.Errorf("tlsJitter = %v, %v; want %v", got, ok, want)
+	}
+	if _, ok := tlsJitter(samples[:2]); ok {
+		t.Error("tlsJitter with no consecutive pair on a worker should report !ok")
+	}
+}
+
+func TestCalculateStatsKeepsInputOrder(t *testing.T) {
+	in := []float64{3, 1, 2}
+	calculateStats(in)
+	if in[0] != 3 || in[1] != 1 || in[2] != 2 {
+		t.Errorf("calculateStats reordered its input: %v", in)
+	}
+}
+
+func TestCertInfoFrom(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	leaf := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		Issuer:   pkix.Name{CommonName: "Example CA"},
+		NotAfter: now.Add(10*24*time.Hour + time.Hour),
+	}
+	info := certInfoFrom(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, {}}}, now)
+	if info == nil || info.Subject != "CN=example.com" || info.Issuer != "CN=Example CA" || info.DaysLeft != 10 || info.ChainDepth != 2 {
+		t.Errorf("certInfoFrom = %+v", info)
+	}
+	if certInfoFrom(tls.ConnectionState{}, now) != nil {
+		t.Error("certInfoFrom without peer certificates should return nil")
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	// 2 个 worker，4 个样本各耗时 100ms（其中 1 个失败），墙钟 1s（其余为休眠）
+	samples := []sample{
+		{Elapsed: 100 * time.Millisecond},
+		{Elapsed: 100 * time.Millisecond},
+		{Elapsed: 100 * time.Millisecond},
+		{Elapsed: 100 * time.Millisecond, Err: errors.New("reset")},
+	}
+	got := throughput(samples, time.Second, 2)
+	if !approxEqual(got.WithDelay, 3) || !approxEqual(got.WithoutDelay, 15) {
+		t.Errorf("throughput = %+v, want with_delay 3, without_delay 15", got)
+	}
+}
+
+func TestFindOutliers(t *testing.T) {
+	// Q1 = 2.75, Q3 = 8.25, IQR = 5.5 → 围栏 [-5.5, 16.5]
+	in := []float64{100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, -20}
+	r, kept := findOutliers(in)
+	if len(r.Values) != 2 || r.Values[0] != -20 || r.Values[1] != 100 {
+		t.Errorf("outliers = %v, want [-20 100]", r.Values)
+	}
+	if len(kept) != 10 || kept[0] != 1 || kept[9] != 10 {
+		t.Errorf("kept = %v, want 1..10 in input order", kept)
+	}
+	if _, kept := findOutliers([]float64{5, 5, 5}); len(kept) != 3 {
+		t.Errorf("identical samples must not be outliers, kept %v", kept)
+	}
+}
+
+func TestRobustStats(t *testing.T) {
+	// 1..10 加一个离群值 1000：截尾去掉 1 和 1000，MAD 不受离群值影响
+	in := []float64{1000, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	s := calculateStats(in)
+	if want := 6.0; !approxEqual(s.TrimmedMean, want) {
+		t.Errorf("TrimmedMean = %v, want %v", s.TrimmedMean, want)
+	}
+	// 中位数 6，偏差 |x-6| = 0,1,1,2,2,3,3,4,4,5,994 → 3
+	if want := 3.0; !approxEqual(s.MAD, want) {
+		t.Errorf("MAD = %v, want %v", s.MAD, want)
+	}
+
+	// 偶数个样本：1,2,3,4 中位数 2.5，偏差 0.5,0.5,1.5,1.5 → 1
+	if got := calculateStats([]float64{4, 1, 3, 2}).MAD; !approxEqual(got, 1) {
+		t.Errorf("MAD of 1..4 = %v, want 1", got)
+	}
+	if got := calculateStats([]float64{7}); got.MAD != 0 || got.TrimmedMean != 7 {
+		t.Errorf("single sample: MAD=%v TrimmedMean=%v", got.MAD, got.TrimmedMean)
+	}
+}
+
+func TestWelfordMatchesNaive(t *testing.T) {
+	// 大偏移 + 小抖动最容易暴露精度问题
+	r := mathrand.New(mathrand.NewPCG(1, 2))
+	samples := make([]float64, 1_000_000)
+	for i := range samples {
+		samples[i] = 1e6 + r.NormFloat64()*0.5
+	}
+
+	sum := 0.0
+	for _, x := range samples {
+		sum += x
+	}
+	mean := sum / float64(len(samples))
+	variance := 0.0
+	for _, x := range samples {
+		variance += (x - mean) * (x - mean)
+	}
+	variance /= float64(len(samples))
+
+	var w welford
+	for _, x := range samples {
+		w.Add(x)
+	}
+	if math.Abs(w.Mean-mean) > 1e-9*mean {
+		t.Errorf("Mean = %v, naive %v", w.Mean, mean)
+	}
+	if math.Abs(w.Variance()-variance) > 1e-6*variance {
+		t.Errorf("Variance = %v, naive %v", w.Variance(), variance)
+	}
+	if s := calculateStats(samples); math.Abs(s.Stdev-math.Sqrt(variance)) > 1e-6 {
+		t.Errorf("calculateStats Stdev = %v, naive %v", s.Stdev, math.Sqrt(variance))
+	}
+
+	var empty welford
+	if empty.Variance() != 0 {
+		t.Errorf("empty Variance = %v, want 0", empty.Variance())
+	}
+}
+
+func TestGeoMeanAndCV(t *testing.T) {
+	// 1, 10, 100 的几何均值是 10；均值 37，总体 stdev = sqrt(((36)²+(27)²+(63)²)/3)
+	s := calculateStats([]float64{100, 1, 10})
+	if !approxEqual(s.GeoMean, 10) {
+		t.Errorf("GeoMean = %v, want 10", s.GeoMean)
+	}
+	if want := math.Sqrt((36*36+27*27+63*63)/3.0) / 37; !approxEqual(s.CV, want) {
+		t.Errorf("CV = %v, want %v", s.CV, want)
+	}
+
+	if s := calculateStats([]float64{0, 5}); s.GeoMean != 0 {
+		t.Errorf("GeoMean with a zero sample = %v, want 0", s.GeoMean)
+	}
+	if s := calculateStats([]float64{0, 0}); s.CV != 0 {
+		t.Errorf("CV with zero mean = %v, want 0", s.CV)
+	}
+}
+
+func TestShapeMoments(t *testing.T) {
+	tests := []struct {
+		in         []float64
+		skew, kurt float64
+		shape      string
+	}{
+		{[]float64{1, 2, 3, 4, 5}, 0, -1.3, "roughly symmetric, light tails"},
+		{[]float64{1, 2, 3, 4, 10}, 1.1384199576606164, -0.212, "strongly right-skewed, normal-like tails"},
+		{[]float64{7, 7, 7}, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		s := calculateStats(tt.in)
+		if !approxEqual(s.Skewness, tt.skew) || !approxEqual(s.Kurtosis, tt.kurt) {
+			t.Errorf("%v: skewness, kurtosis = %v, %v; want %v, %v", tt.in, s.Skewness, s.Kurtosis, tt.skew, tt.kurt)
+		}
+		if tt.shape != "" {
+			if got := describeShape(s.Skewness, s.Kurtosis); got != tt.shape {
+				t.Errorf("%v: describeShape = %q, want %q", tt.in, got, tt.shape)
+			}
+		}
+	}
+	if got := describeShape(2.5, 8); !strings.HasPrefix(got, "heavy right tail") {
+		t.Errorf("describeShape(2.5, 8) = %q", got)
+	}
+}
+
+func TestMeasureReuse(t *testing.T) {
+	var served atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := served.Add(1); r.URL.Path == "/close" && n >= 3 {
+			w.Header().Set("Connection", "close")
+		}
+		io.WriteString(w, "ok\n")
+	}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	opts := handshakeOptions{
+		TLS:            &tls.Config{InsecureSkipVerify: true},
+		Network:        "tcp",
+		ConnectTimeout: time.Second,
+	}
+
+	r := measureReuse(5, 0, nil, "/", "127.0.0.1", addr.Port, opts, newRecorder(0), io.Discard)
+	if r.Error != "" || r.Requests == nil || r.Requests.Count != 5 || served.Load() != 5 {
+		t.Fatalf("measureReuse = %+v (served %d), want 5 requests on one connection", r, served.Load())
+	}
+	if r.Handshake <= 0 || r.Amortized <= r.Requests.Mean {
+		t.Errorf("Handshake = %v, Amortized = %v, request mean %v", r.Handshake, r.Amortized, r.Requests.Mean)
+	}
+
+	served.Store(0)
+	r = measureReuse(5, 0, nil, "/close", "127.0.0.1", addr.Port, opts, newRecorder(0), io.Discard)
+	if r.Requests == nil || r.Requests.Count != 3 || !strings.Contains(r.Error, "closed the connection after 3 requests") {
+		t.Errorf("measureReuse with Connection: close = %+v", r)
+	}
+}
+
+func TestParseSNIList(t *testing.T) {
+	got, err := parseSNIList(" a.test, b.test,,a.test ")
+	if err != nil || !slices.Equal(got, []string{"a.test", "b.test"}) {
+		t.Errorf("parseSNIList = %q, %v", got, err)
+	}
+
+	path := t.TempDir() + "/sni.txt"
+	os.WriteFile(path, []byte("# fronted names\nc.test\n\nd.test  # staging\n"), 0o644)
+	got, err = parseSNIList("@" + path)
+	if err != nil || !slices.Equal(got, []string{"c.test", "d.test"}) {
+		t.Errorf("parseSNIList(@file) = %q, %v", got, err)
+	}
+
+	if _, err := parseSNIList(" , "); err == nil {
+		t.Error("parseSNIList with no names should fail")
+	}
+}
+
+func TestSNIFindings(t *testing.T) {
+	report := func(sni, fp string, p50 float64) *jsonReport {
+		return &jsonReport{SNI: sni, Successful: 10, TLS: Stats{P50: p50}, Cert: &certInfo{Subject: "CN=" + sni, Fingerprint: fp}}
+	}
+	reports := []*jsonReport{
+		report("a.test", "aa", 10),
+		report("b.test", "aa", 11),
+		report("c.test", "cc", 10.5),
+		report("d.test", "aa", 20),
+		{SNI: "e.test"},
+	}
+	got := sniFindings(reports, 10)
+	if len(got) != 3 ||
+		!strings.HasPrefix(got[0], "c.test: serves a different certificate") ||
+		!strings.HasPrefix(got[1], "d.test: TLS p50") ||
+		got[2] != "e.test: all handshakes failed" {
+		t.Errorf("sniFindings = %q", got)
+	}
+
+	if got := sniFindings(reports[:2], 10); len(got) != 0 {
+		t.Errorf("sniFindings for matching names = %q, want none", got)
+	}
+}
+
+func TestThinPercentiles(t *testing.T) {
+	tests := []struct {
+		n     int
+		names []string
+		need  []int
+	}{
+		{10, []string{"p50", "p90", "p95", "p99", "p99.9"}, []int{20, 100, 200, 1000, 10000}},
+		{100, []string{"p95", "p99", "p99.9"}, []int{200, 1000, 10000}},
+		{1000, []string{"p99.9"}, []int{10000}},
+		{10000, nil, nil},
+	}
+	for _, tt := range tests {
+		names, need := thinPercentiles(tt.n)
+		if !slices.Equal(names, tt.names) || !slices.Equal(need, tt.need) {
+			t.Errorf("thinPercentiles(%d) = %q, %v; want %q, %v", tt.n, names, need, tt.names, tt.need)
+		}
+	}
+}
+
+func TestColdStartCutoff(t *testing.T) {
+	// 前 8 个样本从 50ms 逐渐降到稳态的 10ms 左右
+	var d []float64
+	for i := 0; i < 8; i++ {
+		d = append(d, 50-float64(i)*5)
+	}
+	for i := 0; i < 40; i++ {
+		d = append(d, 10+float64(i%3)*0.2)
+	}
+	// 窗口 [k, k+10) 的中位数在稳态样本过半后才落入容差
+	if got := coldStartCutoff(d); got != 4 {
+		t.Errorf("coldStartCutoff = %d, want 4", got)
+	}
+	if got := coldStartCutoff(d[8:]); got != 0 {
+		t.Errorf("coldStartCutoff on steady samples = %d, want 0", got)
+	}
+	if got := coldStartCutoff(d[:15]); got != 0 {
+		t.Errorf("coldStartCutoff with fewer than two windows = %d, want 0", got)
+	}
+}
+
+func TestALPNPadding(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 255, 256, 257, 258, 600} {
+		used := 0
+		for _, name := range alpnPadding(n) {
+			if len(name) == 0 || len(name) > 255 {
+				t.Errorf("alpnPadding(%d) produced a %d-byte name", n, len(name))
+			}
+			used += 1 + len(name)
+		}
+		want := n
+		if n == 1 {
+			want = 0 // 1 字节无法编码
+		}
+		if used != want {
+			t.Errorf("alpnPadding(%d) uses %d bytes, want %d", n, used, want)
+		}
+	}
+}
+
+func TestPadClientHello(t *testing.T) {
+	for _, size := range []int{1000, 2001, 4096, maxClientHello} {
+		cfg := &tls.Config{ServerName: "example.com"}
+		unpadded, padded, protos, err := padClientHello(cfg, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size <= unpadded {
+			if padded != unpadded {
+				t.Errorf("size %d: padded = %d, want unpadded %d", size, padded, unpadded)
+			}
+			continue
+		}
+		// 填充只剩 1 字节时无法编码，允许少 1 字节
+		if padded != size && padded != size-1 {
+			t.Errorf("size %d: padded = %d (unpadded %d)", size, padded, unpadded)
+		}
+		if !slices.Equal(protos, []string{"http/1.1"}) || cfg.NextProtos[0] != "http/1.1" {
+			t.Errorf("size %d: protos = %q, NextProtos[0] = %q", size, protos, cfg.NextProtos[0])
+		}
+		if got, err := clientHelloSize(cfg); err != nil || got != padded {
+			t.Errorf("size %d: clientHelloSize = %d, %v; want %d", size, got, err, padded)
+		}
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want proxyConfig
+		ok   bool
+	}{
+		{"127.0.0.1:1080", proxyConfig{Scheme: "socks5", Addr: "127.0.0.1:1080"}, true},
+		{"alice:s3cret@proxy.example.com:1080", proxyConfig{"socks5", "proxy.example.com:1080", "alice", "s3cret"}, true},
+		{"bob:p@ss@[::1]:1080", proxyConfig{"socks5", "[::1]:1080", "bob", "p@ss"}, true},
+		{"alice@proxy:1080", proxyConfig{}, false},
+		{":pass@proxy:1080", proxyConfig{}, false},
+		{"proxy", proxyConfig{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseProxy("socks5", tt.in)
+		if (err == nil) != tt.ok || (err == nil && *got != tt.want) {
+			t.Errorf("parseProxy(%q) = %v, %v; want %v, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	// 假代理：要求用户名/密码认证，检查 CONNECT 请求后返回 rep 的应答
+	serve := func(server net.Conn, rep byte) <-chan []byte {
+		got := make(chan []byte, 1)
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 512)
+			io.ReadFull(server, buf[:3]) // VER NMETHODS METHODS
+			server.Write([]byte{0x05, 0x02})
+			io.ReadFull(server, buf[:2])
+			n := int(buf[1])
+			io.ReadFull(server, buf[:n+1])
+			io.ReadFull(server, buf[n+1:n+1+int(buf[n])])
+			server.Write([]byte{0x01, 0x00})
+			// VER CMD RSV ATYP LEN "example.com" PORT
+			req := make([]byte, 5+len("example.com")+2)
+			io.ReadFull(server, req)
+			got <- req
+			server.Write([]byte{0x05, rep, 0x00, 0x03, 4, 'h', 'o', 's', 't', 0x01, 0xbb})
+		}()
+		return got
+	}
+
+	got := serve(server, 0x00)
+	p := &proxyConfig{Scheme: "socks5", Addr: "proxy:1080", User: "u", Pass: "pw"}
+	if err := socks5Connect(client, p, "example.com", 443); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{0x05, 0x01, 0x00, 0x03, 11}, "example.com\x01\xbb"...)
+	if req := <-got; !bytes.Equal(req, want) {
+		t.Errorf("CONNECT request = %x, want %x", req, want)
+	}
+
+	client, server = net.Pipe()
+	defer client.Close()
+	serve(server, 0x05)
+	err := socks5Connect(client, p, "example.com", 443)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("err = %v, want connection refused", err)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	tests := []struct {
+		user    string
+		reply   string
+		wantErr string
+	}{
+		{"", "HTTP/1.1 200 Connection established\r\nVia: test\r\n\r\n", ""},
+		{"alice", "HTTP/1.0 200 OK\r\n\r\n", ""},
+		{"", "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n", "requires authentication"},
+		{"", "HTTP/1.1 502 Bad Gateway\r\n\r\n", "502 Bad Gateway"},
+		{"", "SSH-2.0-OpenSSH\r\n\r\n", "malformed status line"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		reqc := make(chan string, 1)
+		go func() {
+			defer server.Close()
+			var req []byte
+			b := make([]byte, 1)
+			for !bytes.HasSuffix(req, []byte("\r\n\r\n")) {
+				if _, err := server.Read(b); err != nil {
+					return
+				}
+				req = append(req, b[0])
+			}
+			reqc <- string(req)
+			// 应答之后紧跟隧道数据，httpConnect 不能把它读走
+			server.Write([]byte(tt.reply + "tunnel"))
+		}()
+
+		p := &proxyConfig{Scheme: "http", Addr: "proxy:3128", User: tt.user, Pass: "pw"}
+		err := httpConnect(client, p, "example.com", 443)
+		req := <-reqc
+		if !strings.HasPrefix(req, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n") {
+			t.Errorf("request = %q", req)
+		}
+		if hasAuth := strings.Contains(req, "Proxy-Authorization: Basic YWxpY2U6cHc=\r\n"); hasAuth != (tt.user != "") {
+			t.Errorf("user %q: Proxy-Authorization present = %v in %q", tt.user, hasAuth, req)
+		}
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("reply %q: unexpected error %v", tt.reply, err)
+		case tt.wantErr == "":
+			rest, _ := io.ReadAll(client)
+			if string(rest) != "tunnel" {
+				t.Errorf("tunnel data = %q, want %q", rest, "tunnel")
+			}
+		case err == nil || !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("reply %q: err = %v, want %q", tt.reply, err, tt.wantErr)
+		}
+		client.Close()
+	}
+}
+
+func TestAggregateRuns(t *testing.T) {
+	runs := []*jsonReport{
+		{Run: 1, Successful: 10, TLS: Stats{Mean: 10, Stdev: 1, P99: 20}, Total: Stats{Mean: 12}},
+		{Run: 2, Successful: 0},
+		{Run: 3, Successful: 10, TLS: Stats{Mean: 14, Stdev: 3, P99: 30}, Total: Stats{Mean: 16}},
+	}
+	agg, ok := aggregateRuns(runs)
+	if !ok {
+		t.Fatal("aggregateRuns reported no successful runs")
+	}
+	if agg.Runs != 2 {
+		t.Errorf("Runs = %d, want 2 (failed run excluded)", agg.Runs)
+	}
+	if agg.TLSMeans.Mean != 12 || agg.TLSMeans.Min != 10 || agg.TLSMeans.Max != 14 {
+		t.Errorf("TLSMeans = %+v, want mean 12 over [10, 14]", agg.TLSMeans)
+	}
+	if agg.TotalMeans.P50 != 14 {
+		t.Errorf("TotalMeans.P50 = %v, want 14", agg.TotalMeans.P50)
+	}
+	if agg.WithinStdev != 2 {
+		t.Errorf("WithinStdev = %v, want 2", agg.WithinStdev)
+	}
+	if len(agg.Percentiles) != 6 {
+		t.Fatalf("Percentiles = %+v, want TLS and Total p50/p90/p99", agg.Percentiles)
+	}
+	if p := agg.Percentiles[2]; p.Name != "TLS p99" || p.Min != 20 || p.Mean != 25 || p.Max != 30 || p.Spread != 40 {
+		t.Errorf("TLS p99 spread = %+v, want 20/25/30 and 40%%", p)
+	}
+	if p := agg.Percentiles[0]; p.Spread != 0 {
+		t.Errorf("all-zero p50 spread = %v, want 0", p.Spread)
+	}
+
+	if _, ok := aggregateRuns(runs[1:2]); ok {
+		t.Error("aggregateRuns of only failed runs should report !ok")
+	}
+}
+
+// testCert 生成一张由 parent 签发的 ECDSA 证书，parent 为 nil 时自签名
+func testCert(t *testing.T, cn string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// testStaple 构造一个由 key 签名（ECDSA-SHA256）、报告 serial 状态的 OCSP 响应
+func testStaple(t *testing.T, serial int64, revoked bool, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+	single := ocspSingleResponse{
+		CertID:     ocspCertID{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}}, NameHash: []byte{1}, IssuerKeyHash: []byte{2}, SerialNumber: big.NewInt(serial)},
+		ThisUpdate: now,
+		NextUpdate: now.Add(24 * time.Hour),
+	}
+	if revoked {
+		single.Revoked = ocspRevokedInfo{RevocationTime: now.Add(-time.Hour)}
+	} else {
+		single.Good = true
+	}
+	tbs, err := asn1.Marshal(ocspResponseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: []byte{0x04, 0x01, 0x00}},
+		ProducedAt:     now,
+		Responses:      []ocspSingleResponse{single},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(ocspResponseASN1{Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseStaple(t *testing.T) {
+	ca, caKey := testCert(t, "Test CA", 1, nil, nil)
+	other, otherKey := testCert(t, "Other CA", 2, nil, nil)
+	leaf, _ := testCert(t, "leaf", 42, ca, caKey)
+
+	staple, err := parseStaple(testStaple(t, 42, false, caKey), leaf, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staple.Status != "good" || staple.SignatureErr != nil {
+		t.Errorf("good staple = %+v", staple)
+	}
+	if staple.NextUpdate.Sub(staple.ThisUpdate) != 24*time.Hour {
+		t.Errorf("ThisUpdate %v, NextUpdate %v, want 24h apart", staple.ThisUpdate, staple.NextUpdate)
+	}
+
+	staple, err = parseStaple(testStaple(t, 42, true, caKey), leaf, ca)
+	if err != nil || staple.Status != "revoked" || staple.RevokedAt.IsZero() {
+		t.Errorf("revoked staple = %+v, %v", staple, err)
+	}
+
+	// 别的 CA 签名的 staple：能解析但签名不通过
+	staple, err = parseStaple(testStaple(t, 42, true, otherKey), leaf, ca)
+	if err != nil || staple.SignatureErr == nil {
+		t.Errorf("forged staple = %+v, %v; want a signature error", staple, err)
+	}
+	if staple, _ := parseStaple(testStaple(t, 42, false, caKey), leaf, other); staple.SignatureErr == nil {
+		t.Error("staple verified against the wrong issuer")
+	}
+
+	if _, err := parseStaple(testStaple(t, 7, false, caKey), leaf, ca); err == nil {
+		t.Error("staple for another serial number should be rejected")
+	}
+	if _, err := parseStaple([]byte{0x30, 0x03, 0x0a, 0x01, 0x01}, leaf, ca); err == nil { // malformedRequest
+		t.Error("unsuccessful OCSP response should be rejected")
+	}
+}
+
+func TestCheckStapleRevoked(t *testing.T) {
+	ca, caKey := testCert(t, "Test CA", 1, nil, nil)
+	leaf, _ := testCert(t, "leaf", 42, ca, caKey)
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}}
+
+	var res handshakeResult
+	cs.OCSPResponse = testStaple(t, 42, true, caKey)
+	var certErr *tls.CertificateVerificationError
+	if err := checkStaple(cs, ca, &res); !errors.As(err, &certErr) || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("revoked staple: err = %v, want a revocation error", err)
+	}
+
+	// 格式错误的 staple 只记录，不让握手失败
+	res = handshakeResult{}
+	cs.OCSPResponse = []byte("garbage")
+	if err := checkStaple(cs, ca, &res); err != nil || res.OCSP.Status != "malformed" {
+		t.Errorf("malformed staple: err = %v, status %+v", err, res.OCSP)
+	}
+}
+
+func TestDecodeECHConfigList(t *testing.T) {
+	list := []byte{0x00, 0x03, 0xfe, 0x0d, 0x00}
+	for _, in := range []string{"AAP+DQA=", " AAP+DQA=\n"} {
+		got, err := decodeECHConfigList(in)
+		if err != nil || !bytes.Equal(got, list) {
+			t.Errorf("decodeECHConfigList(%q) = %x, %v; want %x", in, got, err, list)
+		}
+	}
+
+	// @file：原始二进制
+	path := t.TempDir() + "/ech.bin"
+	if err := os.WriteFile(path, list, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := decodeECHConfigList("@" + path); err != nil || !bytes.Equal(got, list) {
+		t.Errorf("decodeECHConfigList(@file) = %x, %v; want %x", got, err, list)
+	}
+
+	for _, bad := range []string{"", "Zm9v", "AAA=", "AAX+DQA="} {
+		if _, err := decodeECHConfigList(bad); err == nil {
+			t.Errorf("decodeECHConfigList(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, insecure, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, tls_ecdhe_rsa_with_aes_128_gcm_sha256,TLS_RSA_WITH_3DES_EDE_CBC_SHA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}
+	if !slices.Equal(ids, want) {
+		t.Errorf("ids = %x, want %x", ids, want)
+	}
+	if len(insecure) != 1 || insecure[0] != "TLS_RSA_WITH_3DES_EDE_CBC_SHA" {
+		t.Errorf("insecure = %v, want the 3DES suite only", insecure)
+	}
+
+	_, _, err = parseCipherSuites("TLS_NOPE")
+	if err == nil || !strings.Contains(err.Error(), "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256") {
+		t.Errorf("unknown suite: err = %v, want a list of valid names", err)
+	}
+	if _, _, err := parseCipherSuites("TLS_AES_128_GCM_SHA256"); err == nil {
+		t.Error("TLS 1.3 suite should be rejected")
+	}
+	if _, _, err := parseCipherSuites(" , "); err == nil {
+		t.Error("empty list should be rejected")
+	}
+}
+
+func TestHDRRecorderBinMidpointClamped(t *testing.T) {
+	// 1 位有效数字时 10ms 附近的桶很宽，样本都在桶的下端，桶中点大于 max
+	rec := newRecorder(1)
+	for range 10 {
+		rec.Add(10.01)
+	}
+	s := rec.Stats()
+	if s.TrimmedMean < s.Min || s.TrimmedMean > s.Max {
+		t.Errorf("trimmed mean %v outside [%v, %v]", s.TrimmedMean, s.Min, s.Max)
+	}
+	if problems := statsProblems("tls", s); len(problems) > 0 {
+		t.Errorf("statsProblems: %v", problems)
+	}
+}
+
+func TestHDRRecorderAccuracy(t *testing.T) {
+	// 对数正态分布覆盖 0.05ms 到数百 ms，横跨很多个 2 的幂区间
+	r := mathrand.New(mathrand.NewPCG(3, 4))
+	samples := make([]float64, 100_000)
+	for i := range samples {
+		samples[i] = math.Exp(r.NormFloat64()*1.5 + 2)
+	}
+	sorted := slices.Sorted(slices.Values(samples))
+	nearestRank := func(q float64) float64 {
+		return sorted[max(1, int(math.Ceil(q*float64(len(sorted)))))-1]
+	}
+	exact := calculateStats(samples)
+
+	for _, digits := range []int{1, 2, 3} {
+		// 同一桶内与桶下界的相对误差小于 10^-digits，再留 1ns 的取整误差
+		bound := math.Pow10(-digits)
+		within := func(got, want float64) bool { return math.Abs(got-want) <= want*bound+1e-6 }
+
+		rec := newRecorder(digits)
+		for _, x := range samples {
+			rec.Add(x)
+		}
+		s := rec.Stats()
+		for _, q := range []float64{0.001, 0.25, 0.50, 0.90, 0.99, 0.999} {
+			if got, want := float64(rec.(*hdrRecorder).h.ValueAt(q))/1e6, nearestRank(q); !within(got, want) {
+				t.Errorf("digits=%d q=%v: %v, exact %v (bound %v)", digits, q, got, want, bound)
+			}
+		}
+		if !within(s.P99, nearestRank(0.99)) || !within(s.P999, nearestRank(0.999)) {
+			t.Errorf("digits=%d: P99/P999 = %v/%v, exact %v/%v", digits, s.P99, s.P999, nearestRank(0.99), nearestRank(0.999))
+		}
+		if !within(s.TrimmedMean, exact.TrimmedMean) || !within(s.MAD, exact.MAD) {
+			t.Errorf("digits=%d: TrimmedMean/MAD = %v/%v, exact %v/%v", digits, s.TrimmedMean, s.MAD, exact.TrimmedMean, exact.MAD)
+		}
+		// 在线累计的量与精确方法一致
+		if s.Count != exact.Count || s.Min != exact.Min || s.Max != exact.Max ||
+			math.Abs(s.Mean-exact.Mean) > 1e-9 || math.Abs(s.Stdev-exact.Stdev) > 1e-9 || math.Abs(s.GeoMean-exact.GeoMean) > 1e-9 {
+			t.Errorf("digits=%d: %+v, exact %+v", digits, s, exact)
+		}
+	}
+
+	if s := newRecorder(3).Stats(); s.Count != 0 {
+		t.Errorf("empty hdrRecorder Stats = %+v", s)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	for _, tc := range []struct {
+		level logLevel
+		want  string
+	}{
+		{levelQuiet, ""},
+		{levelInfo, "info\n"},
+		{levelDebug, "info\ndebug\n"},
+	} {
+		var buf bytes.Buffer
+		l := &logger{w: &buf, level: tc.level}
+		l.Infof("info\n")
+		l.Debugf("debug\n")
+		if got := buf.String(); got != tc.want {
+			t.Errorf("level %d: got %q, want %q", tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestMeasureCryptoOnly(t *testing.T) {
+	// 客户端配置里的代理等网络选项不影响进程内握手，ALPN 由服务器照单接受
+	opts := handshakeOptions{
+		TLS:            &tls.Config{NextProtos: []string{"h2"}},
+		Network:        "tcp",
+		ConnectTimeout: time.Second,
+		Proxy:          &proxyConfig{Scheme: "socks5", Addr: "127.0.0.1:1"},
+		Netem:          &netem{RTT: time.Hour},
+	}
+	r := measureCryptoOnly(runPlan{Count: 3, Concurrency: 1}, 0, opts, io.Discard)
+	if r.Errors != 0 || r.TLS == nil || r.TLS.Count != 3 || r.TLS.Min <= 0 {
+		t.Fatalf("report = %+v", *r)
+	}
+	if !strings.HasPrefix(r.Certificate, "RSA-") && !strings.HasPrefix(r.Certificate, "ECDSA") {
+		t.Errorf("server key = %q", r.Certificate)
+	}
+}
+
+func TestMaxChainDepth(t *testing.T) {
+	ca, caKey := testCert(t, "Test CA", 1, nil, nil)
+	leaf, leafKey := testCert(t, "leaf", 2, ca, caKey)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, ca.Raw}, PrivateKey: leafKey}}}
+	srv.StartTLS()
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	opts := &handshakeOptions{TLS: &tls.Config{InsecureSkipVerify: true}, Network: "tcp", ConnectTimeout: time.Second, MaxChainDepth: 2}
+	res, err := measureHandshake("127.0.0.1", port, opts)
+	if err != nil || len(res.State.PeerCertificates) != 2 {
+		t.Fatalf("limit 2: err = %v, chain = %d", err, len(res.State.PeerCertificates))
+	}
+	opts.MaxChainDepth = 1
+	_, err = measureHandshake("127.0.0.1", port, opts)
+	if err == nil || classifyError(err) != errChainDepth || !strings.Contains(err.Error(), "chain of 2 certificates") {
+		t.Errorf("limit 1: err = %v (%s)", err, classifyError(err))
+	}
+
+	// 链长失败是确定性的，与证书错误一样不重试
+	attempts := 0
+	res, err = measureWithRetries(3, time.Millisecond, func() (handshakeResult, error) {
+		attempts++
+		return measureHandshake("127.0.0.1", port, opts)
+	})
+	if attempts != 1 || res.Retries != 0 || classifyError(err) != errChainDepth {
+		t.Errorf("measureWithRetries: %d attempts, retries %d, err %v", attempts, res.Retries, err)
+	}
+}
+
+func TestKeyLog(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	path := filepath.Join(t.TempDir(), "keys.log")
+
+	// 两次运行各打开一次文件：TLS 1.3 写各阶段的 traffic secret，TLS 1.2 写 CLIENT_RANDOM
+	handshake := func(maxVersion uint16) {
+		f, err := openKeyLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		opts := &handshakeOptions{TLS: &tls.Config{InsecureSkipVerify: true, MaxVersion: maxVersion, KeyLogWriter: f}, Network: "tcp", ConnectTimeout: time.Second}
+		if _, err := measureHandshake("127.0.0.1", port, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handshake(tls.VersionTLS13)
+	handshake(tls.VersionTLS12)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		label, _, _ := strings.Cut(line, " ")
+		labels[label]++
+	}
+	if labels["CLIENT_HANDSHAKE_TRAFFIC_SECRET"] != 1 || labels["CLIENT_TRAFFIC_SECRET_0"] != 1 || labels["CLIENT_RANDOM"] != 1 {
+		t.Errorf("key log labels = %v", labels)
+	}
+	if fi, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("key log mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestMeasureHandshakeConnectOnly(t *testing.T) {
+	// 普通 TCP 端口：accept 后什么也不发，TLS 握手会一直等下去
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	opts := &handshakeOptions{TLS: &tls.Config{}, Network: "tcp", ConnectTimeout: time.Second, HandshakeTimeout: time.Second, ConnectOnly: true}
+	res, err := measureHandshake("127.0.0.1", ln.Addr().(*net.TCPAddr).Port, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TCP <= 0 || res.TLS != 0 || res.State.Version != 0 || res.Family != "IPv4" {
+		t.Errorf("result = TCP %s, TLS %s, version %x, family %q", res.TCP, res.TLS, res.State.Version, res.Family)
+	}
+}
+
+func TestMeasureHandshakePhases(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	opts := handshakeOptions{
+		TLS:            &tls.Config{RootCAs: roots},
+		Network:        "tcp",
+		ConnectTimeout: time.Second,
+		Phases:         true,
+	}
+
+	res, err := measureHandshake("127.0.0.1", srv.Listener.Addr().(*net.TCPAddr).Port, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := res.Phases
+	if p == nil {
+		t.Fatal("Phases = nil with opts.Phases")
+	}
+	if p.ServerHello <= 0 || p.ServerFlight < 0 || p.Verify < res.Verify || p.Finished < 0 {
+		t.Errorf("Phases = %+v (Verify %v)", *p, res.Verify)
+	}
+	// 四段首尾相接，之和就是 TLS
+	if sum := p.ServerHello + p.ServerFlight + p.Verify + p.Finished; sum != res.TLS {
+		t.Errorf("phases sum to %v, TLS = %v", sum, res.TLS)
+	}
+}
+
+func TestMeasurePaired(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	opts := handshakeOptions{
+		TLS:            &tls.Config{RootCAs: roots},
+		Network:        "tcp",
+		ConnectTimeout: time.Second,
+	}
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	r := measurePaired(runPlan{Count: 5, Concurrency: 1}, 0, "127.0.0.1", port, opts, io.Discard)
+	if r.Pairs != 5 || r.Errors != 0 || r.TCPOnly == nil || r.Overhead == nil {
+		t.Fatalf("report = %+v", *r)
+	}
+	if r.TCPOnly.Count != 5 || r.Overhead.Count != 5 || r.Overhead.Mean <= 0 {
+		t.Errorf("TCP-only %+v, overhead %+v", *r.TCPOnly, *r.Overhead)
+	}
+
+	srv.Close()
+	r = measurePaired(runPlan{Count: 2, Concurrency: 1}, 0, "127.0.0.1", port, opts, io.Discard)
+	if r.Pairs != 0 || r.Errors != 2 || r.Overhead != nil {
+		t.Errorf("closed server: report = %+v", *r)
+	}
+}
+
+// 稳定字段是 -compare-go-rust 和 diff 脚本依赖的键名，改名需递增 reportSchema
+func TestJSONReportStableKeys(t *testing.T) {
+	b, err := json.Marshal(jsonReport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"schema", "tool", "library", "host", "port", "count", "successful", "errors", "unit", "tcp", "tls", "total"} {
+		if _, ok := got[k]; !ok {
+			t.Errorf("jsonReport has no %q key", k)
+		}
+	}
+	var stats map[string]json.RawMessage
+	json.Unmarshal(got["tls"], &stats)
+	for _, k := range []string{"count", "min", "max", "p50", "p90", "p99", "mean", "stdev"} {
+		if _, ok := stats[k]; !ok {
+			t.Errorf("Stats has no %q key", k)
+		}
+	}
+}
+
+func TestEdgeSpread(t *testing.T) {
+	report := func(ip string, p50 float64) *jsonReport {
+		return &jsonReport{Host: ip, SNI: "cdn.test", Successful: 10, Total: Stats{P50: p50}}
+	}
+	reports := []*jsonReport{
+		report("192.0.2.1", 12),
+		report("192.0.2.2", 9),
+		{Host: "192.0.2.3", SNI: "cdn.test"},
+		report("2001:db8::1", 20),
+		report("192.0.2.4", 15),
+	}
+	fastest, slowest, failed := edgeSpread(reports)
+	if fastest != reports[1] || slowest != reports[3] || len(failed) != 1 || failed[0] != reports[2] {
+		t.Errorf("edgeSpread = %v, %v, %v", fastest, slowest, failed)
+	}
+
+	var buf bytes.Buffer
+	printEdgeComparison(&buf, reports, 10)
+	if s := buf.String(); !strings.Contains(s, "Fastest: 192.0.2.2") || !strings.Contains(s, "Slowest: 2001:db8::1") ||
+		!strings.Contains(s, "192.0.2.3: all handshakes failed") || !strings.Contains(s, "not equivalent") {
+		t.Errorf("printEdgeComparison:\n%s", s)
+	}
+
+	if fastest, slowest, _ := edgeSpread(reports[2:3]); fastest != nil || slowest != nil {
+		t.Errorf("edgeSpread with no successful address = %v, %v", fastest, slowest)
+	}
+}
+
+func TestAppendJSONL(t *testing.T) {
+	path := t.TempDir() + "/runs.jsonl"
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CST", 8*3600))
+	for run := 1; run <= 2; run++ {
+		r := &jsonReport{Host: "a.test", Port: 443, Run: run, Successful: 5, Unit: "ms", TLS: Stats{Count: 5, P99: 9}}
+		if err := appendJSONL(path, newRunSummary(r, started)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, line := range lines {
+		var s runSummary
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if s.Timestamp != "2026-01-01T19:04:05Z" || s.Run != i+1 || s.Host != "a.test" || s.TLS.P99 != 9 || s.Tool != "go" {
+			t.Errorf("line %d = %+v", i+1, s)
+		}
+	}
+}
+
+func TestWriteCSVSummary(t *testing.T) {
+	path := t.TempDir() + "/summary.csv"
+	full := Stats{Count: 5, Min: 1, P50: 2, P90: 3, P95: 3, P99: 4, P999: 4, Max: 4, Mean: 2.5, Stdev: 1}
+	reports := []*jsonReport{
+		{Host: "a,b.test", Port: 443, Count: 5, Successful: 5, TCP: full, TLS: full, Total: full},
+		{Host: "=cmd|' /c calc'!A1", Port: 8443, Run: 2, Count: 5, Errors: 5},
+	}
+	if err := writeCSVSummary(path, reports); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || len(rows[0]) != 8+27 || rows[0][0] != "host" || rows[0][8] != "tcp_min_ms" {
+		t.Fatalf("header = %v (%d rows)", rows[0], len(rows))
+	}
+	if r := rows[1]; r[0] != "a,b.test" || r[1] != "443" || r[4] != "" || r[9] != "2.000" || r[13] != "" || r[16] != "1.000" {
+		t.Errorf("row 1 = %v", r)
+	}
+	if r := rows[2]; r[0] != "'=cmd|' /c calc'!A1" || r[4] != "2" || r[7] != "5" || r[8] != "" || r[34] != "" {
+		t.Errorf("row 2 = %v", r)
+	}
+}
+
+func TestStatsProblems(t *testing.T) {
+	rng := mathrand.New(mathrand.NewPCG(1, 2))
+	for _, n := range []int{1, 2, 7, 100, 1500} {
+		samples := make([]float64, n)
+		for i := range samples {
+			samples[i] = rng.ExpFloat64() * 5
+		}
+		if p := statsProblems("tls", calculateStats(samples)); len(p) != 0 {
+			t.Errorf("calculateStats(%d samples): %q", n, p)
+		}
+	}
+
+	bad := Stats{Count: 3, Min: 1, P50: 3, P90: 2, P95: 2, P99: 2, P999: 2, Max: 2, Mean: 5, TrimmedMean: 1.5}
+	if p := statsProblems("tls", bad); len(p) != 2 || p[0] != "tls: p50 3 > p90 2" || !strings.HasPrefix(p[1], "tls: mean 5 outside") {
+		t.Errorf("statsProblems(bad) = %q", p)
+	}
+}
+
+// runCLI 以 args 运行一次 run()，返回退出码和 stdout 的内容，stderr 丢弃。
+// 每次使用新的 flag.CommandLine，同一测试进程里可以多次调用。
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	path := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout, stderr, argv, fs := os.Stdout, os.Stderr, os.Args, flag.CommandLine
+	os.Stdout, os.Stderr = f, devnull
+	os.Args = append([]string{"tls_bench"}, args...)
+	flag.CommandLine = flag.NewFlagSet("tls_bench", flag.ExitOnError)
+	defer func() {
+		os.Stdout, os.Stderr, os.Args, flag.CommandLine = stdout, stderr, argv, fs
+		diag.level = levelInfo
+	}()
+
+	code := run()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(data)
+}
+
+// refusedAddr 返回一个刚关闭的本地端口，连接会被拒绝
+func refusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// 端到端：-selftest 对进程内服务器跑完整流程，统计一致时退出码为 0
+func TestSelftest(t *testing.T) {
+	if code, _ := runCLI(t, "-selftest", "-q", "-count", "30", "-delay", "0", "-warmup", "1", "-resume"); code != 0 {
+		t.Errorf("run -selftest = %d, want 0", code)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	base := &jsonReport{Host: "example.com", Port: 443,
+		TCP:   Stats{Count: 10, Min: 1, P50: 2, P90: 3, P95: 3, P99: 4, Max: 5, Mean: 2},
+		TLS:   Stats{Count: 10, Min: 5, P50: 10, P90: 12, P95: 13, P99: 20, Max: 25, Mean: 11},
+		Total: Stats{Count: 10, Min: 6, P50: 12, P90: 15, P95: 16, P99: 24, Max: 30, Mean: 13},
+	}
+	path := filepath.Join(dir, "base.json")
+	data, _ := json.Marshal(base)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadBaseline(path)
+	if err != nil || loaded.Host != "example.com" || loaded.TLS != base.TLS {
+		t.Fatalf("loadBaseline = %+v, %v", loaded, err)
+	}
+	empty := filepath.Join(dir, "empty.json")
+	os.WriteFile(empty, []byte(`{"host": "example.com", "tls": {"count": 0}}`), 0o644)
+	if _, err := loadBaseline(empty); err == nil || !strings.Contains(err.Error(), "no TLS samples") {
+		t.Errorf("loadBaseline(no samples) = %v", err)
+	}
+
+	// 不参与判定的行（TCP 全部、TLS p90/max）大幅上涨也不算回归
+	compare := func(tlsP50, tlsP99 float64) (bool, []string) {
+		tcpS, tlsS := base.TCP, base.TLS
+		tcpS.P50, tcpS.P99 = 20, 40
+		tlsS.P90, tlsS.Max = 100, 200
+		tlsS.P50, tlsS.P99 = tlsP50, tlsP99
+		var buf bytes.Buffer
+		regressed := printBaselineComparison(&buf, loaded, tcpS, tlsS, base.Total, 10)
+		var flagged []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasSuffix(line, "⚠️  regression") {
+				flagged = append(flagged, line)
+			}
+		}
+		return regressed, flagged
+	}
+	if regressed, flagged := compare(10.5, 21); regressed || len(flagged) > 0 {
+		t.Errorf("ungated rows counted as a regression: %q", flagged)
+	}
+	for _, tc := range []struct {
+		name     string
+		p50, p99 float64
+		row      string
+	}{
+		{"p50", 11.5, 20, "  p50:"},
+		{"p99", 10, 23, "  p99:"},
+	} {
+		regressed, flagged := compare(tc.p50, tc.p99)
+		if !regressed || len(flagged) != 1 || !strings.HasPrefix(flagged[0], tc.row) {
+			t.Errorf("TLS %s +15%%: regressed %v, flagged %q", tc.name, regressed, flagged)
+		}
+	}
+
+	// 端点完全不可用时不能通过回归门禁
+	if code, _ := runCLI(t, "-baseline", path, "-q", "-warmup", "0", "-delay", "0", "-count", "3", refusedAddr(t)); code != 1 {
+		t.Errorf("-baseline against a refused port: exit %d, want 1", code)
+	}
+}
+
+// -json 单目标全部失败时 stdout 仍是一份完整报告
+func TestJSONNoSuccess(t *testing.T) {
+	code, out := runCLI(t, "-json", "-q", "-warmup", "0", "-delay", "0", "-count", "3", refusedAddr(t))
+	var r jsonReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("stdout is not a JSON report (%v): %q", err, out)
+	}
+	if code != 0 || r.Count != 3 || r.Successful != 0 || r.Errors != 3 || r.ErrorKinds[errTCPRefused] != 3 {
+		t.Errorf("exit %d, report %+v", code, r)
+	}
+}
+
+// 全部握手失败时阈值门禁必须失败，不能因为没有样本而放行
+func TestThresholdsNoSuccess(t *testing.T) {
+	addr := refusedAddr(t)
+	for _, gate := range [][]string{{"-max-p50", "1"}, {"-max-p99", "1"}, {"-fail-on-warn"}} {
+		args := append(gate, "-q", "-warmup", "0", "-delay", "0", "-count", "3", addr)
+		if code, _ := runCLI(t, args...); code != 1 {
+			t.Errorf("%v against a refused port: exit %d, want 1", gate, code)
+		}
+	}
+	if code, _ := runCLI(t, "-q", "-warmup", "0", "-delay", "0", "-count", "3", addr); code != 0 {
+		t.Errorf("no gate: exit %d, want 0", code)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	for _, tc := range []struct {
+		sorted []float64
+		q      float64
+		want   float64
+	}{
+		{[]float64{7}, 0, 7},
+		{[]float64{7}, 0.5, 7},
+		{[]float64{7}, 1, 7},
+		{[]float64{1, 3}, 0, 1},
+		{[]float64{1, 3}, 0.5, 2},
+		{[]float64{1, 3}, 0.25, 1.5},
+		{[]float64{1, 3}, 1, 3},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{1, 2, 3, 4, 5}, 0.5, 3},
+		{[]float64{1, 2, 3, 4, 5}, 0.9, 4.6},
+		{[]float64{1, 2, 3, 4, 5}, 0.99, 4.96},
+		{[]float64{2, 2, 2}, 0.75, 2},
+		{[]float64{1, 2, 3}, -0.5, 1}, // 超出 [0, 1] 按端点
+		{[]float64{1, 2, 3}, 1.5, 3},
+	} {
+		if got := percentile(tc.sorted, tc.q); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tc.sorted, tc.q, got, tc.want)
+		}
+	}
+	if got := percentile(nil, 0.5); !math.IsNaN(got) {
+		t.Errorf("percentile(nil) = %v, want NaN", got)
+	}
+}
+
+func TestNewSLOReport(t *testing.T) {
+	if r := newSLOReport(0, 99, 5, 10); r != nil {
+		t.Errorf("newSLOReport without -slo-ms = %+v, want nil", r)
+	}
+	for _, tc := range []struct {
+		target           float64
+		within, measured int
+		compliance       float64
+		passed           bool
+	}{
+		{99, 973, 1000, 97.3, false},
+		{97.3, 973, 1000, 97.3, true},
+		{0, 1, 4, 25, true}, // 未设目标只报告
+		{50, 0, 0, 0, false},
+	} {
+		r := newSLOReport(20, tc.target, tc.within, tc.measured)
+		if math.Abs(r.Compliance-tc.compliance) > 1e-9 || r.Passed != tc.passed || r.ThresholdMs != 20 {
+			t.Errorf("newSLOReport(20, %v, %d, %d) = %+v", tc.target, tc.within, tc.measured, r)
+		}
+	}
+}
+
+func TestGreatCircleKm(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 1.3, 103.8, 1.3, 103.8, 0},
+		{"quarter meridian", 0, 0, 90, 0, 10007.5},
+		{"antipodes", 0, 0, 0, 180, 20015.1},
+		{"London-New York", 51.5074, -0.1278, 40.7128, -74.0060, 5570},
+	} {
+		if got := greatCircleKm(tc.lat1, tc.lon1, tc.lat2, tc.lon2); math.Abs(got-tc.want) > 1 {
+			t.Errorf("%s: %v km, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseLatLon(t *testing.T) {
+	if lat, lon, err := parseLatLon("1.35, 103.82"); err != nil || lat != 1.35 || lon != 103.82 {
+		t.Errorf("parseLatLon = %v, %v, %v", lat, lon, err)
+	}
+	for _, s := range []string{"", "1.35", "91,0", "0,-181", "a,b"} {
+		if _, _, err := parseLatLon(s); err == nil {
+			t.Errorf("parseLatLon(%q) succeeded", s)
+		}
+	}
+}
+
+func TestAnnotateGeo(t *testing.T) {
+	db := map[string]geoInfo{
+		"192.0.2.1": {Country: "SG", City: "Singapore", Latitude: 1.29, Longitude: 103.85},
+		"192.0.2.2": {Country: "JP"}, // Country 库：没有经纬度
+	}
+	locate := func(ip net.IP) (geoInfo, error) { return db[ip.String()], nil }
+	origin := &[2]float64{1.29, 103.85}
+
+	got := annotateGeo(locate, map[string]int{"192.0.2.2": 3, "192.0.2.1": 7, "198.51.100.1": 3}, origin)
+	if len(got) != 3 || got[0].IP != "192.0.2.1" || got[1].IP != "192.0.2.2" || got[2].IP != "198.51.100.1" {
+		t.Fatalf("annotateGeo order = %+v", got)
+	}
+	if g := got[0]; g.Handshakes != 7 || g.City != "Singapore" || g.DistanceKm == nil || *g.DistanceKm > 0.001 || *g.MinRTTMs > 0.001 {
+		t.Errorf("annotateGeo[0] = %+v", g)
+	}
+	if got[1].DistanceKm != nil || got[2].Country != "" {
+		t.Errorf("annotateGeo without location = %+v, %+v", got[1], got[2])
+	}
+}
+
+func TestQUICVarint(t *testing.T) {
+	for _, tc := range []struct {
+		v    uint64
+		want string
+	}{
+		// RFC 9000 附录 A.1 的示例
+		{37, "25"},
+		{15293, "7bbd"},
+		{494878333, "9d7f3e7d"},
+		{151288809941952652, "c2197c5eff14e88c"},
+	} {
+		if got := hex.EncodeToString(quicVarint(nil, tc.v)); got != tc.want {
+			t.Errorf("quicVarint(%d) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestQPACKInt(t *testing.T) {
+	// RFC 7541 附录 C.1：5 位前缀编码 10 与 1337，8 位前缀编码 42
+	for _, tc := range []struct {
+		n    uint
+		v    uint64
+		want string
+	}{
+		{5, 10, "0a"},
+		{5, 1337, "1f9a0a"},
+		{8, 42, "2a"},
+	} {
+		if got := hex.EncodeToString(qpackInt(nil, tc.n, 0, tc.v)); got != tc.want {
+			t.Errorf("qpackInt(%d, %d) = %s, want %s", tc.n, tc.v, got, tc.want)
+		}
+	}
+	if got := qpackInt(nil, 6, 0xc0, 17); !bytes.Equal(got, []byte{0xd1}) {
+		t.Errorf("qpackInt with flag bits = %x, want d1", got)
+	}
+}
+
+func TestH3GetRequest(t *testing.T) {
+	got := hex.EncodeToString(h3GetRequest("localhost:8450", "/hello"))
+	want := "011c0000d1d7500e6c6f63616c686f73743a3834353051062f68656c6c6f"
+	if got != want {
+		t.Errorf("h3GetRequest = %s, want %s", got, want)
+	}
+}
+
+// writerSamples 返回一个经代理的成功样本（total = tcp + proxy + tls = 6ms）和一个失败样本
+func writerSamples() []sample {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []sample{
+		{Index: 1, Worker: 0, Start: start, Result: handshakeResult{DNS: time.Millisecond, TCP: 2 * time.Millisecond, Proxy: time.Millisecond, TLS: 3 * time.Millisecond,
+			State: tls.ConnectionState{Version: tls.VersionTLS13}}},
+		{Index: 2, Worker: 1, Start: start.Add(time.Second), Err: errors.New("dial tcp: connection refused")},
+	}
+}
+
+func TestCSVSampleWriter(t *testing.T) {
+	readRows := func(path string) [][]string {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	write := func(path string, multiTarget bool) {
+		t.Helper()
+		sw, err := newCSVSampleWriter(path, multiTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sw.target = "a.test:443"
+		for _, s := range writerSamples() {
+			if err := sw.Write(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "samples.csv")
+	write(path, false)
+	rows := readRows(path)
+	if len(rows) != 3 || strings.Join(rows[0], ",") != "index,dns_ms,tcp_ms,tls_ms,total_ms,timestamp,error,tls_version" {
+		t.Fatalf("rows = %v", rows)
+	}
+	if r := rows[1]; strings.Join(r, ",") != "1,1.000,2.000,3.000,6.000,2026-01-02T03:04:05Z,,TLS 1.3" {
+		t.Errorf("success row = %v", r)
+	}
+	// 失败行耗时列留空，error 列为错误信息
+	if r := rows[2]; strings.Join(r, ",") != "2,,,,,2026-01-02T03:04:06Z,dial tcp: connection refused," {
+		t.Errorf("error row = %v", r)
+	}
+
+	// 多目标时首列为 target
+	write(path, true)
+	rows = readRows(path)
+	if len(rows) != 3 || rows[0][0] != "target" || rows[1][0] != "a.test:443" || rows[2][0] != "a.test:443" || rows[2][1] != "2" || rows[2][7] != "dial tcp: connection refused" {
+		t.Errorf("multi-target rows = %v", rows)
+	}
+
+	// "-" 写到标准输出
+	out := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		stdout := os.Stdout
+		os.Stdout = f
+		defer func() { os.Stdout = stdout }()
+		write("-", false)
+	}()
+	f.Close()
+	if rows := readRows(out); len(rows) != 3 || rows[0][0] != "index" || rows[1][4] != "6.000" {
+		t.Errorf("stdout rows = %v", rows)
+	}
+}
+
+func TestRawSampleWriter(t *testing.T) {
+	for _, tc := range []struct {
+		withTarget, withWorker bool
+		want                   string
+	}{
+		{false, false, "tcp_ms,tls_ms,total_ms\n2.000000,3.000000,6.000000\n"},
+		{true, true, "target,worker,tcp_ms,tls_ms,total_ms\na.test:443,0,2.000000,3.000000,6.000000\n"},
+	} {
+		path := filepath.Join(t.TempDir(), "raw.csv")
+		rw, err := newRawSampleWriter(path, tc.withTarget, tc.withWorker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw.target = "a.test:443"
+		// 失败样本不输出
+		for _, s := range writerSamples() {
+			if err := rw.Write(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.want {
+			t.Errorf("target=%v worker=%v: got %q, want %q", tc.withTarget, tc.withWorker, data, tc.want)
+		}
+	}
+}
+
+func TestNDJSONSample(t *testing.T) {
+	var lines []string
+	for _, s := range writerSamples() {
+		b, err := json.Marshal(newNDJSONSample("a.test:443", s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(b))
+	}
+	// total_ms 含代理一跳：2 (tcp) + 1 (proxy) + 3 (tls)
+	if want := `{"target":"a.test:443","index":1,"timestamp":"2026-01-02T03:04:05Z","ok":true,"dns_ms":1,"tcp_ms":2,"tls_ms":3,"total_ms":6,"version":"TLS 1.3"}`; lines[0] != want {
+		t.Errorf("ok line = %s, want %s", lines[0], want)
+	}
+	if want := `{"target":"a.test:443","index":2,"timestamp":"2026-01-02T03:04:06Z","ok":false,"error":"dial tcp: connection refused"}`; lines[1] != want {
+		t.Errorf("error line = %s, want %s", lines[1], want)
+	}
+	// 单目标时不输出 target
+	if b, _ := json.Marshal(newNDJSONSample("", writerSamples()[1])); strings.Contains(string(b), "target") {
+		t.Errorf("single-target line = %s", b)
+	}
+}
+
+// -resume：首次为完整握手，之后复用会话票据，两类握手分开统计
+func TestSelftestResume(t *testing.T) {
+	code, out := runCLI(t, "-selftest", "-resume", "-json", "-q", "-warmup", "0", "-delay", "0", "-count", "5")
+	var r jsonReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("stdout is not a JSON report (%v): %q", err, out)
+	}
+	res := r.Resumption
+	if code != 0 || res == nil || res.Full == nil || res.Resumed == nil {
+		t.Fatalf("exit %d, resumption %+v", code, res)
+	}
+	if res.Full.Count != 1 || res.Resumed.Count != 4 || !approxEqual(res.ResumedPercent, 80) {
+		t.Errorf("full %d, resumed %d (%.1f%%), want 1 and 4 (80%%)", res.Full.Count, res.Resumed.Count, res.ResumedPercent)
+	}
+}
+
+func TestHTTPTTFB(t *testing.T) {
+	// usageErrorf 调用 os.Exit，h2 冲突在子进程中检查
+	if os.Getenv("TLS_BENCH_HTTP_H2") == "1" {
+		os.Args = []string{"tls_bench", "-http", "/", "-alpn", "h2,http/1.1", "127.0.0.1:1"}
+		run()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHTTPTTFB$")
+	cmd.Env = append(os.Environ(), "TLS_BENCH_HTTP_H2=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 || !strings.Contains(stderr.String(), "-http speaks HTTP/1.1 only") {
+		t.Errorf("-http with -alpn h2: %v, stderr %q", err, stderr.String())
+	}
+
+	const delay = 20 * time.Millisecond
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/slow" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(delay)
+		io.WriteString(w, "ok\n")
+	}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	// TTFB 从发出请求算起，包含服务器处理时间
+	opts := &handshakeOptions{TLS: &tls.Config{InsecureSkipVerify: true}, Network: "tcp", ConnectTimeout: time.Second, HTTPPath: "/slow"}
+	res, err := measureHandshake("127.0.0.1", port, opts)
+	if err != nil || res.HTTPStatus != 200 || res.TTFB < delay {
+		t.Errorf("GET /slow: status %d, ttfb %v, err %v", res.HTTPStatus, res.TTFB, err)
+	}
+
+	// 端到端：状态码按次计数，非 2xx 不算握手失败
+	code, out := runCLI(t, "-insecure", "-http", "/missing", "-json", "-q", "-warmup", "0", "-delay", "0", "-count", "3", srv.Listener.Addr().String())
+	var r jsonReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("stdout is not a JSON report (%v): %q", err, out)
+	}
+	if code != 0 || r.Successful != 3 || r.HTTPStatus["404"] != 3 || r.TTFB == nil || r.TTFB.Count != 3 {
+		t.Errorf("-http /missing: exit %d, successful %d, http_status %v, ttfb %+v", code, r.Successful, r.HTTPStatus, r.TTFB)
+	}
+}
@@ -0,0 +1,157 @@
+//go:build quic
+
+// QUIC 握手测量（-quic），需要 github.com/quic-go/quic-go v0.48+，仅在 -tags quic 时编译。
+// 未编译本文件时 -quic 不可用。
+//
+// Usage: go run -tags quic tls_bench_go.go tls_bench_quic.go -quic <host> <port> [count]
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func init() {
+	quicHandshake = measureQUICHandshake
+}
+
+// measureQUICHandshake 完成一次 DNS 解析 + QUIC 握手。
+// TLS 记录连接可发送应用数据的耗时：服务器接受 0-RTT 时为 DialAddrEarly 返回的时刻，
+// 否则为握手完成（1-RTT）的时刻。opts.EarlyData 时拨号后立即发送 HTTP/3 GET，
+// 有 session ticket 时请求即为 0-RTT 数据，FirstResponse 记录到响应首字节的耗时。
+func measureQUICHandshake(host string, port int, opts *handshakeOptions) (res handshakeResult, err error) {
+	// 1. DNS 解析（IP 字面量跳过）
+	addrs, dnsDuration, err := resolve(host, opts.Network)
+	res.DNS = dnsDuration
+	if err != nil {
+		return res, err
+	}
+
+	tlsConfig := opts.TLS.Clone()
+	tlsConfig.ServerName = host
+	if opts.SNI != "" {
+		tlsConfig.ServerName = opts.SNI
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"h3"}
+	}
+
+	timeout := opts.HandshakeTimeout
+	if timeout == 0 {
+		timeout = opts.ConnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 2. QUIC 握手（UDP 无连接，不单独统计 TCP 阶段）
+	start := time.Now()
+	conn, err := quic.DialAddrEarly(ctx, net.JoinHostPort(addrs[0], strconv.Itoa(port)), tlsConfig, &quic.Config{})
+	if err != nil {
+		if isTimeout(err) || ctx.Err() != nil {
+			return res, fmt.Errorf("QUIC handshake timed out after %s: %w", timeout, err)
+		}
+		var te *quic.TransportError
+		if errors.As(err, &te) && te.ErrorCode.IsCryptoError() {
+			return res, &tlsHandshakeError{err} // 携带 TLS alert 的 CRYPTO_ERROR
+		}
+		return res, err
+	}
+	defer conn.CloseWithError(0, "")
+	early := time.Since(start)
+
+	// 请求与握手并行进行，结果经 channel 交回，避免与提前返回的 res 竞争
+	type firstResponse struct {
+		d   time.Duration
+		err error
+	}
+	var response chan firstResponse
+	if opts.EarlyData {
+		response = make(chan firstResponse, 1)
+		authority := tlsConfig.ServerName
+		if port != 443 {
+			authority = net.JoinHostPort(authority, strconv.Itoa(port))
+		}
+		path := opts.HTTPPath
+		if path == "" {
+			path = "/"
+		}
+		go func() {
+			err := sendEarlyGET(ctx, conn, authority, path)
+			response <- firstResponse{time.Since(start), err}
+		}()
+	}
+
+	select {
+	case <-conn.HandshakeComplete():
+	case <-ctx.Done():
+		return res, fmt.Errorf("QUIC handshake timed out after %s: %w", timeout, ctx.Err())
+	}
+	res.TLS = time.Since(start)
+
+	state := conn.ConnectionState()
+	res.State = state.TLS
+	res.ZeroRTT = state.Used0RTT
+	if res.ZeroRTT {
+		res.TLS = early
+	}
+	res.Family = addrFamily(conn.RemoteAddr())
+	if response != nil {
+		r := <-response
+		if r.err != nil {
+			return res, &httpError{fmt.Errorf("HTTP/3 GET: %w", r.err)}
+		}
+		res.FirstResponse = r.d
+	}
+
+	// session ticket 在握手后下发，稍等片刻使其进入缓存，供下一次 0-RTT 使用
+	if tlsConfig.ClientSessionCache != nil {
+		time.Sleep(ticketWait)
+	}
+	return res, nil
+}
+
+// sendEarlyGET 在 conn 上发送 HTTP/3 GET 并读到响应的第一个字节。握手完成前调用时请求随 0-RTT 发出；
+// 服务器拒绝 0-RTT 时早期数据全部作废，等握手完成后在同一连接上重发一次。
+func sendEarlyGET(ctx context.Context, conn *quic.Conn, authority, path string) error {
+	err := h3FirstByte(ctx, conn, authority, path)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		if conn, err = conn.NextConnection(ctx); err != nil {
+			return err
+		}
+		err = h3FirstByte(ctx, conn, authority, path)
+	}
+	return err
+}
+
+// h3FirstByte 打开控制流和一个请求流，写入 GET 请求后读取响应的第一个字节
+func h3FirstByte(ctx context.Context, conn *quic.Conn, authority, path string) error {
+	control, err := conn.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	if _, err := control.Write(h3ControlPreface); err != nil {
+		return err
+	}
+	str, err := conn.OpenStream()
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		str.SetDeadline(deadline) // 服务器不回应时不能一直等下去
+	}
+	if _, err := str.Write(h3GetRequest(authority, path)); err != nil {
+		return err
+	}
+	str.Close() // 请求没有 body，关闭发送方向
+	_, err = io.ReadFull(str, make([]byte, 1))
+	str.CancelRead(0x10c) // H3_REQUEST_CANCELLED：只需要首字节
+	return err
+}